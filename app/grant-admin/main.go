@@ -0,0 +1,55 @@
+// Command grant-admin grants the admin role to a registered user. It
+// bootstraps the first admin, who can then manage roles through
+// PUT /admin/users/{id}/roles. Check that the account belongs to the right
+// person before running it, since anyone can register any email.
+//
+// Usage:
+//
+//	grant-admin <email>
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"p3-graded-challenge-2-ziancarlos/config"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/repository"
+	"slices"
+	"strings"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: grant-admin <email>")
+		os.Exit(2)
+	}
+	email := strings.ToLower(strings.TrimSpace(os.Args[1]))
+
+	// Load configuration
+	cfg := config.LoadConfig()
+
+	// Connect to MongoDB
+	client, err := config.ConnectDB(cfg.MongoURI)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	userRepo := repository.NewUserRepository(config.GetCollection(client, cfg.ShoppingDBName, "users"))
+
+	user, err := userRepo.FindByEmail(context.Background(), email)
+	if err != nil {
+		log.Fatalf("Failed to find user %s: %v", email, err)
+	}
+	if slices.Contains(user.Roles, models.RoleAdmin) {
+		log.Printf("User %s (%s) is already an admin", email, user.ID.Hex())
+		return
+	}
+
+	if _, err := userRepo.SetRoles(context.Background(), user.ID, []string{models.RoleCustomer, models.RoleAdmin}); err != nil {
+		log.Fatalf("Failed to grant admin role: %v", err)
+	}
+	log.Printf("Granted the admin role to %s (%s), it applies from their next login or refresh", email, user.ID.Hex())
+}
@@ -8,16 +8,22 @@ import (
 	"p3-graded-challenge-2-ziancarlos/controllers"
 	_ "p3-graded-challenge-2-ziancarlos/docs"
 	"p3-graded-challenge-2-ziancarlos/middleware"
+	"p3-graded-challenge-2-ziancarlos/models"
+	pb "p3-graded-challenge-2-ziancarlos/proto/payment"
 	"p3-graded-challenge-2-ziancarlos/repository"
 	"p3-graded-challenge-2-ziancarlos/scheduler"
 	"p3-graded-challenge-2-ziancarlos/service"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
+// orderSettlerUserID is the user the order settler reads payments as.
+const orderSettlerUserID = "order-settler"
+
 // @title Shopping & Payment API
 // @version 1.0
 // @description This is a shopping and payment service API with gRPC and REST support
@@ -41,8 +47,12 @@ func main() {
 	// Load configuration
 	cfg := config.LoadConfig()
 
-	// Initialize JWT
-	middleware.InitJWT(cfg.JWTSecret)
+	// Load the JWT signing keys
+	signingKeys, err := middleware.LoadKeyDirectory(cfg.JWTKeyDir, cfg.JWTKeyAlgorithm)
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+	middleware.InitJWTIssuer(signingKeys)
 
 	// Connect to MongoDB
 	client, err := config.ConnectDB(cfg.MongoURI)
@@ -52,52 +62,259 @@ func main() {
 
 	// Setup repositories
 	productCollection := config.GetCollection(client, cfg.ShoppingDBName, "products")
+	orderCollection := config.GetCollection(client, cfg.ShoppingDBName, "orders")
+	userCollection := config.GetCollection(client, cfg.ShoppingDBName, "users")
+	refreshTokenCollection := config.GetCollection(client, cfg.ShoppingDBName, "refresh_tokens")
+	revocationCollection := config.GetCollection(client, cfg.ShoppingDBName, "token_revocations")
+	webhookCollection := config.GetCollection(client, cfg.ShoppingDBName, "webhooks")
+	webhookDeliveryCollection := config.GetCollection(client, cfg.ShoppingDBName, "webhook_deliveries")
+	jobCollection := config.GetCollection(client, cfg.ShoppingDBName, "jobs")
+	jobRunCollection := config.GetCollection(client, cfg.ShoppingDBName, "job_runs")
+	stockAdjustmentCollection := config.GetCollection(client, cfg.ShoppingDBName, "stock_adjustments")
+	// The audit log is shared with the payment server, which records the
+	// payment changes
+	auditCollection := config.GetCollection(client, cfg.ShoppingDBName, "audit_log")
 	paymentCollection := config.GetCollection(client, cfg.PaymentDBName, "payments")
+	paymentArchiveCollection := config.GetCollection(client, cfg.PaymentDBName, "payments_archive")
+
+	if err := repository.EnsureProductIndexes(context.Background(), productCollection); err != nil {
+		log.Fatalf("Failed to create product indexes: %v", err)
+	}
+	if err := repository.EnsureOrderIndexes(context.Background(), orderCollection); err != nil {
+		log.Fatalf("Failed to create order indexes: %v", err)
+	}
+	if err := repository.EnsureUserIndexes(context.Background(), userCollection); err != nil {
+		log.Fatalf("Failed to create user indexes: %v", err)
+	}
+	if err := repository.EnsureRefreshTokenIndexes(context.Background(), refreshTokenCollection); err != nil {
+		log.Fatalf("Failed to create refresh token indexes: %v", err)
+	}
+	if err := repository.EnsureRevocationIndexes(context.Background(), revocationCollection); err != nil {
+		log.Fatalf("Failed to create revocation indexes: %v", err)
+	}
+	if err := repository.EnsureJobRunIndexes(context.Background(), jobRunCollection); err != nil {
+		log.Fatalf("Failed to create job run indexes: %v", err)
+	}
+	if err := repository.EnsureStockAdjustmentIndexes(context.Background(), stockAdjustmentCollection); err != nil {
+		log.Fatalf("Failed to create stock adjustment indexes: %v", err)
+	}
+	if err := repository.EnsureAuditIndexes(context.Background(), auditCollection); err != nil {
+		log.Fatalf("Failed to create audit indexes: %v", err)
+	}
+
+	// Record every stock adjustment, in the same transaction as the change
+	// where MongoDB supports transactions
+	transactions, err := repository.SupportsTransactions(context.Background(), productCollection.Database())
+	if err != nil {
+		log.Fatalf("Failed to inspect MongoDB deployment: %v", err)
+	}
+	if !transactions {
+		log.Println("MongoDB has no transactions, stock adjustments are recorded right after they are made")
+	}
+	stockAdjustmentRepo := repository.NewStockAdjustmentRepository(stockAdjustmentCollection)
+	productRepo := repository.NewStockLedger(
+		repository.NewProductRepository(productCollection),
+		stockAdjustmentRepo,
+		repository.NewTransactor(client, transactions),
+	)
+
+	// Watch products through change streams where MongoDB supports them,
+	// otherwise through the changes made by this process
+	var productEvents repository.ProductEventSource
+	changeStreams, err := repository.SupportsChangeStreams(context.Background(), productCollection.Database())
+	if err != nil {
+		log.Fatalf("Failed to inspect MongoDB deployment: %v", err)
+	}
+	if changeStreams {
+		if err := repository.EnablePreImages(context.Background(), productCollection); err != nil {
+			log.Printf("Product deletion events will not carry the deleted product: %v", err)
+		}
+		productEvents = repository.NewProductChangeStream(productCollection)
+	} else {
+		log.Println("MongoDB has no change streams, only broadcasting product changes made by this server")
+		productRepo, productEvents = repository.NewProductBroadcaster(productRepo)
+	}
+	orderRepo := repository.NewOrderRepository(orderCollection)
+	userRepo := repository.NewUserRepository(userCollection)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(refreshTokenCollection)
+	revocationRepo := repository.NewRevocationRepository(revocationCollection)
+	webhookRepo := repository.NewWebhookRepository(webhookCollection)
+	webhookDeliveryRepo := repository.NewWebhookDeliveryRepository(webhookDeliveryCollection)
+	jobRepo := repository.NewJobRepository(jobCollection)
+	jobRunRepo := repository.NewJobRunRepository(jobRunCollection)
+	auditRepo := repository.NewAuditRepository(auditCollection)
 
-	productRepo := repository.NewProductRepository(productCollection)
-	paymentRepo := repository.NewPaymentRepository(paymentCollection)
+	// Reject revoked access tokens
+	revocationList := service.NewRevocationList(revocationRepo)
+	if err := revocationList.Sync(context.Background()); err != nil {
+		log.Fatalf("Failed to load token revocations: %v", err)
+	}
+	go revocationList.Start(context.Background())
+	middleware.InitRevocationList(revocationList)
+
+	// Connect to the payment gRPC server, forwarding the caller's JWT and
+	// the request ID
+	paymentConn, err := grpc.NewClient(
+		cfg.PaymentServiceBaseURI,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(middleware.UnaryClientInterceptor, middleware.UnaryRequestIDClientInterceptor),
+		grpc.WithChainStreamInterceptor(middleware.StreamClientInterceptor, middleware.StreamRequestIDClientInterceptor),
+	)
+	if err != nil {
+		log.Fatalf("Failed to create payment service client: %v", err)
+	}
+	defer paymentConn.Close()
 
 	// Setup services
-	productService := service.NewProductService(productRepo)
-	paymentService := service.NewPaymentService(paymentRepo)
+	// Payment changes are audited by the payment server
+	productService := service.NewAuditedProductService(service.NewProductService(productRepo, stockAdjustmentRepo, productEvents), auditRepo)
+	paymentService := service.NewPaymentGRPCService(pb.NewPaymentServiceClient(paymentConn))
+	orderService := service.NewOrderService(orderRepo, productRepo, paymentService)
+	authService := service.NewAuthService(userRepo, refreshTokenRepo)
+	revocationService := service.NewRevocationService(revocationRepo, refreshTokenRepo, revocationList)
+	webhookService := service.NewWebhookService(webhookRepo, webhookDeliveryRepo)
+	jobService := service.NewJobService(jobRepo, jobRunRepo)
+	auditService := service.NewAuditService(auditRepo)
+
+	// Settle orders as their payments are captured, fail or are cancelled.
+	// The settler reads every payment as an admin service account.
+	settlerContext := func(ctx context.Context) (context.Context, error) {
+		token, err := middleware.GenerateToken(orderSettlerUserID, []string{models.RoleAdmin})
+		if err != nil {
+			return nil, err
+		}
+		return middleware.ContextWithToken(ctx, token), nil
+	}
+	paymentSettler := service.NewPaymentSettler(orderService, paymentService, settlerContext)
+	go paymentSettler.Start(context.Background())
 
 	// Setup controllers
 	productController := controllers.NewProductController(productService)
 	paymentController := controllers.NewPaymentController(paymentService)
-	authController := controllers.NewAuthController()
+	orderController := controllers.NewOrderController(orderService)
+	authController := controllers.NewAuthController(authService)
+	jwksController := controllers.NewJWKSController(signingKeys)
+	revocationController := controllers.NewRevocationController(revocationService)
+	eventsController := controllers.NewEventsController(productService, paymentService)
+	webhookController := controllers.NewWebhookController(webhookService)
+	jobController := controllers.NewJobController(jobService)
+	auditController := controllers.NewAuditController(auditService)
 
-	// Setup and start cleanup scheduler (runs every 24 hours)
-	cleanupScheduler := scheduler.NewCleanupScheduler(paymentCollection, productCollection, 24*time.Hour)
-	go cleanupScheduler.Start(context.Background())
+	// Setup the cleanup job
+	if err := scheduler.EnsureArchiveIndexes(context.Background(), paymentArchiveCollection); err != nil {
+		log.Fatalf("Failed to create payment archive indexes: %v", err)
+	}
+	retentionPolicies := scheduler.PaymentRetentionPolicies(paymentCollection, paymentArchiveCollection, cfg.PaymentArchiveAfter, cfg.PaymentPurgeAfter)
+	retentionPolicies = append(retentionPolicies,
+		scheduler.PurgeDeletedPolicy("purge-deleted-products", productCollection, cfg.PurgeDeletedAfter),
+		scheduler.PurgeDeletedPolicy("purge-deleted-payments", paymentCollection, cfg.PurgeDeletedAfter),
+	)
+	cleanupScheduler := scheduler.NewCleanupScheduler(retentionPolicies, scheduler.CleanupOptions{
+		BatchSize: cfg.RetentionBatchSize,
+		DryRun:    cfg.RetentionDryRun,
+	})
+
+	// Run scheduled jobs on one replica at a time
+	jobScheduler := scheduler.NewJobScheduler(jobRepo, jobRunRepo)
+	if err := jobScheduler.Register(context.Background(), "cleanup", cfg.CleanupSchedule, cleanupScheduler.Run); err != nil {
+		log.Fatalf("Failed to register cleanup job: %v", err)
+	}
+	if err := jobScheduler.Register(context.Background(), "expire-reservations", cfg.ReservationExpirySchedule, scheduler.ExpireReservations(productRepo)); err != nil {
+		log.Fatalf("Failed to register reservation expiry job: %v", err)
+	}
+	if err := jobScheduler.Register(context.Background(), "settle-orders", cfg.OrderSettlementSchedule, scheduler.SettleOrders(orderService, settlerContext)); err != nil {
+		log.Fatalf("Failed to register order settlement job: %v", err)
+	}
+	go jobScheduler.Start(context.Background())
+
+	// Rotate the JWT signing keys. Every replica reloads the key directory
+	// itself, so this is not a shared job.
+	keyRotationScheduler := scheduler.NewKeyRotationScheduler(signingKeys, cfg.JWTKeyRotation)
+	go keyRotationScheduler.Start(context.Background())
 
 	// Setup Gin router
 	router := gin.Default()
+	// Tag every request with an ID, which the audit log records
+	router.Use(middleware.RequestIDMiddleware())
 
 	// Swagger endpoint
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	// Public keys for services that verify access tokens
+	router.GET("/.well-known/jwks.json", jwksController.GetJWKS)
+
 	// API routes
 	v1 := router.Group("/api/v1")
 	{
 		// Public routes
+		v1.POST("/register", authController.Register)
 		v1.POST("/login", authController.Login)
+		v1.POST("/refresh", authController.Refresh)
+		v1.POST("/logout", authController.Logout)
 
 		// Protected routes
 		protected := v1.Group("")
 		protected.Use(middleware.JWTMiddleware())
+		adminOnly := middleware.Authorize(middleware.RequireRole(models.RoleAdmin))
 		{
 			// Product routes
-			protected.POST("/products", productController.CreateProduct)
+			protected.POST("/products", adminOnly, productController.CreateProduct)
 			protected.GET("/products", productController.GetAllProducts)
 			protected.GET("/products/:id", productController.GetProductByID)
-			protected.PUT("/products/:id", productController.UpdateProduct)
-			protected.DELETE("/products/:id", productController.DeleteProduct)
+			protected.PUT("/products/:id", adminOnly, productController.UpdateProduct)
+			protected.PATCH("/products/:id", adminOnly, productController.PatchProduct)
+			protected.DELETE("/products/:id", adminOnly, productController.DeleteProduct)
+			protected.POST("/products/:id/restore", adminOnly, productController.RestoreProduct)
+			protected.POST("/products/:id/stock/adjustments", adminOnly, productController.AdjustStock)
+			protected.GET("/products/:id/stock/adjustments", adminOnly, productController.GetStockAdjustments)
 
 			// Payment routes
 			protected.POST("/payments", paymentController.CreatePayment)
 			protected.GET("/payments", paymentController.GetAllPayments)
 			protected.GET("/payments/:id", paymentController.GetPaymentByID)
 			protected.DELETE("/payments/:id", paymentController.DeletePayment)
+			protected.POST("/payments/:id/restore", adminOnly, paymentController.RestorePayment)
+			protected.POST("/payments/:id/authorize", adminOnly, paymentController.AuthorizePayment)
+			protected.POST("/payments/:id/capture", adminOnly, paymentController.CapturePayment)
+			protected.POST("/payments/:id/refunds", adminOnly, paymentController.CreateRefund)
+			protected.GET("/payments/:id/refunds", paymentController.GetRefunds)
+			protected.POST("/payments/:id/cancel", adminOnly, paymentController.CancelPayment)
+			protected.POST("/payments/:id/fail", adminOnly, paymentController.FailPayment)
+
+			// Order routes
+			protected.POST("/orders", orderController.CreateOrder)
+			protected.GET("/orders", orderController.GetAllOrders)
+			protected.GET("/orders/:id", orderController.GetOrderByID)
+			protected.DELETE("/orders/:id", orderController.DeleteOrder)
+			protected.POST("/orders/:id/checkout", orderController.Checkout)
+
+			// Live product and payment changes
+			protected.GET("/events", eventsController.StreamEvents)
+
+			// Token revocation routes
+			protected.POST("/revocations", adminOnly, revocationController.CreateRevocation)
+
+			// Webhook routes
+			protected.POST("/webhooks", adminOnly, webhookController.CreateWebhook)
+			protected.GET("/webhooks", adminOnly, webhookController.GetAllWebhooks)
+			protected.GET("/webhooks/:id", adminOnly, webhookController.GetWebhookByID)
+			protected.PUT("/webhooks/:id", adminOnly, webhookController.UpdateWebhook)
+			protected.DELETE("/webhooks/:id", adminOnly, webhookController.DeleteWebhook)
+			protected.GET("/webhooks/:id/deliveries", adminOnly, webhookController.GetDeliveries)
+			protected.POST("/webhooks/:id/deliveries/:delivery_id/retry", adminOnly, webhookController.RetryDelivery)
+
+			// Scheduled job routes
+			protected.GET("/admin/jobs", adminOnly, jobController.GetAllJobs)
+			protected.POST("/admin/jobs/:name/run", adminOnly, jobController.RunJob)
+			protected.POST("/admin/jobs/:name/pause", adminOnly, jobController.PauseJob)
+			protected.POST("/admin/jobs/:name/resume", adminOnly, jobController.ResumeJob)
+			protected.GET("/admin/jobs/:name/runs", adminOnly, jobController.GetJobRuns)
+
+			// Audit log routes
+			protected.GET("/admin/audit", adminOnly, auditController.GetAuditLog)
+
+			// User role routes
+			protected.PUT("/admin/users/:id/roles", adminOnly, authController.SetUserRoles)
 		}
 	}
 
@@ -0,0 +1,40 @@
+// Command migrate-legacy rewrites the payments and products stored before
+// amounts carried a currency and payments had a status, so that listings
+// filter, sort and page through them like any other document. It only needs to run once after
+// upgrading, but running it again is harmless.
+//
+// Usage:
+//
+//	migrate-legacy
+package main
+
+import (
+	"context"
+	"log"
+	"p3-graded-challenge-2-ziancarlos/config"
+	"p3-graded-challenge-2-ziancarlos/repository"
+)
+
+func main() {
+	// Load configuration
+	cfg := config.LoadConfig()
+
+	// Connect to MongoDB
+	client, err := config.ConnectDB(cfg.MongoURI)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	payments, err := repository.MigrateLegacyPayments(context.Background(), config.GetCollection(client, cfg.PaymentDBName, "payments"))
+	if err != nil {
+		log.Fatalf("Failed to migrate payments: %v", err)
+	}
+	log.Printf("Migrated %d legacy payments", payments)
+
+	products, err := repository.MigrateLegacyProducts(context.Background(), config.GetCollection(client, cfg.ShoppingDBName, "products"))
+	if err != nil {
+		log.Fatalf("Failed to migrate products: %v", err)
+	}
+	log.Printf("Migrated %d legacy products", products)
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"os"
 	"p3-graded-challenge-2-ziancarlos/config"
 	grpcServer "p3-graded-challenge-2-ziancarlos/grpc"
 	"p3-graded-challenge-2-ziancarlos/middleware"
@@ -12,6 +15,8 @@ import (
 	"p3-graded-challenge-2-ziancarlos/service"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 )
 
@@ -19,8 +24,8 @@ func main() {
 	// Load configuration
 	cfg := config.LoadConfig()
 
-	// Initialize JWT
-	middleware.InitJWT(cfg.JWTSecret)
+	// Verify JWTs with the public keys of the shopping service
+	middleware.InitJWT(middleware.NewJWKSClient(cfg.JWKSURL))
 
 	// Connect to MongoDB
 	client, err := config.ConnectDB(cfg.MongoURI)
@@ -30,14 +35,117 @@ func main() {
 
 	// Setup repositories
 	paymentCollection := config.GetCollection(client, cfg.PaymentDBName, "payments")
-	paymentRepo := repository.NewPaymentRepository(paymentCollection)
+	refundCollection := config.GetCollection(client, cfg.PaymentDBName, "refunds")
+	outboxCollection := config.GetCollection(client, cfg.PaymentDBName, "payment_outbox")
+	// Revocations are written by the shopping service, which issues tokens
+	revocationCollection := config.GetCollection(client, cfg.ShoppingDBName, "token_revocations")
+	// Webhooks are managed through the shopping service and delivered here
+	webhookCollection := config.GetCollection(client, cfg.ShoppingDBName, "webhooks")
+	webhookDeliveryCollection := config.GetCollection(client, cfg.ShoppingDBName, "webhook_deliveries")
+	// The audit log is queried through the shopping service
+	auditCollection := config.GetCollection(client, cfg.ShoppingDBName, "audit_log")
+	if err := repository.EnsurePaymentIndexes(context.Background(), paymentCollection); err != nil {
+		log.Fatalf("Failed to create payment indexes: %v", err)
+	}
+	if err := repository.EnsureOutboxIndexes(context.Background(), outboxCollection); err != nil {
+		log.Fatalf("Failed to create outbox indexes: %v", err)
+	}
+	if err := repository.EnsureWebhookDeliveryIndexes(context.Background(), webhookDeliveryCollection); err != nil {
+		log.Fatalf("Failed to create webhook delivery indexes: %v", err)
+	}
+
+	// Record every payment change in the outbox, and every refund in the
+	// refund ledger, in the same transaction as the change where MongoDB
+	// supports transactions
+	transactions, err := repository.SupportsTransactions(context.Background(), paymentCollection.Database())
+	if err != nil {
+		log.Fatalf("Failed to inspect MongoDB deployment: %v", err)
+	}
+	if !transactions {
+		log.Println("MongoDB has no transactions, payment changes are written to the outbox right after they are made")
+	}
+	transactor := repository.NewTransactor(client, transactions)
+	outboxRepo := repository.NewOutboxRepository(outboxCollection)
+	paymentRepo := repository.NewPaymentOutbox(
+		repository.NewPaymentRepository(paymentCollection),
+		outboxRepo,
+		transactor,
+	)
+
+	// Watch payments through change streams where MongoDB supports them,
+	// otherwise through the changes made by this process
+	var paymentEvents repository.PaymentEventSource
+	changeStreams, err := repository.SupportsChangeStreams(context.Background(), paymentCollection.Database())
+	if err != nil {
+		log.Fatalf("Failed to inspect MongoDB deployment: %v", err)
+	}
+	if changeStreams {
+		if err := repository.EnablePreImages(context.Background(), paymentCollection); err != nil {
+			log.Printf("Deletion events will only reach admins: %v", err)
+		}
+		paymentEvents = repository.NewPaymentChangeStream(paymentCollection)
+	} else {
+		log.Println("MongoDB has no change streams, only broadcasting payment changes made by this server")
+		paymentRepo, paymentEvents = repository.NewPaymentBroadcaster(paymentRepo)
+	}
+	refundRepo := repository.NewRefundRepository(refundCollection)
+	paymentRepo = repository.NewRefundLedger(paymentRepo, refundRepo, transactor)
+
+	// Reject revoked access tokens
+	revocationList := service.NewRevocationList(repository.NewRevocationRepository(revocationCollection))
+	if err := revocationList.Sync(context.Background()); err != nil {
+		log.Fatalf("Failed to load token revocations: %v", err)
+	}
+	go revocationList.Start(context.Background())
+	middleware.InitRevocationList(revocationList)
 
 	// Setup services
-	paymentService := service.NewPaymentService(paymentRepo)
+	// Record every payment change in the audit log
+	paymentService := service.NewAuditedPaymentService(
+		service.NewPaymentService(paymentRepo, refundRepo, paymentEvents),
+		repository.NewAuditRepository(auditCollection),
+	)
 
-	// Create gRPC server with JWT interceptor
+	// Publish the payment changes in the outbox to webhooks and the
+	// configured publishers
+	webhookRepo := repository.NewWebhookRepository(webhookCollection)
+	webhookDeliveryRepo := repository.NewWebhookDeliveryRepository(webhookDeliveryCollection)
+	publishers := []service.EventPublisher{service.NewWebhookPublisher(webhookRepo, webhookDeliveryRepo)}
+	for _, name := range cfg.EventPublishers {
+		switch name {
+		case "memory":
+			publishers = append(publishers, service.NewMemoryPublisher())
+		case "stdout":
+			publishers = append(publishers, service.NewStdoutPublisher(os.Stdout))
+		case "nats":
+			publishers = append(publishers, service.NewNATSPublisher(cfg.NATSURL, cfg.NATSSubjectPrefix))
+		default:
+			log.Fatalf("Unknown event publisher %q", name)
+		}
+	}
+	outboxRelay := service.NewOutboxRelay(outboxRepo, publishers...)
+	go outboxRelay.Start(context.Background())
+
+	webhookDispatcher := service.NewWebhookDispatcher(webhookRepo, webhookDeliveryRepo, &http.Client{})
+	go webhookDispatcher.Start(context.Background())
+
+	// Create gRPC server with JWT authentication and role authorization.
+	// Reflection, health checks and configured methods need no token.
+	publicMethods := append(middleware.PublicMethods{}, middleware.DefaultPublicMethods...)
+	publicMethods = append(publicMethods, cfg.GRPCPublicMethods...)
 	grpcServerInstance := grpc.NewServer(
-		grpc.UnaryInterceptor(middleware.UnaryInterceptor),
+		grpc.ChainUnaryInterceptor(
+			middleware.UnaryRequestIDInterceptor,
+			middleware.UnaryAuthInterceptor(publicMethods),
+			middleware.UnaryAuthorizeInterceptor(grpcServer.MethodPolicies),
+			grpcServer.UnaryCallerInterceptor,
+		),
+		grpc.ChainStreamInterceptor(
+			middleware.StreamRequestIDInterceptor,
+			middleware.StreamAuthInterceptor(publicMethods),
+			middleware.StreamAuthorizeInterceptor(grpcServer.MethodPolicies),
+			grpcServer.StreamCallerInterceptor,
+		),
 	)
 
 	// Register payment service
@@ -47,6 +155,11 @@ func main() {
 	// Enable reflection for gRPC tools like grpcurl
 	reflection.Register(grpcServerInstance)
 
+	// Report serving status for load balancers and orchestrators
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(pb.PaymentService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(grpcServerInstance, healthServer)
+
 	// Start listening
 	address := fmt.Sprintf(":%s", cfg.PortPayment)
 	listener, err := net.Listen("tcp", address)
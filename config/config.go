@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -12,21 +15,139 @@ type Config struct {
 	ShoppingDBName        string
 	PaymentDBName         string
 	PaymentServiceBaseURI string
-	JWTSecret             string
+	// JWTKeyDir holds the private keys that sign access tokens. Only the
+	// shopping service, which issues tokens, needs it.
+	JWTKeyDir string
+	// JWTKeyAlgorithm is EdDSA or RS256, the type of newly generated keys
+	JWTKeyAlgorithm string
+	// JWTKeyRotation is how often a new signing key is generated
+	JWTKeyRotation time.Duration
+	// JWKSURL is where services that only verify tokens fetch the public
+	// keys of the issuer
+	JWKSURL string
+	// GRPCPublicMethods lists gRPC methods callable without a token, in
+	// addition to middleware.DefaultPublicMethods
+	GRPCPublicMethods []string
+	// EventPublishers lists where the payment outbox is published besides
+	// webhooks: memory, stdout and/or nats
+	EventPublishers []string
+	// NATSURL is the server the nats event publisher publishes to
+	NATSURL string
+	// NATSSubjectPrefix prefixes the subjects of published payment events
+	NATSSubjectPrefix string
+	// CleanupSchedule is the cron expression on which retention policies
+	// are applied
+	CleanupSchedule string
+	// ReservationExpirySchedule is the cron expression on which expired
+	// stock reservations are released
+	ReservationExpirySchedule string
+	// OrderSettlementSchedule is the cron expression on which orders whose
+	// payment changed unnoticed are settled
+	OrderSettlementSchedule string
+	// PaymentArchiveAfter is how long cancelled payments stay unchanged
+	// before they are moved to the payment archive
+	PaymentArchiveAfter time.Duration
+	// PaymentPurgeAfter is how long archived payments are kept
+	PaymentPurgeAfter time.Duration
+	// PurgeDeletedAfter is how long deleted products and payments can be
+	// restored before they are purged
+	PurgeDeletedAfter time.Duration
+	// RetentionBatchSize is how many documents are removed at once
+	RetentionBatchSize int
+	// RetentionDryRun only logs what retention policies would remove
+	RetentionDryRun bool
 }
 
 func LoadConfig() *Config {
 	return &Config{
-		PortShopping:          getEnv("PORT_SHOPPING", "9051"),
-		PortPayment:           getEnv("PORT_PAYMENT", "9061"),
-		MongoURI:              getEnv("MONGO_URI", "mongodb://localhost:9071"),
-		ShoppingDBName:        getEnv("SHOPPING_DB_NAME", "shopping_db"),
-		PaymentDBName:         getEnv("PAYMENT_DB_NAME", "payment_db"),
-		PaymentServiceBaseURI: getEnv("PAYMENT_SERVICE_BASE_URI", "localhost:9061"),
-		JWTSecret:             getEnv("JWT_SECRET", "your-secret-key"),
+		PortShopping:              getEnv("PORT_SHOPPING", "9051"),
+		PortPayment:               getEnv("PORT_PAYMENT", "9061"),
+		MongoURI:                  getEnv("MONGO_URI", "mongodb://localhost:9071/?directConnection=true"),
+		ShoppingDBName:            getEnv("SHOPPING_DB_NAME", "shopping_db"),
+		PaymentDBName:             getEnv("PAYMENT_DB_NAME", "payment_db"),
+		PaymentServiceBaseURI:     getEnv("PAYMENT_SERVICE_BASE_URI", "localhost:9061"),
+		JWTKeyDir:                 getEnv("JWT_KEY_DIR", "keys"),
+		JWTKeyAlgorithm:           getEnv("JWT_KEY_ALGORITHM", "EdDSA"),
+		JWTKeyRotation:            getEnvDuration("JWT_KEY_ROTATION", 24*time.Hour),
+		JWKSURL:                   getEnv("JWKS_URL", "http://localhost:9051/.well-known/jwks.json"),
+		GRPCPublicMethods:         getEnvList("GRPC_PUBLIC_METHODS"),
+		EventPublishers:           getEnvList("EVENT_PUBLISHERS"),
+		NATSURL:                   getEnv("NATS_URL", "nats://localhost:4222"),
+		NATSSubjectPrefix:         getEnv("NATS_SUBJECT_PREFIX", "payments"),
+		CleanupSchedule:           getEnv("CLEANUP_SCHEDULE", "0 3 * * *"),
+		ReservationExpirySchedule: getEnv("RESERVATION_EXPIRY_SCHEDULE", "@every 1m"),
+		OrderSettlementSchedule:   getEnv("ORDER_SETTLEMENT_SCHEDULE", "@every 5m"),
+		PaymentArchiveAfter:       getEnvDuration("PAYMENT_ARCHIVE_AFTER", 30*24*time.Hour),
+		PaymentPurgeAfter:         getEnvDuration("PAYMENT_PURGE_AFTER", 365*24*time.Hour),
+		PurgeDeletedAfter:         getEnvDuration("PURGE_DELETED_AFTER", 30*24*time.Hour),
+		RetentionBatchSize:        getEnvInt("RETENTION_BATCH_SIZE", 500),
+		RetentionDryRun:           getEnvBool("RETENTION_DRY_RUN", false),
 	}
 }
 
+// getEnvList reads a comma separated list, which is empty if key is not set.
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvDuration reads a duration such as "24h" or a number of days such as
+// "30d", falling back to defaultValue if key is not set or invalid.
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		log.Printf("Environment variable %s not set, using default: %s", key, defaultValue)
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if days, found := strings.CutSuffix(value, "d"); found {
+		var n int
+		n, err = strconv.Atoi(days)
+		duration = time.Duration(n) * 24 * time.Hour
+	}
+	if err != nil || duration <= 0 {
+		log.Printf("Environment variable %s is not a valid duration, using default: %s", key, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
+
+// getEnvInt reads a positive integer, falling back to defaultValue if key is
+// not set or invalid.
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		log.Printf("Environment variable %s not set, using default: %d", key, defaultValue)
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Environment variable %s is not a positive integer, using default: %d", key, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// getEnvBool reads a boolean such as "true" or "1", falling back to
+// defaultValue if key is not set or invalid.
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Environment variable %s is not a boolean, using default: %v", key, defaultValue)
+		return defaultValue
+	}
+	return b
+}
+
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -35,4 +156,3 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
-
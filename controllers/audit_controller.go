@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"net/http"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditController struct {
+	service service.AuditService
+}
+
+func NewAuditController(service service.AuditService) *AuditController {
+	return &AuditController{
+		service: service,
+	}
+}
+
+// GetAuditLog godoc
+// @Summary Get the audit log
+// @Description Get a page of the recorded product and payment changes, newest first, with who made them, in which request, and the resource before and after. Changes made over REST and gRPC are both recorded.
+// @Tags audit
+// @Produce json
+// @Param page_size query int false "Maximum number of entries to return (default 20, max 100)"
+// @Param page_token query string false "next_page_token of the previous page"
+// @Param sort query string false "created_at, prefixed with - for descending order (default -created_at)"
+// @Param actor query string false "User ID of the caller"
+// @Param action query string false "create, update, delete, restore, adjust_stock, authorize, capture, refund, cancel or fail"
+// @Param resource_type query string false "product or payment"
+// @Param resource_id query string false "Product or payment ID"
+// @Param request_id query string false "X-Request-ID of the request"
+// @Param created_after query string false "RFC 3339 time, inclusive"
+// @Param created_before query string false "RFC 3339 time, exclusive"
+// @Success 200 {object} models.AuditListResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security BearerAuth
+// @Router /admin/audit [get]
+func (c *AuditController) GetAuditLog(ctx *gin.Context) {
+	var req models.AuditListRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, err := c.service.GetAuditLog(requestContext(ctx), &req)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, entries)
+}
@@ -3,47 +3,175 @@ package controllers
 import (
 	"net/http"
 	"p3-graded-challenge-2-ziancarlos/middleware"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/service"
 
 	"github.com/gin-gonic/gin"
 )
 
-type AuthController struct{}
-
-func NewAuthController() *AuthController {
-	return &AuthController{}
+type AuthController struct {
+	service service.AuthService
 }
 
-type LoginRequest struct {
-	UserID string `json:"user_id" binding:"required"`
+func NewAuthController(service service.AuthService) *AuthController {
+	return &AuthController{
+		service: service,
+	}
 }
 
-type LoginResponse struct {
-	Token string `json:"token"`
+// Register godoc
+// @Summary Register a user
+// @Description Create a user account with an email and a password of at least 8 characters
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param user body models.RegisterRequest true "Register Request"
+// @Success 201 {object} models.UserResponse
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /register [post]
+func (c *AuthController) Register(ctx *gin.Context) {
+	var req models.RegisterRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := c.service.Register(ctx.Request.Context(), &req)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, user)
 }
 
 // Login godoc
-// @Summary Login and get JWT token
-// @Description Login with user ID to get JWT token
+// @Summary Login and get tokens
+// @Description Login with email and password to get a short-lived access token and a refresh token
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param login body LoginRequest true "Login Request"
-// @Success 200 {object} LoginResponse
+// @Param login body models.LoginRequest true "Login Request"
+// @Success 200 {object} models.TokenResponse
 // @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /login [post]
 func (c *AuthController) Login(ctx *gin.Context) {
-	var req LoginRequest
+	var req models.LoginRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := c.service.Login(ctx.Request.Context(), &req)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	c.respondTokens(ctx, session)
+}
+
+// Refresh godoc
+// @Summary Refresh tokens
+// @Description Exchange a refresh token for a new access token and refresh token. The old refresh token stops working.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param refresh body models.RefreshRequest true "Refresh Request"
+// @Success 200 {object} models.TokenResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /refresh [post]
+func (c *AuthController) Refresh(ctx *gin.Context) {
+	var req models.RefreshRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := c.service.Refresh(ctx.Request.Context(), req.RefreshToken)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	c.respondTokens(ctx, session)
+}
+
+// Logout godoc
+// @Summary Logout
+// @Description Revoke the refresh token and every token rotated from the same login
+// @Tags auth
+// @Accept json
+// @Param logout body models.RefreshRequest true "Logout Request"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /logout [post]
+func (c *AuthController) Logout(ctx *gin.Context) {
+	var req models.RefreshRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.service.Logout(ctx.Request.Context(), req.RefreshToken); err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// SetUserRoles godoc
+// @Summary Set the roles of a user
+// @Description Replace the roles of a user to grant or take away the admin role. Every user keeps the customer role, and admins cannot take the admin role away from themselves. The user's access tokens carry the new roles from their next refresh.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param roles body models.UserRolesRequest true "User Roles Request"
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /admin/users/{id}/roles [put]
+func (c *AuthController) SetUserRoles(ctx *gin.Context) {
+	var req models.UserRolesRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	token, err := middleware.GenerateToken(req.UserID)
+	user, err := c.service.SetRoles(requestContext(ctx), ctx.Param("id"), &req)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, user)
+}
+
+func (c *AuthController) respondTokens(ctx *gin.Context, session *models.Session) {
+	token, err := middleware.GenerateToken(session.UserID, session.Roles)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, LoginResponse{Token: token})
+	ctx.JSON(http.StatusOK, models.TokenResponse{
+		AccessToken:  token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(middleware.AccessTokenTTL.Seconds()),
+		RefreshToken: session.RefreshToken,
+	})
 }
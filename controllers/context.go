@@ -0,0 +1,23 @@
+package controllers
+
+import (
+	"context"
+	"p3-graded-challenge-2-ziancarlos/middleware"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestContext returns the request context with the caller authenticated
+// by JWTMiddleware attached, so services can scope results to that caller.
+func requestContext(ctx *gin.Context) context.Context {
+	reqCtx := ctx.Request.Context()
+	if claims, ok := middleware.ClaimsFromContext(reqCtx); ok {
+		reqCtx = service.ContextWithCaller(reqCtx, models.Caller{
+			UserID: claims.UserID,
+			Roles:  claims.Roles,
+		})
+	}
+	return reqCtx
+}
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"p3-graded-challenge-2-ziancarlos/service"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcToHTTPStatus maps gRPC status codes returned by remote services to the
+// equivalent HTTP status codes.
+var grpcToHTTPStatus = map[codes.Code]int{
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.Aborted:            http.StatusConflict,
+	codes.FailedPrecondition: http.StatusConflict,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.Canceled:           499,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+}
+
+// respondError writes err as a JSON error body, choosing the HTTP status from
+// the gRPC status code or the service error it carries.
+func respondError(ctx *gin.Context, err error) {
+	if st, ok := status.FromError(err); ok {
+		code, found := grpcToHTTPStatus[st.Code()]
+		if !found {
+			code = http.StatusInternalServerError
+		}
+		ctx.JSON(code, gin.H{"error": st.Message()})
+		return
+	}
+
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrInvalidArgument):
+		code = http.StatusBadRequest
+	case errors.Is(err, service.ErrUnauthenticated):
+		code = http.StatusUnauthorized
+	case errors.Is(err, service.ErrNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, service.ErrFailedPrecondition), errors.Is(err, service.ErrAlreadyExists):
+		code = http.StatusConflict
+	case errors.Is(err, service.ErrVersionMismatch):
+		code = http.StatusPreconditionFailed
+	}
+	ctx.JSON(code, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// versionETag returns the entity tag of a version of a resource.
+func versionETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// parseIfMatch returns the version in an If-Match header holding a single
+// entity tag made by versionETag.
+func parseIfMatch(header string) (int64, error) {
+	tag := strings.TrimSpace(header)
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, errors.New("If-Match must be the ETag of the resource")
+	}
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil || version < 0 {
+		return 0, errors.New("If-Match must be the ETag of the resource")
+	}
+	return version, nil
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"net/http"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JobController struct {
+	service service.JobService
+}
+
+func NewJobController(service service.JobService) *JobController {
+	return &JobController{
+		service: service,
+	}
+}
+
+// GetAllJobs godoc
+// @Summary Get scheduled jobs
+// @Description Get every scheduled job with its schedule, next run, last run and the replica running it, if any
+// @Tags jobs
+// @Produce json
+// @Success 200 {array} models.JobResponse
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /admin/jobs [get]
+func (c *JobController) GetAllJobs(ctx *gin.Context) {
+	jobs, err := c.service.GetAllJobs(requestContext(ctx))
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, jobs)
+}
+
+// RunJob godoc
+// @Summary Run a job now
+// @Description Ask for a run of a job, even if it is paused. One of the replicas starts it within seconds, or right after the run in progress. Follow it in the job runs.
+// @Tags jobs
+// @Produce json
+// @Param name path string true "Job name"
+// @Success 202 {object} models.JobResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /admin/jobs/{name}/run [post]
+func (c *JobController) RunJob(ctx *gin.Context) {
+	job, err := c.service.RunJob(requestContext(ctx), ctx.Param("name"))
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, job)
+}
+
+// PauseJob godoc
+// @Summary Pause a job
+// @Description Stop the scheduled runs of a job. A run in progress finishes, and runs can still be requested.
+// @Tags jobs
+// @Produce json
+// @Param name path string true "Job name"
+// @Success 200 {object} models.JobResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /admin/jobs/{name}/pause [post]
+func (c *JobController) PauseJob(ctx *gin.Context) {
+	job, err := c.service.PauseJob(requestContext(ctx), ctx.Param("name"))
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, job)
+}
+
+// ResumeJob godoc
+// @Summary Resume a job
+// @Description Restart the scheduled runs of a paused job. A run that was due while it was paused happens right away.
+// @Tags jobs
+// @Produce json
+// @Param name path string true "Job name"
+// @Success 200 {object} models.JobResponse
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /admin/jobs/{name}/resume [post]
+func (c *JobController) ResumeJob(ctx *gin.Context) {
+	job, err := c.service.ResumeJob(requestContext(ctx), ctx.Param("name"))
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, job)
+}
+
+// GetJobRuns godoc
+// @Summary Get job runs
+// @Description Get a page of the runs of a job, newest first, with their outcome and counts. The counts of the cleanup job are its retention metrics: documents matched, archived and deleted in total and per policy, e.g. archive-cancelled-payments.deleted, and dry_run when nothing was removed. Runs are kept for 90 days.
+// @Tags jobs
+// @Produce json
+// @Param name path string true "Job name"
+// @Param page_size query int false "Maximum number of runs to return (default 20, max 100)"
+// @Param page_token query string false "next_page_token of the previous page"
+// @Param sort query string false "started_at, prefixed with - for descending order (default -started_at)"
+// @Success 200 {object} models.JobRunListResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /admin/jobs/{name}/runs [get]
+func (c *JobController) GetJobRuns(ctx *gin.Context) {
+	var req models.ListRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	runs, err := c.service.GetJobRuns(requestContext(ctx), ctx.Param("name"), &req)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, runs)
+}
@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"net/http"
+	"p3-graded-challenge-2-ziancarlos/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSController struct {
+	keys *middleware.KeyDirectory
+}
+
+func NewJWKSController(keys *middleware.KeyDirectory) *JWKSController {
+	return &JWKSController{
+		keys: keys,
+	}
+}
+
+// GetJWKS serves the public keys that verify access tokens as a JSON Web
+// Key Set. It is mounted at /.well-known/jwks.json, outside the API base path.
+func (c *JWKSController) GetJWKS(ctx *gin.Context) {
+	// Let verifiers cache the set, but not past the point new keys activate
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, middleware.NewJSONWebKeySet(c.keys.VerificationKeys()))
+}
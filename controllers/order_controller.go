@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"net/http"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OrderController struct {
+	service service.OrderService
+}
+
+func NewOrderController(service service.OrderService) *OrderController {
+	return &OrderController{
+		service: service,
+	}
+}
+
+// CreateOrder godoc
+// @Summary Create a new order
+// @Description Create a new order from product IDs and quantities, snapshotting current prices
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param order body models.OrderRequest true "Order Request"
+// @Success 201 {object} models.OrderResponse
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /orders [post]
+func (c *OrderController) CreateOrder(ctx *gin.Context) {
+	var req models.OrderRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := c.service.CreateOrder(requestContext(ctx), &req)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, order)
+}
+
+// GetAllOrders godoc
+// @Summary Get all orders
+// @Description Get the orders of the caller. Admins get every order.
+// @Tags orders
+// @Produce json
+// @Success 200 {array} models.OrderResponse
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /orders [get]
+func (c *OrderController) GetAllOrders(ctx *gin.Context) {
+	orders, err := c.service.GetAllOrders(requestContext(ctx))
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, orders)
+}
+
+// GetOrderByID godoc
+// @Summary Get order by ID
+// @Description Get an order by its ID. Orders of other users are not found unless the caller is an admin.
+// @Tags orders
+// @Produce json
+// @Param id path string true "Order ID"
+// @Success 200 {object} models.OrderResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /orders/{id} [get]
+func (c *OrderController) GetOrderByID(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	order, err := c.service.GetOrderByID(requestContext(ctx), id)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, order)
+}
+
+// DeleteOrder godoc
+// @Summary Delete order by ID
+// @Description Delete a pending order of the caller by its ID
+// @Tags orders
+// @Produce json
+// @Param id path string true "Order ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /orders/{id} [delete]
+func (c *OrderController) DeleteOrder(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	err := c.service.DeleteOrder(requestContext(ctx), id)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Order deleted successfully"})
+}
+
+// Checkout godoc
+// @Summary Check out an order
+// @Description Price an order of the caller with current product prices and create its payment. The order awaits the payment, and is paid once the payment is captured or cancelled if it fails or is cancelled.
+// @Tags orders
+// @Produce json
+// @Param id path string true "Order ID"
+// @Success 200 {object} models.OrderResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /orders/{id}/checkout [post]
+func (c *OrderController) Checkout(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	order, err := c.service.Checkout(requestContext(ctx), id)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, order)
+}
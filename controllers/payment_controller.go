@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"p3-graded-challenge-2-ziancarlos/models"
 	"p3-graded-challenge-2-ziancarlos/service"
@@ -20,13 +22,15 @@ func NewPaymentController(service service.PaymentService) *PaymentController {
 
 // CreatePayment godoc
 // @Summary Create a new payment
-// @Description Create a new payment with the provided amount
+// @Description Create a new payment with the provided amount. Retries that send the same Idempotency-Key return the original payment.
 // @Tags payments
 // @Accept json
 // @Produce json
 // @Param payment body models.PaymentRequest true "Payment Request"
+// @Param Idempotency-Key header string false "Idempotency key"
 // @Success 201 {object} models.PaymentResponse
 // @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Security BearerAuth
 // @Router /payments [post]
@@ -36,10 +40,11 @@ func (c *PaymentController) CreatePayment(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	req.IdempotencyKey = ctx.GetHeader("Idempotency-Key")
 
-	payment, err := c.service.CreatePayment(ctx.Request.Context(), &req)
+	payment, err := c.service.CreatePayment(requestContext(ctx), &req)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(ctx, err)
 		return
 	}
 
@@ -48,17 +53,35 @@ func (c *PaymentController) CreatePayment(ctx *gin.Context) {
 
 // GetAllPayments godoc
 // @Summary Get all payments
-// @Description Get a list of all payments
+// @Description Get a page of the caller's payments, optionally filtered by status, amount range and creation time. Admins see every payment.
 // @Tags payments
 // @Produce json
-// @Success 200 {array} models.PaymentResponse
+// @Param page_size query int false "Maximum number of payments to return (default 20, max 100)"
+// @Param page_token query string false "next_page_token of the previous page"
+// @Param sort query string false "created_at, amount or status, prefixed with - for descending order"
+// @Param status query string false "Payment status"
+// @Param min_amount query string false "Minimum amount, inclusive"
+// @Param max_amount query string false "Maximum amount, inclusive"
+// @Param currency query string false "Currency of the amount range (default USD)"
+// @Param created_after query string false "RFC 3339 time, inclusive"
+// @Param created_before query string false "RFC 3339 time, exclusive"
+// @Param owner_id query string false "Owner user ID, admins only"
+// @Param include_deleted query bool false "Also list deleted payments, admins only"
+// @Success 200 {object} models.PaymentListResponse
+// @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Security BearerAuth
 // @Router /payments [get]
 func (c *PaymentController) GetAllPayments(ctx *gin.Context) {
-	payments, err := c.service.GetAllPayments(ctx.Request.Context())
+	var req models.PaymentListRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	payments, err := c.service.GetAllPayments(requestContext(ctx), &req)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(ctx, err)
 		return
 	}
 
@@ -67,7 +90,7 @@ func (c *PaymentController) GetAllPayments(ctx *gin.Context) {
 
 // GetPaymentByID godoc
 // @Summary Get payment by ID
-// @Description Get a payment by its ID
+// @Description Get a payment owned by the caller by its ID
 // @Tags payments
 // @Produce json
 // @Param id path string true "Payment ID"
@@ -79,9 +102,9 @@ func (c *PaymentController) GetAllPayments(ctx *gin.Context) {
 func (c *PaymentController) GetPaymentByID(ctx *gin.Context) {
 	id := ctx.Param("id")
 
-	payment, err := c.service.GetPaymentByID(ctx.Request.Context(), id)
+	payment, err := c.service.GetPaymentByID(requestContext(ctx), id)
 	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondError(ctx, err)
 		return
 	}
 
@@ -90,23 +113,204 @@ func (c *PaymentController) GetPaymentByID(ctx *gin.Context) {
 
 // DeletePayment godoc
 // @Summary Delete payment by ID
-// @Description Delete a payment by its ID
+// @Description Delete a pending payment owned by the caller by its ID. An admin can restore it until it is purged, 30 days later by default. Payments past pending are kept for accounting; cancel them instead.
 // @Tags payments
 // @Produce json
 // @Param id path string true "Payment ID"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Security BearerAuth
 // @Router /payments/{id} [delete]
 func (c *PaymentController) DeletePayment(ctx *gin.Context) {
 	id := ctx.Param("id")
 
-	err := c.service.DeletePayment(ctx.Request.Context(), id)
+	err := c.service.DeletePayment(requestContext(ctx), id)
 	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondError(ctx, err)
 		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{"message": "Payment deleted successfully"})
 }
+
+// RestorePayment godoc
+// @Summary Restore a deleted payment
+// @Description Undelete a payment that has not been purged yet
+// @Tags payments
+// @Produce json
+// @Param id path string true "Payment ID"
+// @Success 200 {object} models.PaymentResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /payments/{id}/restore [post]
+func (c *PaymentController) RestorePayment(ctx *gin.Context) {
+	payment, err := c.service.RestorePayment(requestContext(ctx), ctx.Param("id"))
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, payment)
+}
+
+// AuthorizePayment godoc
+// @Summary Authorize payment
+// @Description Authorize a pending payment
+// @Tags payments
+// @Produce json
+// @Param id path string true "Payment ID"
+// @Success 200 {object} models.PaymentResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security BearerAuth
+// @Router /payments/{id}/authorize [post]
+func (c *PaymentController) AuthorizePayment(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	payment, err := c.service.AuthorizePayment(requestContext(ctx), id)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, payment)
+}
+
+// CapturePayment godoc
+// @Summary Capture payment
+// @Description Capture an authorized payment
+// @Tags payments
+// @Produce json
+// @Param id path string true "Payment ID"
+// @Success 200 {object} models.PaymentResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security BearerAuth
+// @Router /payments/{id}/capture [post]
+func (c *PaymentController) CapturePayment(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	payment, err := c.service.CapturePayment(requestContext(ctx), id)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, payment)
+}
+
+// CreateRefund godoc
+// @Summary Create a refund
+// @Description Refund part of a captured payment; refunds can never exceed the payment amount. Without an amount, or without a body, whatever is left of the payment is refunded.
+// @Tags payments
+// @Accept json
+// @Produce json
+// @Param id path string true "Payment ID"
+// @Param refund body models.RefundRequest false "Refund Request"
+// @Success 201 {object} models.PaymentResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security BearerAuth
+// @Router /payments/{id}/refunds [post]
+func (c *PaymentController) CreateRefund(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	var req models.RefundRequest
+	// An empty body refunds the whole remaining amount
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	payment, err := c.service.RefundPayment(requestContext(ctx), id, &req)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, payment)
+}
+
+// GetRefunds godoc
+// @Summary List refunds of a payment
+// @Description Get the refund ledger of a payment
+// @Tags payments
+// @Produce json
+// @Param id path string true "Payment ID"
+// @Success 200 {array} models.RefundResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /payments/{id}/refunds [get]
+func (c *PaymentController) GetRefunds(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	refunds, err := c.service.GetRefunds(requestContext(ctx), id)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, refunds)
+}
+
+// CancelPayment godoc
+// @Summary Cancel payment
+// @Description Cancel a pending or authorized payment
+// @Tags payments
+// @Produce json
+// @Param id path string true "Payment ID"
+// @Success 200 {object} models.PaymentResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security BearerAuth
+// @Router /payments/{id}/cancel [post]
+func (c *PaymentController) CancelPayment(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	payment, err := c.service.CancelPayment(requestContext(ctx), id)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, payment)
+}
+
+// FailPayment godoc
+// @Summary Fail payment
+// @Description Mark a pending or authorized payment as failed
+// @Tags payments
+// @Produce json
+// @Param id path string true "Payment ID"
+// @Success 200 {object} models.PaymentResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security BearerAuth
+// @Router /payments/{id}/fail [post]
+func (c *PaymentController) FailPayment(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	payment, err := c.service.FailPayment(requestContext(ctx), id)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, payment)
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/service"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockPaymentService is a mock implementation of the PaymentService calls
+// these tests make
+type MockPaymentService struct {
+	mock.Mock
+	service.PaymentService
+}
+
+func (m *MockPaymentService) RefundPayment(ctx context.Context, id string, req *models.RefundRequest) (*models.PaymentResponse, error) {
+	args := m.Called(ctx, id, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PaymentResponse), args.Error(1)
+}
+
+func TestCreateRefund_WithoutAmountRefundsWhatIsLeft(t *testing.T) {
+	tests := map[string]io.Reader{
+		"no body":        nil,
+		"empty object":   strings.NewReader(`{}`),
+		"only a reason":  strings.NewReader(`{"reason": "order cancelled"}`),
+		"partial amount": strings.NewReader(`{"amount": "5.00"}`),
+	}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockService := new(MockPaymentService)
+			controller := NewPaymentController(mockService)
+			router := gin.New()
+			router.POST("/payments/:id/refunds", controller.CreateRefund)
+
+			payment := &models.PaymentResponse{ID: "payment-1", Status: models.PaymentStatusRefunded}
+			var got *models.RefundRequest
+			mockService.On("RefundPayment", mock.Anything, "payment-1", mock.Anything).Run(func(args mock.Arguments) {
+				got = args.Get(2).(*models.RefundRequest)
+			}).Return(payment, nil)
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/payments/payment-1/refunds", body)
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, http.StatusCreated, recorder.Code)
+			if name == "partial amount" {
+				assert.Equal(t, models.Decimal("5.00"), got.Amount)
+			} else {
+				assert.Empty(t, got.Amount)
+			}
+		})
+	}
+}
+
+func TestCreateRefund_InvalidBodyIsBadRequest(t *testing.T) {
+	mockService := new(MockPaymentService)
+	controller := NewPaymentController(mockService)
+	router := gin.New()
+	router.POST("/payments/:id/refunds", controller.CreateRefund)
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/payments/payment-1/refunds", strings.NewReader(`{"amount":`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	mockService.AssertNotCalled(t, "RefundPayment", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -8,6 +8,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// mergePatchContentType is the media type of JSON Merge Patch documents.
+const mergePatchContentType = "application/merge-patch+json"
+
 type ProductController struct {
 	service service.ProductService
 }
@@ -26,8 +29,10 @@ func NewProductController(service service.ProductService) *ProductController {
 // @Produce json
 // @Param product body models.ProductRequest true "Product Request"
 // @Success 201 {object} models.ProductResponse
+// @Header 201 {string} ETag "Version of the product, to send in If-Match when updating it"
 // @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Security BearerAuth
 // @Router /products [post]
 func (c *ProductController) CreateProduct(ctx *gin.Context) {
@@ -37,28 +42,46 @@ func (c *ProductController) CreateProduct(ctx *gin.Context) {
 		return
 	}
 
-	product, err := c.service.CreateProduct(ctx.Request.Context(), &req)
+	product, err := c.service.CreateProduct(requestContext(ctx), &req)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(ctx, err)
 		return
 	}
 
+	ctx.Header("ETag", versionETag(product.Version))
 	ctx.JSON(http.StatusCreated, product)
 }
 
 // GetAllProducts godoc
 // @Summary Get all products
-// @Description Get a list of all products
+// @Description Get a page of products, optionally filtered by name prefix, price range and creation time
 // @Tags products
 // @Produce json
-// @Success 200 {array} models.ProductResponse
+// @Param page_size query int false "Maximum number of products to return (default 20, max 100)"
+// @Param page_token query string false "next_page_token of the previous page"
+// @Param sort query string false "created_at, name or price, prefixed with - for descending order"
+// @Param name_prefix query string false "Case-sensitive prefix of the product name"
+// @Param min_price query string false "Minimum price, inclusive"
+// @Param max_price query string false "Maximum price, inclusive"
+// @Param currency query string false "Currency of the price range (default USD)"
+// @Param created_after query string false "RFC 3339 time, inclusive"
+// @Param created_before query string false "RFC 3339 time, exclusive"
+// @Param include_deleted query bool false "Also list deleted products, admins only"
+// @Success 200 {object} models.ProductListResponse
+// @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Security BearerAuth
 // @Router /products [get]
 func (c *ProductController) GetAllProducts(ctx *gin.Context) {
-	products, err := c.service.GetAllProducts(ctx.Request.Context())
+	var req models.ProductListRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	products, err := c.service.GetAllProducts(requestContext(ctx), &req)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(ctx, err)
 		return
 	}
 
@@ -67,11 +90,12 @@ func (c *ProductController) GetAllProducts(ctx *gin.Context) {
 
 // GetProductByID godoc
 // @Summary Get product by ID
-// @Description Get a product by its ID
+// @Description Get a product by its ID. Its ETag is the version to send in If-Match when updating it.
 // @Tags products
 // @Produce json
 // @Param id path string true "Product ID"
 // @Success 200 {object} models.ProductResponse
+// @Header 200 {string} ETag "Version of the product"
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Security BearerAuth
@@ -79,66 +103,221 @@ func (c *ProductController) GetAllProducts(ctx *gin.Context) {
 func (c *ProductController) GetProductByID(ctx *gin.Context) {
 	id := ctx.Param("id")
 
-	product, err := c.service.GetProductByID(ctx.Request.Context(), id)
+	product, err := c.service.GetProductByID(requestContext(ctx), id)
 	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondError(ctx, err)
 		return
 	}
 
+	ctx.Header("ETag", versionETag(product.Version))
 	ctx.JSON(http.StatusOK, product)
 }
 
 // UpdateProduct godoc
 // @Summary Update product by ID
-// @Description Update a product by its ID
+// @Description Update a product by its ID. If-Match must hold the ETag of the product as it was read, so that concurrent edits cannot overwrite each other.
 // @Tags products
 // @Accept json
 // @Produce json
 // @Param id path string true "Product ID"
+// @Param If-Match header string true "ETag of the product being updated"
 // @Param product body models.ProductRequest true "Product Request"
 // @Success 200 {object} models.ProductResponse
+// @Header 200 {string} ETag "New version of the product"
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Failure 428 {object} map[string]string
 // @Security BearerAuth
 // @Router /products/{id} [put]
 func (c *ProductController) UpdateProduct(ctx *gin.Context) {
 	id := ctx.Param("id")
 
+	ifMatch := ctx.GetHeader("If-Match")
+	if ifMatch == "" {
+		ctx.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header with the ETag of the product is required"})
+		return
+	}
+	version, err := parseIfMatch(ifMatch)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	var req models.ProductRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	product, err := c.service.UpdateProduct(ctx.Request.Context(), id, &req)
+	product, err := c.service.UpdateProduct(requestContext(ctx), id, version, &req)
 	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondError(ctx, err)
 		return
 	}
 
+	ctx.Header("ETag", versionETag(product.Version))
+	ctx.JSON(http.StatusOK, product)
+}
+
+// PatchProduct godoc
+// @Summary Patch product by ID
+// @Description Change only the fields of a product given in a JSON Merge Patch (RFC 7396), validated like a new product. A price without a currency keeps the current currency. With If-Match, the patch only applies to that version of the product.
+// @Tags products
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path string true "Product ID"
+// @Param If-Match header string false "ETag of the product being patched"
+// @Param patch body models.ProductPatch true "Merge patch"
+// @Success 200 {object} models.ProductResponse
+// @Header 200 {string} ETag "New version of the product"
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Failure 415 {object} map[string]string
+// @Security BearerAuth
+// @Router /products/{id} [patch]
+func (c *ProductController) PatchProduct(ctx *gin.Context) {
+	if ctx.ContentType() != mergePatchContentType {
+		ctx.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be " + mergePatchContentType})
+		return
+	}
+
+	var version *int64
+	if ifMatch := ctx.GetHeader("If-Match"); ifMatch != "" {
+		expected, err := parseIfMatch(ifMatch)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		version = &expected
+	}
+
+	var patch models.ProductPatch
+	if err := ctx.ShouldBindJSON(&patch); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, err := c.service.PatchProduct(requestContext(ctx), ctx.Param("id"), version, &patch)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.Header("ETag", versionETag(product.Version))
 	ctx.JSON(http.StatusOK, product)
 }
 
 // DeleteProduct godoc
 // @Summary Delete product by ID
-// @Description Delete a product by its ID
+// @Description Delete a product by its ID. It can be restored until it is purged, 30 days later by default.
 // @Tags products
 // @Produce json
 // @Param id path string true "Product ID"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Security BearerAuth
 // @Router /products/{id} [delete]
 func (c *ProductController) DeleteProduct(ctx *gin.Context) {
 	id := ctx.Param("id")
 
-	err := c.service.DeleteProduct(ctx.Request.Context(), id)
+	err := c.service.DeleteProduct(requestContext(ctx), id)
 	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondError(ctx, err)
 		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
 }
 
+// RestoreProduct godoc
+// @Summary Restore a deleted product
+// @Description Undelete a product that has not been purged yet
+// @Tags products
+// @Produce json
+// @Param id path string true "Product ID"
+// @Success 200 {object} models.ProductResponse
+// @Header 200 {string} ETag "Version of the product"
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /products/{id}/restore [post]
+func (c *ProductController) RestoreProduct(ctx *gin.Context) {
+	product, err := c.service.RestoreProduct(requestContext(ctx), ctx.Param("id"))
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.Header("ETag", versionETag(product.Version))
+	ctx.JSON(http.StatusOK, product)
+}
+
+// AdjustStock godoc
+// @Summary Adjust product stock
+// @Description Add units to or remove units from the stock of a product, giving a reason. Stock cannot drop below the units reserved by pending orders. Every adjustment is recorded.
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param id path string true "Product ID"
+// @Param adjustment body models.StockAdjustmentRequest true "Stock adjustment"
+// @Success 200 {object} models.ProductResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /products/{id}/stock/adjustments [post]
+func (c *ProductController) AdjustStock(ctx *gin.Context) {
+	var req models.StockAdjustmentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, err := c.service.AdjustStock(requestContext(ctx), ctx.Param("id"), &req)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, product)
+}
+
+// GetStockAdjustments godoc
+// @Summary Get stock adjustments
+// @Description Get a page of the stock adjustments of a product, newest first
+// @Tags products
+// @Produce json
+// @Param id path string true "Product ID"
+// @Param page_size query int false "Maximum number of adjustments to return (default 20, max 100)"
+// @Param page_token query string false "next_page_token of the previous page"
+// @Param sort query string false "created_at, prefixed with - for descending order (default -created_at)"
+// @Success 200 {object} models.StockAdjustmentListResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /products/{id}/stock/adjustments [get]
+func (c *ProductController) GetStockAdjustments(ctx *gin.Context) {
+	var req models.ListRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adjustments, err := c.service.GetStockAdjustments(requestContext(ctx), ctx.Param("id"), &req)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, adjustments)
+}
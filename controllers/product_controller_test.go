@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"p3-graded-challenge-2-ziancarlos/middleware"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/repository"
+	"p3-graded-challenge-2-ziancarlos/service"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockProductService is a mock implementation of the ProductService calls
+// these tests make
+type MockProductService struct {
+	mock.Mock
+	service.ProductService
+}
+
+func (m *MockProductService) CreateProduct(ctx context.Context, req *models.ProductRequest) (*models.ProductResponse, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ProductResponse), args.Error(1)
+}
+
+func (m *MockProductService) GetProductByID(ctx context.Context, id string) (*models.ProductResponse, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ProductResponse), args.Error(1)
+}
+
+func (m *MockProductService) DeleteProduct(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// MockAuditRepository is a mock implementation of AuditRepository
+type MockAuditRepository struct {
+	mock.Mock
+}
+
+func (m *MockAuditRepository) Create(ctx context.Context, entry *models.AuditEntry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+func (m *MockAuditRepository) Find(ctx context.Context, filter repository.AuditFilter, page repository.PageOptions) ([]models.AuditEntry, string, error) {
+	args := m.Called(ctx, filter, page)
+	return args.Get(0).([]models.AuditEntry), args.String(1), args.Error(2)
+}
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestCreateProduct_InvalidRequestIsBadRequest(t *testing.T) {
+	// Invalid products are rejected before the repositories are used
+	controller := NewProductController(service.NewProductService(nil, nil, nil))
+	router := gin.New()
+	router.POST("/products", controller.CreateProduct)
+
+	tests := map[string]string{
+		"negative stock": `{"name": "Keyboard", "price": "50.00", "stock": -1}`,
+		"missing name":   `{"price": "50.00", "stock": 10}`,
+		"zero price":     `{"name": "Keyboard", "price": "0", "stock": 10}`,
+	}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		})
+	}
+}
+
+func TestProductByID_InvalidIDIsBadRequest(t *testing.T) {
+	controller := NewProductController(service.NewProductService(nil, nil, nil))
+	router := gin.New()
+	router.GET("/products/:id", controller.GetProductByID)
+	router.DELETE("/products/:id", controller.DeleteProduct)
+	router.POST("/products/:id/restore", controller.RestoreProduct)
+
+	tests := map[string]*http.Request{
+		"get":     httptest.NewRequest(http.MethodGet, "/products/invalid", nil),
+		"delete":  httptest.NewRequest(http.MethodDelete, "/products/invalid", nil),
+		"restore": httptest.NewRequest(http.MethodPost, "/products/invalid/restore", nil),
+	}
+	for name, req := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+
+			router.ServeHTTP(recorder, req)
+
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		})
+	}
+}
+
+func TestProductChanges_AuditedAsCaller(t *testing.T) {
+	mockService := new(MockProductService)
+	mockAudit := new(MockAuditRepository)
+	controller := NewProductController(service.NewAuditedProductService(mockService, mockAudit))
+	router := gin.New()
+	// Stands in for JWTMiddleware
+	router.Use(func(ctx *gin.Context) {
+		claims := &middleware.Claims{UserID: "admin-1", Roles: []string{models.RoleAdmin}}
+		ctx.Request = ctx.Request.WithContext(middleware.ContextWithClaims(ctx.Request.Context(), claims))
+	})
+	router.POST("/products", controller.CreateProduct)
+	router.DELETE("/products/:id", controller.DeleteProduct)
+
+	product := &models.ProductResponse{ID: "product-1", Name: "Keyboard", Price: "50.00", Version: 1}
+	mockService.On("CreateProduct", mock.Anything, mock.Anything).Return(product, nil)
+	mockService.On("GetProductByID", mock.Anything, "product-1").Return(product, nil)
+	mockService.On("DeleteProduct", mock.Anything, "product-1").Return(nil)
+	var actors []string
+	mockAudit.On("Create", mock.Anything, mock.MatchedBy(func(entry *models.AuditEntry) bool {
+		actors = append(actors, entry.Actor)
+		return true
+	})).Return(nil)
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(`{"name": "Keyboard", "price": "50.00"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/products/product-1", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	assert.Equal(t, []string{"admin-1", "admin-1"}, actors)
+}
@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"net/http"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RevocationController struct {
+	service service.RevocationService
+}
+
+func NewRevocationController(service service.RevocationService) *RevocationController {
+	return &RevocationController{
+		service: service,
+	}
+}
+
+// CreateRevocation godoc
+// @Summary Revoke access tokens
+// @Description Revoke a single access token by its jti claim, or every access and refresh token of a user by user_id. Revoked tokens are rejected by every service within seconds.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param revocation body models.RevocationRequest true "Revocation Request"
+// @Success 201 {object} models.RevocationResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /revocations [post]
+func (c *RevocationController) CreateRevocation(ctx *gin.Context) {
+	var req models.RevocationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	revocation, err := c.service.Revoke(requestContext(ctx), &req)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, revocation)
+}
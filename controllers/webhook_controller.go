@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"net/http"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookController struct {
+	service service.WebhookService
+}
+
+func NewWebhookController(service service.WebhookService) *WebhookController {
+	return &WebhookController{
+		service: service,
+	}
+}
+
+// CreateWebhook godoc
+// @Summary Create a webhook
+// @Description Subscribe a URL to payment changes. Every event is POSTed as a models.PaymentEventMessage with the headers X-Webhook-ID, X-Webhook-Event, X-Webhook-Timestamp and X-Webhook-Signature, which is "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook secret. Failed deliveries are retried with exponential backoff for a few hours before they are marked failed. The secret is only returned here.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param webhook body models.WebhookRequest true "Webhook Request"
+// @Success 201 {object} models.WebhookResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /webhooks [post]
+func (c *WebhookController) CreateWebhook(ctx *gin.Context) {
+	var req models.WebhookRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	webhook, err := c.service.CreateWebhook(requestContext(ctx), &req)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, webhook)
+}
+
+// GetAllWebhooks godoc
+// @Summary Get all webhooks
+// @Description Get every webhook, without their secrets
+// @Tags webhooks
+// @Produce json
+// @Success 200 {array} models.WebhookResponse
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /webhooks [get]
+func (c *WebhookController) GetAllWebhooks(ctx *gin.Context) {
+	webhooks, err := c.service.GetAllWebhooks(requestContext(ctx))
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, webhooks)
+}
+
+// GetWebhookByID godoc
+// @Summary Get webhook by ID
+// @Description Get a webhook by its ID, without its secret
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} models.WebhookResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /webhooks/{id} [get]
+func (c *WebhookController) GetWebhookByID(ctx *gin.Context) {
+	webhook, err := c.service.GetWebhookByID(requestContext(ctx), ctx.Param("id"))
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, webhook)
+}
+
+// UpdateWebhook godoc
+// @Summary Update webhook
+// @Description Replace the URL and events of a webhook, and enable or disable it. Deliveries to a disabled webhook are marked failed.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param webhook body models.WebhookRequest true "Webhook Request"
+// @Success 200 {object} models.WebhookResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security BearerAuth
+// @Router /webhooks/{id} [put]
+func (c *WebhookController) UpdateWebhook(ctx *gin.Context) {
+	var req models.WebhookRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	webhook, err := c.service.UpdateWebhook(requestContext(ctx), ctx.Param("id"), &req)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhook godoc
+// @Summary Delete webhook
+// @Description Delete a webhook along with its deliveries
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /webhooks/{id} [delete]
+func (c *WebhookController) DeleteWebhook(ctx *gin.Context) {
+	err := c.service.DeleteWebhook(requestContext(ctx), ctx.Param("id"))
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// GetDeliveries godoc
+// @Summary Get webhook deliveries
+// @Description Get a page of the deliveries of a webhook, newest first. Failed deliveries are dead letters that can be retried.
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param page_size query int false "Maximum number of deliveries to return (default 20, max 100)"
+// @Param page_token query string false "next_page_token of the previous page"
+// @Param sort query string false "created_at or next_attempt_at, prefixed with - for descending order (default -created_at)"
+// @Param status query string false "pending, delivered or failed"
+// @Success 200 {object} models.WebhookDeliveryListResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /webhooks/{id}/deliveries [get]
+func (c *WebhookController) GetDeliveries(ctx *gin.Context) {
+	var req models.WebhookDeliveryListRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	deliveries, err := c.service.GetDeliveries(requestContext(ctx), ctx.Param("id"), &req)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, deliveries)
+}
+
+// RetryDelivery godoc
+// @Summary Retry a failed webhook delivery
+// @Description Give a failed delivery a fresh set of attempts, starting right away
+// @Tags webhooks
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Param delivery_id path string true "Delivery ID"
+// @Success 200 {object} models.WebhookDeliveryResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security BearerAuth
+// @Router /webhooks/{id}/deliveries/{delivery_id}/retry [post]
+func (c *WebhookController) RetryDelivery(ctx *gin.Context) {
+	delivery, err := c.service.RetryDelivery(requestContext(ctx), ctx.Param("id"), ctx.Param("delivery_id"))
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, delivery)
+}
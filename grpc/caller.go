@@ -0,0 +1,35 @@
+package grpc
+
+import (
+	"context"
+	"p3-graded-challenge-2-ziancarlos/middleware"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/service"
+
+	grpclib "google.golang.org/grpc"
+)
+
+// UnaryCallerInterceptor hands the claims injected by
+// middleware.UnaryAuthInterceptor to the payment service as its caller,
+// which scopes payments to their owner. It must be chained after that
+// interceptor.
+func UnaryCallerInterceptor(ctx context.Context, req interface{}, info *grpclib.UnaryServerInfo, handler grpclib.UnaryHandler) (interface{}, error) {
+	return handler(callerContext(ctx), req)
+}
+
+// StreamCallerInterceptor is the streaming equivalent of
+// UnaryCallerInterceptor.
+func StreamCallerInterceptor(srv interface{}, ss grpclib.ServerStream, info *grpclib.StreamServerInfo, handler grpclib.StreamHandler) error {
+	return handler(srv, middleware.WrapServerStream(ss, callerContext(ss.Context())))
+}
+
+func callerContext(ctx context.Context) context.Context {
+	claims, ok := middleware.ClaimsFromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	return service.ContextWithCaller(ctx, models.Caller{
+		UserID: claims.UserID,
+		Roles:  claims.Roles,
+	})
+}
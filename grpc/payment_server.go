@@ -2,12 +2,14 @@ package grpc
 
 import (
 	"context"
+	"p3-graded-challenge-2-ziancarlos/middleware"
 	"p3-graded-challenge-2-ziancarlos/models"
 	pb "p3-graded-challenge-2-ziancarlos/proto/payment"
 	"p3-graded-challenge-2-ziancarlos/service"
+	"time"
 
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type PaymentServer struct {
@@ -23,58 +25,219 @@ func NewPaymentServer(service service.PaymentService) *PaymentServer {
 
 func (s *PaymentServer) CreatePayment(ctx context.Context, req *pb.CreatePaymentRequest) (*pb.PaymentResponse, error) {
 	paymentReq := &models.PaymentRequest{
-		Amount: req.Amount,
+		Amount:         models.Decimal(req.GetAmount().GetAmount()),
+		Currency:       req.GetAmount().GetCurrency(),
+		IdempotencyKey: req.IdempotencyKey,
+	}
+	if paymentReq.IdempotencyKey == "" {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get("idempotency-key"); len(values) > 0 {
+				paymentReq.IdempotencyKey = values[0]
+			}
+		}
 	}
 
 	payment, err := s.service.CreatePayment(ctx, paymentReq)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to create payment: %v", err)
+		return nil, toStatusError(err, "failed to create payment")
 	}
 
-	return &pb.PaymentResponse{
-		Id:     payment.ID,
-		Amount: payment.Amount,
-	}, nil
+	return toPBPayment(payment), nil
 }
 
 func (s *PaymentServer) GetAllPayments(ctx context.Context, req *pb.GetAllPaymentsRequest) (*pb.GetAllPaymentsResponse, error) {
-	payments, err := s.service.GetAllPayments(ctx)
+	res, err := s.service.GetAllPayments(ctx, &models.PaymentListRequest{
+		ListRequest: models.ListRequest{
+			PageSize:  int(req.PageSize),
+			PageToken: req.PageToken,
+			Sort:      req.Sort,
+		},
+		OwnerID:        req.OwnerId,
+		Status:         models.PaymentStatus(req.Status),
+		MinAmount:      models.Decimal(req.MinAmount),
+		MaxAmount:      models.Decimal(req.MaxAmount),
+		Currency:       req.Currency,
+		CreatedAfter:   fromPBTime(req.CreatedAfter),
+		CreatedBefore:  fromPBTime(req.CreatedBefore),
+		IncludeDeleted: req.IncludeDeleted,
+	})
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to get payments: %v", err)
+		return nil, toStatusError(err, "failed to get payments")
 	}
 
 	var pbPayments []*pb.PaymentResponse
-	for _, payment := range payments {
-		pbPayments = append(pbPayments, &pb.PaymentResponse{
-			Id:     payment.ID,
-			Amount: payment.Amount,
-		})
+	for _, payment := range res.Payments {
+		pbPayments = append(pbPayments, toPBPayment(&payment))
 	}
 
 	return &pb.GetAllPaymentsResponse{
-		Payments: pbPayments,
+		Payments:      pbPayments,
+		NextPageToken: res.NextPageToken,
 	}, nil
 }
 
 func (s *PaymentServer) GetPaymentByID(ctx context.Context, req *pb.GetPaymentByIDRequest) (*pb.PaymentResponse, error) {
 	payment, err := s.service.GetPaymentByID(ctx, req.Id)
 	if err != nil {
-		return nil, status.Errorf(codes.NotFound, "payment not found: %v", err)
+		return nil, toStatusError(err, "failed to get payment")
 	}
 
-	return &pb.PaymentResponse{
-		Id:     payment.ID,
-		Amount: payment.Amount,
-	}, nil
+	return toPBPayment(payment), nil
 }
 
 func (s *PaymentServer) DeletePayment(ctx context.Context, req *pb.DeletePaymentRequest) (*pb.DeletePaymentResponse, error) {
 	err := s.service.DeletePayment(ctx, req.Id)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to delete payment: %v", err)
+		return nil, toStatusError(err, "failed to delete payment")
 	}
 
 	return &pb.DeletePaymentResponse{
 		Message: "Payment deleted successfully",
 	}, nil
 }
+
+func (s *PaymentServer) RestorePayment(ctx context.Context, req *pb.RestorePaymentRequest) (*pb.PaymentResponse, error) {
+	payment, err := s.service.RestorePayment(ctx, req.Id)
+	if err != nil {
+		return nil, toStatusError(err, "failed to restore payment")
+	}
+
+	return toPBPayment(payment), nil
+}
+
+func (s *PaymentServer) AuthorizePayment(ctx context.Context, req *pb.AuthorizePaymentRequest) (*pb.PaymentResponse, error) {
+	payment, err := s.service.AuthorizePayment(ctx, req.Id)
+	if err != nil {
+		return nil, toStatusError(err, "failed to authorize payment")
+	}
+
+	return toPBPayment(payment), nil
+}
+
+func (s *PaymentServer) CapturePayment(ctx context.Context, req *pb.CapturePaymentRequest) (*pb.PaymentResponse, error) {
+	payment, err := s.service.CapturePayment(ctx, req.Id)
+	if err != nil {
+		return nil, toStatusError(err, "failed to capture payment")
+	}
+
+	return toPBPayment(payment), nil
+}
+
+func (s *PaymentServer) RefundPayment(ctx context.Context, req *pb.RefundPaymentRequest) (*pb.PaymentResponse, error) {
+	refundReq := &models.RefundRequest{
+		Amount:   models.Decimal(req.GetAmount().GetAmount()),
+		Currency: req.GetAmount().GetCurrency(),
+		Reason:   req.Reason,
+	}
+
+	payment, err := s.service.RefundPayment(ctx, req.Id, refundReq)
+	if err != nil {
+		return nil, toStatusError(err, "failed to refund payment")
+	}
+
+	return toPBPayment(payment), nil
+}
+
+func (s *PaymentServer) ListRefunds(ctx context.Context, req *pb.ListRefundsRequest) (*pb.ListRefundsResponse, error) {
+	refunds, err := s.service.GetRefunds(ctx, req.PaymentId)
+	if err != nil {
+		return nil, toStatusError(err, "failed to list refunds")
+	}
+
+	var pbRefunds []*pb.Refund
+	for _, refund := range refunds {
+		pbRefunds = append(pbRefunds, &pb.Refund{
+			Id:        refund.ID,
+			PaymentId: refund.PaymentID,
+			Amount:    toPBMoney(refund.Amount, refund.Currency),
+			Reason:    refund.Reason,
+			CreatedAt: timestamppb.New(refund.CreatedAt),
+		})
+	}
+
+	return &pb.ListRefundsResponse{
+		Refunds: pbRefunds,
+	}, nil
+}
+
+func (s *PaymentServer) CancelPayment(ctx context.Context, req *pb.CancelPaymentRequest) (*pb.PaymentResponse, error) {
+	payment, err := s.service.CancelPayment(ctx, req.Id)
+	if err != nil {
+		return nil, toStatusError(err, "failed to cancel payment")
+	}
+
+	return toPBPayment(payment), nil
+}
+
+func (s *PaymentServer) FailPayment(ctx context.Context, req *pb.FailPaymentRequest) (*pb.PaymentResponse, error) {
+	payment, err := s.service.FailPayment(ctx, req.Id)
+	if err != nil {
+		return nil, toStatusError(err, "failed to mark payment as failed")
+	}
+
+	return toPBPayment(payment), nil
+}
+
+func (s *PaymentServer) WatchPayments(req *pb.WatchPaymentsRequest, stream pb.PaymentService_WatchPaymentsServer) error {
+	ctx := stream.Context()
+	// End the stream when the caller's token expires, so a revoked or
+	// expired session cannot keep watching; clients reconnect with a fresh
+	// token and the last resume token
+	if claims, ok := middleware.ClaimsFromContext(ctx); ok && claims.ExpiresAt != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, claims.ExpiresAt.Time)
+		defer cancel()
+	}
+
+	err := s.service.WatchPayments(ctx, req.ResumeToken, func(event *models.PaymentEventResponse) error {
+		return stream.Send(toPBPaymentEvent(event))
+	})
+	if err != nil {
+		return toStatusError(err, "failed to watch payments")
+	}
+
+	return nil
+}
+
+func toPBPayment(payment *models.PaymentResponse) *pb.PaymentResponse {
+	pbPayment := &pb.PaymentResponse{
+		Id:             payment.ID,
+		Amount:         toPBMoney(payment.Amount, payment.Currency),
+		Status:         string(payment.Status),
+		RefundedAmount: toPBMoney(payment.RefundedAmount, payment.Currency),
+		CreatedAt:      timestamppb.New(payment.CreatedAt),
+		OwnerId:        payment.OwnerID,
+		UpdatedAt:      timestamppb.New(payment.UpdatedAt),
+	}
+	if payment.DeletedAt != nil {
+		pbPayment.DeletedAt = timestamppb.New(*payment.DeletedAt)
+	}
+	return pbPayment
+}
+
+func toPBPaymentEvent(event *models.PaymentEventResponse) *pb.PaymentEvent {
+	pbEvent := &pb.PaymentEvent{
+		Type:        string(event.Type),
+		PaymentId:   event.PaymentID,
+		ResumeToken: event.ResumeToken,
+	}
+	if event.Payment != nil {
+		pbEvent.Payment = toPBPayment(event.Payment)
+	}
+	return pbEvent
+}
+
+func toPBMoney(amount models.Decimal, currency string) *pb.Money {
+	return &pb.Money{
+		Amount:   string(amount),
+		Currency: currency,
+	}
+}
+
+// fromPBTime converts an optional timestamp, mapping unset to the zero time.
+func fromPBTime(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
@@ -0,0 +1,17 @@
+package grpc
+
+import (
+	"p3-graded-challenge-2-ziancarlos/middleware"
+	"p3-graded-challenge-2-ziancarlos/models"
+)
+
+// MethodPolicies holds the authorization policy of every PaymentService
+// method that is not open to all authenticated callers.
+var MethodPolicies = map[string]middleware.Policy{
+	"/payment.PaymentService/AuthorizePayment": middleware.RequireRole(models.RoleAdmin),
+	"/payment.PaymentService/CapturePayment":   middleware.RequireRole(models.RoleAdmin),
+	"/payment.PaymentService/RefundPayment":    middleware.RequireRole(models.RoleAdmin),
+	"/payment.PaymentService/CancelPayment":    middleware.RequireRole(models.RoleAdmin),
+	"/payment.PaymentService/FailPayment":      middleware.RequireRole(models.RoleAdmin),
+	"/payment.PaymentService/RestorePayment":   middleware.RequireRole(models.RoleAdmin),
+}
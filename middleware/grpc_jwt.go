@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultPublicMethods are the gRPC methods callable without a token: server
+// reflection, so tools like grpcurl can list services, and health checks.
+var DefaultPublicMethods = PublicMethods{
+	"/grpc.reflection.v1.ServerReflection/",
+	"/grpc.reflection.v1alpha.ServerReflection/",
+	"/grpc.health.v1.Health/",
+}
+
+// PublicMethods lists gRPC methods that do not require a token. Entries are
+// full method names such as "/payment.PaymentService/GetPaymentByID", or
+// service prefixes ending in "/" that match every method of the service.
+type PublicMethods []string
+
+// Contains reports whether fullMethod is public.
+func (p PublicMethods) Contains(fullMethod string) bool {
+	for _, method := range p {
+		if method == fullMethod || (strings.HasSuffix(method, "/") && strings.HasPrefix(fullMethod, method)) {
+			return true
+		}
+	}
+	return false
+}
+
+// UnaryAuthInterceptor authenticates unary calls with the JWT in the
+// "authorization" metadata and stores its claims in the context, where
+// ClaimsFromContext finds them. Public methods are called without claims.
+func UnaryAuthInterceptor(public PublicMethods) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if public.Contains(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		claims, err := authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ContextWithClaims(ctx, claims), req)
+	}
+}
+
+// StreamAuthInterceptor is the streaming equivalent of UnaryAuthInterceptor.
+// The token is checked once, when the stream is opened.
+func StreamAuthInterceptor(public PublicMethods) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if public.Contains(info.FullMethod) {
+			return handler(srv, ss)
+		}
+
+		claims, err := authenticate(ss.Context())
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, WrapServerStream(ss, ContextWithClaims(ss.Context(), claims)))
+	}
+}
+
+// authenticate validates the bearer token in the incoming metadata of ctx.
+func authenticate(ctx context.Context) (*Claims, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "missing metadata")
+	}
+
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Errorf(codes.Unauthenticated, "missing authorization token")
+	}
+
+	token := values[0]
+	if strings.HasPrefix(token, "Bearer ") {
+		token = strings.TrimPrefix(token, "Bearer ")
+	}
+
+	claims, err := ValidateToken(token)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid token: %v", err)
+	}
+	return claims, nil
+}
+
+// WrapServerStream returns ss with its context replaced by ctx, which is how
+// stream interceptors pass values to the handler.
+func WrapServerStream(ss grpc.ServerStream, ctx context.Context) grpc.ServerStream {
+	return &serverStream{ServerStream: ss, ctx: ctx}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
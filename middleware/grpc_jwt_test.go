@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// testServerStream is a server stream that only has a context.
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// incomingContext returns a context carrying the incoming authorization
+// metadata of a call, or no metadata if authorization is empty.
+func incomingContext(authorization string) context.Context {
+	if authorization == "" {
+		return context.Background()
+	}
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", authorization))
+}
+
+const watchPaymentsMethod = "/payment.PaymentService/WatchPayments"
+
+func TestPublicMethods_Contains(t *testing.T) {
+	public := append(PublicMethods{"/payment.PaymentService/GetPaymentByID"}, DefaultPublicMethods...)
+
+	tests := []struct {
+		method string
+		want   bool
+	}{
+		{"/grpc.health.v1.Health/Check", true},
+		{"/grpc.health.v1.Health/Watch", true},
+		{"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo", true},
+		{"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo", true},
+		{"/payment.PaymentService/GetPaymentByID", true},
+		{"/payment.PaymentService/GetPaymentByIDs", false},
+		{watchPaymentsMethod, false},
+		{"/grpc.health.v1.HealthCheck/Check", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			assert.Equal(t, tt.want, public.Contains(tt.method))
+		})
+	}
+}
+
+func TestStreamAuthInterceptor_RejectsStreamWithoutToken(t *testing.T) {
+	newTestIssuer(t, AlgorithmEdDSA)
+	interceptor := StreamAuthInterceptor(DefaultPublicMethods)
+
+	tests := []struct {
+		name          string
+		authorization string
+	}{
+		{"no metadata", ""},
+		{"empty bearer token", "Bearer "},
+		{"invalid token", "Bearer not-a-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			err := interceptor(nil, &testServerStream{ctx: incomingContext(tt.authorization)}, &grpc.StreamServerInfo{FullMethod: watchPaymentsMethod}, func(srv interface{}, ss grpc.ServerStream) error {
+				called = true
+				return nil
+			})
+
+			assert.Equal(t, codes.Unauthenticated, status.Code(err))
+			assert.False(t, called)
+		})
+	}
+}
+
+func TestStreamAuthInterceptor_PassesClaimsToHandler(t *testing.T) {
+	newTestIssuer(t, AlgorithmEdDSA)
+	token, err := GenerateToken("user-1", []string{"admin"})
+	require.NoError(t, err)
+	interceptor := StreamAuthInterceptor(DefaultPublicMethods)
+
+	var claims *Claims
+	err = interceptor(nil, &testServerStream{ctx: incomingContext("Bearer " + token)}, &grpc.StreamServerInfo{FullMethod: watchPaymentsMethod}, func(srv interface{}, ss grpc.ServerStream) error {
+		var ok bool
+		claims, ok = ClaimsFromContext(ss.Context())
+		assert.True(t, ok)
+		return nil
+	})
+
+	require.NoError(t, err)
+	require.NotNil(t, claims)
+	assert.Equal(t, "user-1", claims.UserID)
+	assert.True(t, claims.HasRole("admin"))
+}
+
+func TestStreamAuthInterceptor_AllowsHealthAndReflectionWithoutToken(t *testing.T) {
+	interceptor := StreamAuthInterceptor(DefaultPublicMethods)
+
+	for _, method := range []string{"/grpc.health.v1.Health/Watch", "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo"} {
+		t.Run(method, func(t *testing.T) {
+			called := false
+			err := interceptor(nil, &testServerStream{ctx: context.Background()}, &grpc.StreamServerInfo{FullMethod: method}, func(srv interface{}, ss grpc.ServerStream) error {
+				called = true
+				_, ok := ClaimsFromContext(ss.Context())
+				assert.False(t, ok)
+				return nil
+			})
+
+			assert.NoError(t, err)
+			assert.True(t, called)
+		})
+	}
+}
+
+func TestUnaryAuthInterceptor_AllowsHealthCheckWithoutToken(t *testing.T) {
+	interceptor := UnaryAuthInterceptor(DefaultPublicMethods)
+
+	resp, err := interceptor(context.Background(), "request", &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		_, ok := ClaimsFromContext(ctx)
+		assert.False(t, ok)
+		return "response", nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "response", resp)
+}
+
+func TestUnaryAuthInterceptor_RejectsCallWithoutToken(t *testing.T) {
+	newTestIssuer(t, AlgorithmEdDSA)
+	interceptor := UnaryAuthInterceptor(DefaultPublicMethods)
+
+	_, err := interceptor(context.Background(), "request", &grpc.UnaryServerInfo{FullMethod: "/payment.PaymentService/GetPaymentByID"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		t.Fatal("handler called without a token")
+		return nil, nil
+	})
+
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestUnaryAuthInterceptor_AcceptsTokenWithoutBearerPrefix(t *testing.T) {
+	newTestIssuer(t, AlgorithmEdDSA)
+	token, err := GenerateToken("user-1", nil)
+	require.NoError(t, err)
+	interceptor := UnaryAuthInterceptor(DefaultPublicMethods)
+
+	_, err = interceptor(incomingContext(token), "request", &grpc.UnaryServerInfo{FullMethod: "/payment.PaymentService/GetPaymentByID"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		claims, ok := ClaimsFromContext(ctx)
+		require.True(t, ok)
+		assert.Equal(t, "user-1", claims.UserID)
+		return nil, nil
+	})
+
+	assert.NoError(t, err)
+}
+
+func TestClaimsFromContext(t *testing.T) {
+	_, ok := ClaimsFromContext(context.Background())
+	assert.False(t, ok)
+
+	_, ok = ClaimsFromContext(ContextWithClaims(context.Background(), nil))
+	assert.False(t, ok)
+
+	want := &Claims{UserID: "user-1", Roles: []string{"customer"}}
+	claims, ok := ClaimsFromContext(ContextWithClaims(context.Background(), want))
+	assert.True(t, ok)
+	assert.Same(t, want, claims)
+}
+
+func TestStreamAuthorizeInterceptor_AppliesPolicyToStreamClaims(t *testing.T) {
+	newTestIssuer(t, AlgorithmEdDSA)
+	token, err := GenerateToken("user-1", []string{"customer"})
+	require.NoError(t, err)
+	authenticate := StreamAuthInterceptor(DefaultPublicMethods)
+	authorize := StreamAuthorizeInterceptor(map[string]Policy{watchPaymentsMethod: RequireRole("admin")})
+	info := &grpc.StreamServerInfo{FullMethod: watchPaymentsMethod}
+
+	err = authenticate(nil, &testServerStream{ctx: incomingContext("Bearer " + token)}, info, func(srv interface{}, ss grpc.ServerStream) error {
+		return authorize(srv, ss, info, func(srv interface{}, ss grpc.ServerStream) error {
+			t.Fatal("handler called without the admin role")
+			return nil
+		})
+	})
+
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -29,7 +29,8 @@ func JWTMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		c.Set("claims", claims)
+		reqCtx := ContextWithClaims(c.Request.Context(), claims)
+		c.Request = c.Request.WithContext(ContextWithToken(reqCtx, token))
 		c.Next()
 	}
 }
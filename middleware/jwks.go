@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// JWKS refresh intervals of JWKSClient. The refresh interval must stay
+// below KeyActivationDelay so new keys are known before they sign tokens.
+const (
+	jwksRefreshInterval   = 5 * time.Minute
+	jwksMinRefreshBackoff = 30 * time.Second
+)
+
+// JSONWebKey is the public part of a signing key in RFC 7517 format.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// Curve and X are set for Ed25519 keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	// N and E are set for RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+}
+
+// JSONWebKeySet is the document served at /.well-known/jwks.json.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// NewJSONWebKeySet encodes keys as a JSON Web Key Set.
+func NewJSONWebKeySet(keys []VerificationKey) JSONWebKeySet {
+	set := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(keys))}
+	for _, key := range keys {
+		jwk := JSONWebKey{KeyID: key.ID, Use: "sig", Algorithm: key.Algorithm}
+		switch public := key.Key.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// verificationKey decodes the public key of jwk.
+func (jwk JSONWebKey) verificationKey() (*VerificationKey, error) {
+	key := &VerificationKey{ID: jwk.KeyID, Algorithm: jwk.Algorithm}
+	switch {
+	case jwk.KeyType == "OKP" && jwk.Curve == "Ed25519" && jwk.Algorithm == AlgorithmEdDSA:
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("key %q has an invalid Ed25519 public key", jwk.KeyID)
+		}
+		key.Key = ed25519.PublicKey(x)
+	case jwk.KeyType == "RSA" && jwk.Algorithm == AlgorithmRS256:
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("key %q has an invalid RSA modulus", jwk.KeyID)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("key %q has an invalid RSA exponent", jwk.KeyID)
+		}
+		key.Key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	default:
+		return nil, fmt.Errorf("key %q has unsupported type %s/%s", jwk.KeyID, jwk.KeyType, jwk.Algorithm)
+	}
+	return key, nil
+}
+
+// JWKSClient is a KeySource backed by the JWKS endpoint of the token issuer,
+// so services can verify tokens without holding any signing key. It caches
+// the key set and refetches it periodically and whenever a token names a key
+// it does not know.
+type JWKSClient struct {
+	url    string
+	client *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]*VerificationKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+// NewJWKSClient creates a JWKSClient for the key set served at url.
+func NewJWKSClient(url string) *JWKSClient {
+	return &JWKSClient{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// VerificationKey implements KeySource.
+func (c *JWKSClient) VerificationKey(kid string) (*VerificationKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, ok := c.keys[kid]
+	stale := time.Since(c.fetchedAt) > jwksRefreshInterval
+	if (!ok || stale) && time.Since(c.attemptedAt) > jwksMinRefreshBackoff {
+		c.attemptedAt = time.Now()
+		if err := c.fetch(); err != nil {
+			// Keep verifying with the cached keys while the issuer is down
+			if !ok {
+				return nil, err
+			}
+		}
+		key, ok = c.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+func (c *JWKSClient) fetch() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: %s", resp.Status)
+	}
+
+	var set JSONWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]*VerificationKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		key, err := jwk.verificationKey()
+		if err != nil {
+			return fmt.Errorf("failed to decode JWKS: %w", err)
+		}
+		keys[key.ID] = key
+	}
+
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestJWKSServer serves the key set of keys, failing while down is set.
+func newTestJWKSServer(t *testing.T, keys *KeyDirectory, down *atomic.Bool) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down != nil && down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(NewJSONWebKeySet(keys.VerificationKeys()))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// verifyWithJWKS makes tokens verify through a JWKS client of server until
+// the test ends. The test issuer keeps signing them.
+func verifyWithJWKS(t *testing.T, server *httptest.Server) *JWKSClient {
+	client := NewJWKSClient(server.URL)
+	previous := verificationKeys
+	InitJWT(client)
+	t.Cleanup(func() { verificationKeys = previous })
+	return client
+}
+
+func TestJSONWebKeySet_RoundTripsKeys(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmEdDSA, AlgorithmRS256} {
+		t.Run(algorithm, func(t *testing.T) {
+			keys, err := LoadKeyDirectory(t.TempDir(), algorithm)
+			require.NoError(t, err)
+			want := keys.VerificationKeys()[0]
+
+			set := NewJSONWebKeySet(keys.VerificationKeys())
+			data, err := json.Marshal(set)
+			require.NoError(t, err)
+			var decoded JSONWebKeySet
+			require.NoError(t, json.Unmarshal(data, &decoded))
+			require.Len(t, decoded.Keys, 1)
+			got, err := decoded.Keys[0].verificationKey()
+
+			require.NoError(t, err)
+			assert.Equal(t, want.ID, got.ID)
+			assert.Equal(t, algorithm, got.Algorithm)
+			assert.Equal(t, want.Key, got.Key)
+		})
+	}
+}
+
+func TestJSONWebKey_RejectsUnsupportedKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		jwk  JSONWebKey
+	}{
+		{"unknown type", JSONWebKey{KeyID: "k", KeyType: "EC", Algorithm: "ES256"}},
+		{"algorithm not matching the key type", JSONWebKey{KeyID: "k", KeyType: "OKP", Curve: "Ed25519", Algorithm: AlgorithmRS256, X: "AAAA"}},
+		{"short Ed25519 key", JSONWebKey{KeyID: "k", KeyType: "OKP", Curve: "Ed25519", Algorithm: AlgorithmEdDSA, X: "AAAA"}},
+		{"RSA key without exponent", JSONWebKey{KeyID: "k", KeyType: "RSA", Algorithm: AlgorithmRS256, N: "AAAA"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.jwk.verificationKey()
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestJWKSClient_TokenSignedBeforeRotationStillVerifies(t *testing.T) {
+	keys := newTestIssuer(t, AlgorithmEdDSA)
+	client := verifyWithJWKS(t, newTestJWKSServer(t, keys, nil))
+	oldToken, err := GenerateToken("user-1", nil)
+	require.NoError(t, err)
+	_, err = ValidateToken(oldToken)
+	require.NoError(t, err)
+
+	newKID := rotate(t, keys, time.Now().Add(-time.Hour))
+	newToken, err := GenerateToken("user-1", nil)
+	require.NoError(t, err)
+	require.Equal(t, newKID, tokenKeyID(t, newToken))
+	// The client looks the new key up once the refetch backoff is over
+	client.attemptedAt = time.Time{}
+
+	_, err = ValidateToken(newToken)
+	assert.NoError(t, err)
+	_, err = ValidateToken(oldToken)
+	assert.NoError(t, err)
+}
+
+func TestJWKSClient_RejectsUnknownKeyID(t *testing.T) {
+	keys := newTestIssuer(t, AlgorithmEdDSA)
+	client := NewJWKSClient(newTestJWKSServer(t, keys, nil).URL)
+
+	_, err := client.VerificationKey("unknown")
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown key "unknown"`)
+}
+
+func TestJWKSClient_PrunedKeyNoLongerVerifies(t *testing.T) {
+	keys := newTestIssuer(t, AlgorithmEdDSA)
+	client := verifyWithJWKS(t, newTestJWKSServer(t, keys, nil))
+	oldToken, err := GenerateToken("user-1", nil)
+	require.NoError(t, err)
+	_, err = ValidateToken(oldToken)
+	require.NoError(t, err)
+
+	rotate(t, keys, time.Now().Add(-KeyActivationDelay-AccessTokenTTL-time.Minute))
+	require.NoError(t, keys.Prune())
+	// The cached key set is due for its periodic refresh
+	client.fetchedAt = time.Now().Add(-jwksRefreshInterval - time.Second)
+	client.attemptedAt = time.Time{}
+
+	_, err = ValidateToken(oldToken)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown key")
+}
+
+func TestJWKSClient_KeepsCachedKeysWhileIssuerIsDown(t *testing.T) {
+	keys := newTestIssuer(t, AlgorithmEdDSA)
+	var down atomic.Bool
+	client := verifyWithJWKS(t, newTestJWKSServer(t, keys, &down))
+	token, err := GenerateToken("user-1", nil)
+	require.NoError(t, err)
+	_, err = ValidateToken(token)
+	require.NoError(t, err)
+
+	down.Store(true)
+	client.fetchedAt = time.Now().Add(-jwksRefreshInterval - time.Second)
+	client.attemptedAt = time.Time{}
+
+	_, err = ValidateToken(token)
+	assert.NoError(t, err)
+	_, err = client.VerificationKey("unknown")
+	assert.Error(t, err)
+}
+
+func TestJWKSClient_BacksOffRefetchingForUnknownKeys(t *testing.T) {
+	keys := newTestIssuer(t, AlgorithmEdDSA)
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(NewJSONWebKeySet(keys.VerificationKeys()))
+	}))
+	t.Cleanup(server.Close)
+	client := NewJWKSClient(server.URL)
+
+	for i := 0; i < 3; i++ {
+		_, err := client.VerificationKey("unknown")
+		assert.Error(t, err)
+	}
+
+	assert.Equal(t, int32(1), fetches.Load())
+}
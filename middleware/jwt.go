@@ -2,89 +2,186 @@ package middleware
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
 )
 
 type Claims struct {
-	UserID string `json:"user_id"`
+	UserID string   `json:"user_id"`
+	Roles  []string `json:"roles,omitempty"`
 	jwt.RegisteredClaims
 }
 
-var jwtSecret []byte
+// HasRole reports whether the token grants role.
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// signingKeys signs new tokens and is only set in the token issuer;
+// verificationKeys verifies them in every service.
+var (
+	signingKeys      *KeyDirectory
+	verificationKeys KeySource
+)
 
-func InitJWT(secret string) {
-	jwtSecret = []byte(secret)
+// revocationList rejects tokens revoked before they expire. It is optional.
+var revocationList RevocationChecker
+
+// RevocationChecker reports whether a token has been revoked.
+type RevocationChecker interface {
+	IsRevoked(jti, userID string, issuedAt time.Time) bool
 }
 
-// GenerateToken generates a JWT token
-func GenerateToken(userID string) (string, error) {
+type (
+	tokenContextKey  struct{}
+	claimsContextKey struct{}
+)
+
+// AccessTokenTTL is the lifetime of access tokens. Clients keep their session
+// alive with refresh tokens instead of long-lived access tokens.
+const AccessTokenTTL = 15 * time.Minute
+
+// InitJWT sets the keys that verify tokens, for services that only accept
+// tokens issued elsewhere.
+func InitJWT(keys KeySource) {
+	verificationKeys = keys
+}
+
+// InitJWTIssuer sets the keys that sign and verify tokens in the service
+// that issues them.
+func InitJWTIssuer(keys *KeyDirectory) {
+	signingKeys = keys
+	verificationKeys = keys
+}
+
+// InitRevocationList makes ValidateToken reject the tokens revoked in list.
+func InitRevocationList(list RevocationChecker) {
+	revocationList = list
+}
+
+// GenerateToken generates a JWT access token granting roles that expires
+// after AccessTokenTTL
+func GenerateToken(userID string, roles []string) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", fmt.Errorf("failed to generate token ID: %w", err)
+	}
+
+	now := time.Now()
 	claims := Claims{
 		UserID: userID,
+		Roles:  roles,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        hex.EncodeToString(jti),
+			Subject:   userID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	if signingKeys == nil {
+		return "", fmt.Errorf("no signing keys configured")
+	}
+	key, err := signingKeys.activeKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(signingMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signer)
 }
 
-// ValidateToken validates the JWT token
+// ValidateToken validates the JWT token and rejects revoked tokens
 func ValidateToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, fmt.Errorf("missing key ID")
+		}
+		if verificationKeys == nil {
+			return nil, fmt.Errorf("no verification keys configured")
+		}
+		key, err := verificationKeys.VerificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		// The key decides the algorithm, never the token
+		if token.Method.Alg() != key.Algorithm {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return jwtSecret, nil
-	})
+		return key.Key, nil
+	}, jwt.WithValidMethods([]string{AlgorithmEdDSA, AlgorithmRS256}))
 
 	if err != nil {
 		return nil, err
 	}
 
 	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+		if claims.ID == "" || claims.IssuedAt == nil {
+			return nil, fmt.Errorf("token has no ID or issue time")
+		}
+		if revocationList != nil && revocationList.IsRevoked(claims.ID, claims.UserID, claims.IssuedAt.Time) {
+			return nil, fmt.Errorf("token has been revoked")
+		}
 		return claims, nil
 	}
 
 	return nil, fmt.Errorf("invalid token")
 }
 
-// UnaryInterceptor for JWT authentication in gRPC
-func UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	// Skip authentication for certain methods if needed
-	// For now, we'll require authentication for all methods
+// ContextWithToken returns a copy of ctx carrying the caller's raw JWT so it
+// can be forwarded to downstream services.
+func ContextWithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenContextKey{}, token)
+}
 
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return nil, status.Errorf(codes.Unauthenticated, "missing metadata")
-	}
+// ContextWithClaims returns a copy of ctx carrying the claims of the
+// authenticated caller.
+func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
 
-	values := md.Get("authorization")
-	if len(values) == 0 {
-		return nil, status.Errorf(codes.Unauthenticated, "missing authorization token")
-	}
+// ClaimsFromContext returns the claims stored by ContextWithClaims. It
+// reports false for calls to public methods, which carry no claims.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
 
-	token := values[0]
-	if strings.HasPrefix(token, "Bearer ") {
-		token = strings.TrimPrefix(token, "Bearer ")
-	}
+// TokenFromContext returns the raw JWT stored by ContextWithToken.
+func TokenFromContext(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(tokenContextKey{}).(string)
+	return token, ok && token != ""
+}
 
-	claims, err := ValidateToken(token)
-	if err != nil {
-		return nil, status.Errorf(codes.Unauthenticated, "invalid token: %v", err)
+// UnaryClientInterceptor forwards the caller's JWT as "authorization" metadata
+// on outgoing gRPC calls
+func UnaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if token, ok := TokenFromContext(ctx); ok {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
 	}
 
-	// Add claims to context
-	ctx = context.WithValue(ctx, "claims", claims)
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// StreamClientInterceptor is the streaming equivalent of
+// UnaryClientInterceptor
+func StreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	if token, ok := TokenFromContext(ctx); ok {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
 
-	return handler(ctx, req)
+	return streamer(ctx, desc, cc, method, opts...)
 }
@@ -0,0 +1,273 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms, as written in the "alg" token header.
+const (
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmRS256 = "RS256"
+)
+
+// KeyActivationDelay is how long a new key is published before it signs
+// tokens, so verifiers that cache the key set have fetched it by then.
+const KeyActivationDelay = 10 * time.Minute
+
+// KeySource resolves the public key that verifies tokens signed with kid.
+type KeySource interface {
+	VerificationKey(kid string) (*VerificationKey, error)
+}
+
+// VerificationKey is the public half of a signing key.
+type VerificationKey struct {
+	ID        string
+	Algorithm string
+	Key       crypto.PublicKey
+}
+
+// signingKey is a private key stored in a KeyDirectory.
+type signingKey struct {
+	VerificationKey
+	signer    crypto.Signer
+	createdAt time.Time
+}
+
+// KeyDirectory holds the signing keys of the token issuer. Every key is a
+// PEM encoded PKCS #8 private key named "<kid>.pem"; its modification time
+// is its creation time. Tokens are signed with the newest active key while
+// older keys keep verifying the tokens they signed until those expire.
+type KeyDirectory struct {
+	dir       string
+	algorithm string
+
+	mu   sync.RWMutex
+	keys []*signingKey // sorted from oldest to newest
+}
+
+// LoadKeyDirectory loads the keys in dir, creating the directory and a first
+// key with algorithm if there are none.
+func LoadKeyDirectory(dir, algorithm string) (*KeyDirectory, error) {
+	if algorithm != AlgorithmEdDSA && algorithm != AlgorithmRS256 {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	keys := &KeyDirectory{dir: dir, algorithm: algorithm}
+	if err := keys.Reload(); err != nil {
+		return nil, err
+	}
+	if len(keys.keys) == 0 {
+		if err := keys.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// Reload rereads the directory, picking up keys added or removed by other
+// instances sharing it.
+func (d *KeyDirectory) Reload() error {
+	paths, err := filepath.Glob(filepath.Join(d.dir, "*.pem"))
+	if err != nil {
+		return fmt.Errorf("failed to list keys: %w", err)
+	}
+
+	keys := make([]*signingKey, 0, len(paths))
+	for _, path := range paths {
+		key, err := readSigningKey(path)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].createdAt.Before(keys[j].createdAt)
+	})
+
+	d.mu.Lock()
+	d.keys = keys
+	d.mu.Unlock()
+	return nil
+}
+
+// Rotate generates a new key. It is published right away and starts signing
+// tokens after KeyActivationDelay.
+func (d *KeyDirectory) Rotate() error {
+	signer, err := generateKey(d.algorithm)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return fmt.Errorf("failed to encode key: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("failed to generate key ID: %w", err)
+	}
+	kid := time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(d.dir, kid+".pem"), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write key: %w", err)
+	}
+
+	return d.Reload()
+}
+
+// LatestKeyAge returns how long ago the newest key was created.
+func (d *KeyDirectory) LatestKeyAge() time.Duration {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if len(d.keys) == 0 {
+		return 0
+	}
+	return time.Since(d.keys[len(d.keys)-1].createdAt)
+}
+
+// Prune deletes keys that can no longer have signed an unexpired token,
+// i.e. keys that were replaced by an active key more than AccessTokenTTL ago.
+func (d *KeyDirectory) Prune() error {
+	d.mu.RLock()
+	keys := d.keys
+	d.mu.RUnlock()
+
+	now := time.Now()
+	var removed bool
+	for i := 0; i+1 < len(keys); i++ {
+		replacedAt := keys[i+1].createdAt.Add(KeyActivationDelay)
+		if now.Sub(replacedAt) <= AccessTokenTTL {
+			break
+		}
+		if err := os.Remove(filepath.Join(d.dir, keys[i].ID+".pem")); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove key %s: %w", keys[i].ID, err)
+		}
+		removed = true
+	}
+
+	if removed {
+		return d.Reload()
+	}
+	return nil
+}
+
+// VerificationKey implements KeySource.
+func (d *KeyDirectory) VerificationKey(kid string) (*VerificationKey, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, key := range d.keys {
+		if key.ID == kid {
+			return &key.VerificationKey, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// VerificationKeys returns the public keys of every key in the directory,
+// including the ones that are not active yet.
+func (d *KeyDirectory) VerificationKeys() []VerificationKey {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	keys := make([]VerificationKey, 0, len(d.keys))
+	for _, key := range d.keys {
+		keys = append(keys, key.VerificationKey)
+	}
+	return keys
+}
+
+// activeKey returns the newest key that was published at least
+// KeyActivationDelay ago, or the oldest key if none has been.
+func (d *KeyDirectory) activeKey() (*signingKey, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if len(d.keys) == 0 {
+		return nil, fmt.Errorf("no signing key")
+	}
+	activeBefore := time.Now().Add(-KeyActivationDelay)
+	for i := len(d.keys) - 1; i >= 0; i-- {
+		if d.keys[i].createdAt.Before(activeBefore) {
+			return d.keys[i], nil
+		}
+	}
+	return d.keys[0], nil
+}
+
+func readSigningKey(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s is not a PEM encoded PKCS #8 private key", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	var algorithm string
+	switch parsed.(type) {
+	case ed25519.PrivateKey:
+		algorithm = AlgorithmEdDSA
+	case *rsa.PrivateKey:
+		algorithm = AlgorithmRS256
+	default:
+		return nil, fmt.Errorf("%s holds an unsupported %T key", path, parsed)
+	}
+	signer := parsed.(crypto.Signer)
+
+	return &signingKey{
+		VerificationKey: VerificationKey{
+			ID:        strings.TrimSuffix(filepath.Base(path), ".pem"),
+			Algorithm: algorithm,
+			Key:       signer.Public(),
+		},
+		signer:    signer,
+		createdAt: info.ModTime(),
+	}, nil
+}
+
+func generateKey(algorithm string) (crypto.Signer, error) {
+	if algorithm == AlgorithmRS256 {
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	return key, err
+}
+
+// signingMethod returns the jwt signing method of algorithm.
+func signingMethod(algorithm string) jwt.SigningMethod {
+	if algorithm == AlgorithmRS256 {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestIssuer loads a key directory with one active key and makes it sign
+// and verify tokens until the test ends.
+func newTestIssuer(t *testing.T, algorithm string) *KeyDirectory {
+	keys, err := LoadKeyDirectory(t.TempDir(), algorithm)
+	require.NoError(t, err)
+	require.Len(t, keys.VerificationKeys(), 1)
+	setKeyCreatedAt(t, keys, keys.VerificationKeys()[0].ID, time.Now().Add(-2*time.Hour))
+
+	previousSigning, previousVerification := signingKeys, verificationKeys
+	InitJWTIssuer(keys)
+	t.Cleanup(func() {
+		signingKeys, verificationKeys = previousSigning, previousVerification
+	})
+	return keys
+}
+
+// setKeyCreatedAt moves the creation time of key kid to at.
+func setKeyCreatedAt(t *testing.T, keys *KeyDirectory, kid string, at time.Time) {
+	require.NoError(t, os.Chtimes(filepath.Join(keys.dir, kid+".pem"), at, at))
+	require.NoError(t, keys.Reload())
+}
+
+// rotate adds a key created at createdAt and returns its ID.
+func rotate(t *testing.T, keys *KeyDirectory, createdAt time.Time) string {
+	before := keys.VerificationKeys()
+	require.NoError(t, keys.Rotate())
+	after := keys.VerificationKeys()
+	require.Len(t, after, len(before)+1)
+
+	kid := after[len(after)-1].ID
+	setKeyCreatedAt(t, keys, kid, createdAt)
+	return kid
+}
+
+// tokenKeyID returns the kid header of token.
+func tokenKeyID(t *testing.T, token string) string {
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	require.NoError(t, err)
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestLoadKeyDirectory_RejectsUnsupportedAlgorithm(t *testing.T) {
+	_, err := LoadKeyDirectory(t.TempDir(), "HS256")
+
+	assert.Error(t, err)
+}
+
+func TestLoadKeyDirectory_KeepsExistingKeys(t *testing.T) {
+	keys := newTestIssuer(t, AlgorithmEdDSA)
+
+	reloaded, err := LoadKeyDirectory(keys.dir, AlgorithmEdDSA)
+
+	require.NoError(t, err)
+	assert.Equal(t, keys.VerificationKeys(), reloaded.VerificationKeys())
+}
+
+func TestKeyDirectory_TokenSignedBeforeRotationStillVerifies(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmEdDSA, AlgorithmRS256} {
+		t.Run(algorithm, func(t *testing.T) {
+			keys := newTestIssuer(t, algorithm)
+			oldToken, err := GenerateToken("user-1", []string{"customer"})
+			require.NoError(t, err)
+
+			newKID := rotate(t, keys, time.Now().Add(-time.Hour))
+			newToken, err := GenerateToken("user-1", []string{"customer"})
+			require.NoError(t, err)
+
+			assert.Equal(t, newKID, tokenKeyID(t, newToken))
+			assert.NotEqual(t, newKID, tokenKeyID(t, oldToken))
+			for _, token := range []string{oldToken, newToken} {
+				claims, err := ValidateToken(token)
+				require.NoError(t, err)
+				assert.Equal(t, "user-1", claims.UserID)
+			}
+		})
+	}
+}
+
+func TestKeyDirectory_NewKeySignsOnlyAfterActivationDelay(t *testing.T) {
+	keys := newTestIssuer(t, AlgorithmEdDSA)
+	oldKID := keys.VerificationKeys()[0].ID
+
+	newKID := rotate(t, keys, time.Now())
+	token, err := GenerateToken("user-1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, oldKID, tokenKeyID(t, token))
+
+	setKeyCreatedAt(t, keys, newKID, time.Now().Add(-KeyActivationDelay-time.Minute))
+	token, err = GenerateToken("user-1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, newKID, tokenKeyID(t, token))
+}
+
+func TestValidateToken_RejectsUnknownKeyID(t *testing.T) {
+	newTestIssuer(t, AlgorithmEdDSA)
+	_, stranger, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, Claims{
+		UserID: "user-1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "token-1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	})
+	token.Header["kid"] = "unknown"
+	signed, err := token.SignedString(stranger)
+	require.NoError(t, err)
+
+	_, err = ValidateToken(signed)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown key "unknown"`)
+}
+
+func TestValidateToken_RejectsTokenWithoutKeyID(t *testing.T) {
+	keys := newTestIssuer(t, AlgorithmEdDSA)
+	key, err := keys.activeKey()
+	require.NoError(t, err)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, Claims{UserID: "user-1"})
+	signed, err := token.SignedString(key.signer)
+	require.NoError(t, err)
+
+	_, err = ValidateToken(signed)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "missing key ID")
+}
+
+func TestKeyDirectory_PrunedKeyNoLongerVerifies(t *testing.T) {
+	keys := newTestIssuer(t, AlgorithmEdDSA)
+	oldKID := keys.VerificationKeys()[0].ID
+	oldToken, err := GenerateToken("user-1", nil)
+	require.NoError(t, err)
+
+	// The new key replaced the old one longer than AccessTokenTTL ago
+	rotate(t, keys, time.Now().Add(-KeyActivationDelay-AccessTokenTTL-time.Minute))
+	require.NoError(t, keys.Prune())
+
+	require.Len(t, keys.VerificationKeys(), 1)
+	assert.NotEqual(t, oldKID, keys.VerificationKeys()[0].ID)
+	assert.NoFileExists(t, filepath.Join(keys.dir, oldKID+".pem"))
+	_, err = ValidateToken(oldToken)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown key")
+}
+
+func TestKeyDirectory_PruneKeepsKeysThatMaySignUnexpiredTokens(t *testing.T) {
+	keys := newTestIssuer(t, AlgorithmEdDSA)
+	oldToken, err := GenerateToken("user-1", nil)
+	require.NoError(t, err)
+
+	// The new key became active less than AccessTokenTTL ago
+	rotate(t, keys, time.Now().Add(-KeyActivationDelay-AccessTokenTTL/2))
+	require.NoError(t, keys.Prune())
+
+	assert.Len(t, keys.VerificationKeys(), 2)
+	_, err = ValidateToken(oldToken)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// RequestIDHeader carries the ID of a REST request, both ways
+	RequestIDHeader = "X-Request-ID"
+	// requestIDMetadata carries the ID of a request to gRPC services
+	requestIDMetadata = "x-request-id"
+	// maxRequestIDLength bounds the request IDs accepted from clients
+	maxRequestIDLength = 128
+)
+
+type requestIDContextKey struct{}
+
+// RequestIDMiddleware gives every request an ID, keeping the one sent in
+// X-Request-ID if it is valid, and sends it back in the same header.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(ContextWithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// ContextWithRequestID returns a copy of ctx carrying the ID of the request
+// it serves.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestIDFromContext returns the ID stored by ContextWithRequestID, or ""
+// outside of a request.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// UnaryRequestIDClientInterceptor forwards the request ID as "x-request-id"
+// metadata on outgoing gRPC calls
+func UnaryRequestIDClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(outgoingRequestID(ctx), method, req, reply, cc, opts...)
+}
+
+// StreamRequestIDClientInterceptor is the streaming equivalent of
+// UnaryRequestIDClientInterceptor
+func StreamRequestIDClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(outgoingRequestID(ctx), desc, cc, method, opts...)
+}
+
+func outgoingRequestID(ctx context.Context) context.Context {
+	if id := RequestIDFromContext(ctx); id != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, requestIDMetadata, id)
+	}
+	return ctx
+}
+
+// UnaryRequestIDInterceptor stores the request ID of incoming calls in the
+// context, where RequestIDFromContext finds it. Calls without a valid
+// "x-request-id" are given a new ID. The ID is sent back as header metadata.
+func UnaryRequestIDInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	id := incomingRequestID(ctx)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, id))
+	return handler(ContextWithRequestID(ctx, id), req)
+}
+
+// StreamRequestIDInterceptor is the streaming equivalent of
+// UnaryRequestIDInterceptor.
+func StreamRequestIDInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	id := incomingRequestID(ss.Context())
+	_ = ss.SetHeader(metadata.Pairs(requestIDMetadata, id))
+	return handler(srv, WrapServerStream(ss, ContextWithRequestID(ss.Context(), id)))
+}
+
+func incomingRequestID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDMetadata); len(values) > 0 && validRequestID(values[0]) {
+			return values[0]
+		}
+	}
+	return newRequestID()
+}
+
+// validRequestID accepts short IDs of printable ASCII characters, which are
+// safe to log and to send back in a header.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r <= ' ' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditAction is what a mutating call did to a resource.
+type AuditAction string
+
+const (
+	AuditActionCreate      AuditAction = "create"
+	AuditActionUpdate      AuditAction = "update"
+	AuditActionDelete      AuditAction = "delete"
+	AuditActionRestore     AuditAction = "restore"
+	AuditActionAdjustStock AuditAction = "adjust_stock"
+	AuditActionAuthorize   AuditAction = "authorize"
+	AuditActionCapture     AuditAction = "capture"
+	AuditActionRefund      AuditAction = "refund"
+	AuditActionCancel      AuditAction = "cancel"
+	AuditActionFail        AuditAction = "fail"
+)
+
+// AuditResourceType is the kind of resource an audit entry is about.
+type AuditResourceType string
+
+const (
+	AuditResourceProduct AuditResourceType = "product"
+	AuditResourcePayment AuditResourceType = "payment"
+)
+
+// Valid reports whether t is a known resource type.
+func (t AuditResourceType) Valid() bool {
+	switch t {
+	case AuditResourceProduct, AuditResourcePayment:
+		return true
+	}
+	return false
+}
+
+// AuditEntry records one successful mutating call. Entries are never
+// changed or deleted.
+type AuditEntry struct {
+	ID primitive.ObjectID `bson:"_id,omitempty"`
+	// Actor is the user ID of the caller
+	Actor        string            `bson:"actor"`
+	Action       AuditAction       `bson:"action"`
+	ResourceType AuditResourceType `bson:"resource_type"`
+	ResourceID   string            `bson:"resource_id"`
+	// Before and After are the resource as the API returned it before and
+	// after the call. Before is nil for creations and restores, After for
+	// deletions.
+	Before    map[string]interface{} `bson:"before,omitempty"`
+	After     map[string]interface{} `bson:"after,omitempty"`
+	RequestID string                 `bson:"request_id,omitempty"`
+	CreatedAt time.Time              `bson:"created_at"`
+}
+
+// AuditListRequest filters and pages through the audit log.
+type AuditListRequest struct {
+	ListRequest
+	Actor         string            `form:"actor"`
+	Action        AuditAction       `form:"action"`
+	ResourceType  AuditResourceType `form:"resource_type"`
+	ResourceID    string            `form:"resource_id"`
+	RequestID     string            `form:"request_id"`
+	CreatedAfter  time.Time         `form:"created_after"`
+	CreatedBefore time.Time         `form:"created_before"`
+}
+
+type AuditEntryResponse struct {
+	ID           string                 `json:"id"`
+	Actor        string                 `json:"actor"`
+	Action       AuditAction            `json:"action" example:"update"`
+	ResourceType AuditResourceType      `json:"resource_type" example:"product"`
+	ResourceID   string                 `json:"resource_id"`
+	Before       map[string]interface{} `json:"before,omitempty"`
+	After        map[string]interface{} `json:"after,omitempty"`
+	RequestID    string                 `json:"request_id,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+}
+
+type AuditListResponse struct {
+	Entries       []AuditEntryResponse `json:"entries"`
+	NextPageToken string               `json:"next_page_token,omitempty"`
+}
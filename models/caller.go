@@ -0,0 +1,18 @@
+package models
+
+// Caller is the authenticated user a request is made on behalf of.
+type Caller struct {
+	UserID string
+	Roles  []string
+}
+
+// IsAdmin reports whether the caller has the admin role, which lifts the
+// ownership checks on payments.
+func (c Caller) IsAdmin() bool {
+	for _, role := range c.Roles {
+		if role == RoleAdmin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// JobState is the schedule, lease and last run of a scheduled job. It is
+// shared by every replica running the job scheduler, so restarts keep the
+// schedule and each run happens on one replica only.
+type JobState struct {
+	Name      string    `bson:"_id"`
+	Schedule  string    `bson:"schedule"`
+	NextRunAt time.Time `bson:"next_run_at"`
+	// Paused jobs only run when a run is requested
+	Paused bool `bson:"paused,omitempty"`
+	// RunRequestedAt is set when an admin asks for a run, until a run
+	// starts after it
+	RunRequestedAt *time.Time `bson:"run_requested_at,omitempty"`
+	// LockedBy is the replica running the job until LockedUntil
+	LockedBy    string     `bson:"locked_by,omitempty"`
+	LockedUntil *time.Time `bson:"locked_until,omitempty"`
+	// The last run, unset until the job first ran
+	LastRunBy      string     `bson:"last_run_by,omitempty"`
+	LastStartedAt  *time.Time `bson:"last_started_at,omitempty"`
+	LastFinishedAt *time.Time `bson:"last_finished_at,omitempty"`
+	LastError      string     `bson:"last_error,omitempty"`
+}
+
+type JobResponse struct {
+	Name           string     `json:"name" example:"cleanup"`
+	Schedule       string     `json:"schedule" example:"0 3 * * *"`
+	Paused         bool       `json:"paused"`
+	NextRunAt      time.Time  `json:"next_run_at"`
+	RunRequestedAt *time.Time `json:"run_requested_at,omitempty"`
+	// RunningOn is the replica running the job, if it is running
+	RunningOn      string     `json:"running_on,omitempty"`
+	LastStartedAt  *time.Time `json:"last_started_at,omitempty"`
+	LastFinishedAt *time.Time `json:"last_finished_at,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+}
+
+// JobRunTrigger tells why a job ran
+type JobRunTrigger string
+
+const (
+	JobRunScheduled JobRunTrigger = "schedule"
+	JobRunManual    JobRunTrigger = "manual"
+)
+
+type JobRunStatus string
+
+const (
+	JobRunRunning   JobRunStatus = "running"
+	JobRunSucceeded JobRunStatus = "succeeded"
+	JobRunFailed    JobRunStatus = "failed"
+	// JobRunAbandoned is a run whose replica died or lost the lease of the
+	// job before recording how the run ended
+	JobRunAbandoned JobRunStatus = "abandoned"
+)
+
+// JobRun records one run of a scheduled job. Runs of replicas that died
+// stay running until the job is acquired again, which abandons them.
+type JobRun struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Job        string             `bson:"job"`
+	Trigger    JobRunTrigger      `bson:"trigger"`
+	RunBy      string             `bson:"run_by"`
+	Status     JobRunStatus       `bson:"status"`
+	StartedAt  time.Time          `bson:"started_at"`
+	FinishedAt *time.Time         `bson:"finished_at,omitempty"`
+	Error      string             `bson:"error,omitempty"`
+	// Counts tells what the run did, such as how many documents it deleted
+	Counts map[string]int64 `bson:"counts,omitempty"`
+}
+
+type JobRunResponse struct {
+	ID         string           `json:"id"`
+	Job        string           `json:"job" example:"cleanup"`
+	Trigger    JobRunTrigger    `json:"trigger" example:"schedule"`
+	RunBy      string           `json:"run_by"`
+	Status     JobRunStatus     `json:"status" example:"succeeded"`
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+	DurationMS int64            `json:"duration_ms,omitempty"`
+	Error      string           `json:"error,omitempty"`
+	Counts     map[string]int64 `json:"counts,omitempty"`
+}
+
+type JobRunListResponse struct {
+	Runs          []JobRunResponse `json:"runs"`
+	NextPageToken string           `json:"next_page_token,omitempty"`
+}
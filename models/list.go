@@ -0,0 +1,18 @@
+package models
+
+const (
+	// DefaultPageSize is used when a list request does not set a page size
+	DefaultPageSize = 20
+	// MaxPageSize caps the page size of list requests
+	MaxPageSize = 100
+)
+
+// ListRequest holds the paging and sorting parameters shared by list
+// endpoints.
+type ListRequest struct {
+	PageSize int `form:"page_size" example:"20"`
+	// PageToken is the next_page_token of the previous page
+	PageToken string `form:"page_token"`
+	// Sort names the field to sort by, prefixed with "-" for descending order
+	Sort string `form:"sort" example:"-created_at"`
+}
@@ -0,0 +1,182 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// DefaultCurrency is used when a request does not name a currency, and for
+// amounts stored before currencies were introduced.
+const DefaultCurrency = "USD"
+
+// currencyExponents holds the ISO 4217 minor unit exponent of every
+// supported currency, i.e. the number of decimal places it allows.
+var currencyExponents = map[string]int{
+	"AUD": 2,
+	"BHD": 3,
+	"CAD": 2,
+	"CHF": 2,
+	"CNY": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"HKD": 2,
+	"IDR": 2,
+	"INR": 2,
+	"JOD": 3,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"MYR": 2,
+	"NZD": 2,
+	"OMR": 3,
+	"PHP": 2,
+	"SGD": 2,
+	"THB": 2,
+	"USD": 2,
+	"VND": 0,
+}
+
+// CurrencyExponent returns the number of decimal places allowed by an ISO
+// 4217 currency code.
+func CurrencyExponent(currency string) (int, bool) {
+	exponent, ok := currencyExponents[currency]
+	return exponent, ok
+}
+
+// Money is an exact amount stored as an integer number of minor units of its
+// currency, e.g. {1050, "USD"} is 10.50 US dollars.
+type Money struct {
+	Units    int64  `json:"units" bson:"units"`
+	Currency string `json:"currency" bson:"currency"`
+}
+
+// ParseMoney converts a decimal amount in the given currency to Money. It
+// rejects unknown currencies and amounts with more decimal places than the
+// currency allows.
+func ParseMoney(amount Decimal, currency string) (Money, error) {
+	exponent, ok := CurrencyExponent(currency)
+	if !ok {
+		return Money{}, fmt.Errorf("unsupported currency %q", currency)
+	}
+
+	match := decimalPattern.FindStringSubmatch(string(amount))
+	if match == nil {
+		return Money{}, fmt.Errorf("invalid amount %q", amount)
+	}
+	sign, whole, fraction := match[1], match[2], match[3]
+	if len(fraction) > exponent {
+		return Money{}, fmt.Errorf("%s amounts allow at most %d decimal places", currency, exponent)
+	}
+
+	units, err := strconv.ParseInt(sign+whole+fraction+strings.Repeat("0", exponent-len(fraction)), 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("amount %q is out of range", amount)
+	}
+
+	return Money{Units: units, Currency: currency}, nil
+}
+
+// Decimal formats the amount in major units, e.g. "10.50" for 1050 USD.
+func (m Money) Decimal() Decimal {
+	exponent := currencyExponents[m.Currency]
+	sign := ""
+	units := m.Units
+	if units < 0 {
+		sign = "-"
+		units = -units
+	}
+
+	digits := strconv.FormatInt(units, 10)
+	if exponent == 0 {
+		return Decimal(sign + digits)
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	return Decimal(sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:])
+}
+
+func (m Money) String() string {
+	return string(m.Decimal()) + " " + m.Currency
+}
+
+// Add returns m + other. Both amounts must be in the same currency.
+func (m Money) Add(other Money) Money {
+	return Money{Units: m.Units + other.Units, Currency: m.Currency}
+}
+
+// Sub returns m - other. Both amounts must be in the same currency.
+func (m Money) Sub(other Money) Money {
+	return Money{Units: m.Units - other.Units, Currency: m.Currency}
+}
+
+// Mul returns m multiplied by n.
+func (m Money) Mul(n int64) Money {
+	return Money{Units: m.Units * n, Currency: m.Currency}
+}
+
+// UnmarshalBSONValue decodes Money, accepting the plain doubles that were
+// stored before amounts carried a currency.
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	value := bson.RawValue{Type: t, Value: data}
+	switch t {
+	case bsontype.Double:
+		exponent := currencyExponents[DefaultCurrency]
+		*m = Money{
+			Units:    int64(math.Round(value.Double() * math.Pow10(exponent))),
+			Currency: DefaultCurrency,
+		}
+		return nil
+	case bsontype.EmbeddedDocument:
+		// Decode through a type without this method to avoid recursing
+		type money Money
+		return value.Unmarshal((*money)(m))
+	case bsontype.Null:
+		*m = Money{}
+		return nil
+	default:
+		return fmt.Errorf("cannot decode %s into Money", t)
+	}
+}
+
+var decimalPattern = regexp.MustCompile(`^(-?)(\d+)(?:\.(\d+))?$`)
+
+// Decimal is an exact decimal amount in major units such as "10.50". It is
+// written to JSON as a string and read from either a JSON string or number,
+// without ever going through a float.
+type Decimal string
+
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*d = ""
+		return nil
+	}
+
+	var text string
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	} else {
+		var number json.Number
+		if err := json.Unmarshal(data, &number); err != nil {
+			return err
+		}
+		text = number.String()
+	}
+
+	if !decimalPattern.MatchString(text) {
+		return fmt.Errorf("invalid decimal amount %q", text)
+	}
+	*d = Decimal(text)
+	return nil
+}
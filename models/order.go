@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OrderStatus string
+
+const (
+	OrderStatusPending    OrderStatus = "pending"
+	OrderStatusProcessing OrderStatus = "processing"
+	// OrderStatusAwaitingPayment orders have a payment that is not
+	// captured yet, and keep their stock reserved until it is settled
+	OrderStatusAwaitingPayment OrderStatus = "awaiting_payment"
+	OrderStatusPaid            OrderStatus = "paid"
+	// OrderStatusCancelled orders had their payment fail or cancelled
+	OrderStatusCancelled OrderStatus = "cancelled"
+)
+
+type OrderItem struct {
+	ProductID primitive.ObjectID `json:"product_id" bson:"product_id"`
+	Name      string             `json:"name" bson:"name"`
+	Quantity  int                `json:"quantity" bson:"quantity" validate:"required,gt=0"`
+	Price     Money              `json:"price" bson:"price"`
+}
+
+type Order struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Items     []OrderItem        `json:"items" bson:"items" validate:"required,min=1"`
+	Total     Money              `json:"total" bson:"total"`
+	Status    OrderStatus        `json:"status" bson:"status"`
+	PaymentID string             `json:"payment_id,omitempty" bson:"payment_id,omitempty"`
+	// OwnerID is the user who created the order. Orders created before
+	// ownership was recorded have none and are only visible to admins.
+	OwnerID string `json:"owner_id,omitempty" bson:"owner_id,omitempty"`
+	// ReservedUntil is when the stock held for a pending order is released
+	ReservedUntil *time.Time `json:"reserved_until,omitempty" bson:"reserved_until,omitempty"`
+}
+
+type OrderItemRequest struct {
+	ProductID string `json:"product_id" validate:"required"`
+	Quantity  int    `json:"quantity" validate:"required,gt=0"`
+}
+
+type OrderRequest struct {
+	Items []OrderItemRequest `json:"items" validate:"required,min=1"`
+}
+
+type OrderItemResponse struct {
+	ProductID string  `json:"product_id"`
+	Name      string  `json:"name"`
+	Quantity  int     `json:"quantity"`
+	Price     Decimal `json:"price" swaggertype:"string" example:"10.50"`
+}
+
+type OrderResponse struct {
+	ID        string              `json:"id"`
+	Items     []OrderItemResponse `json:"items"`
+	Total     Decimal             `json:"total" swaggertype:"string" example:"21.00"`
+	Currency  string              `json:"currency" example:"USD"`
+	Status    OrderStatus         `json:"status"`
+	PaymentID string              `json:"payment_id,omitempty"`
+	OwnerID   string              `json:"owner_id,omitempty"`
+	// ReservedUntil is when the stock held for a pending order is
+	// released. Checking out later reserves it again if it is still
+	// available.
+	ReservedUntil *time.Time `json:"reserved_until,omitempty"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OutboxEntry records a change to a payment. It is written together with
+// the change, so the change reaches downstream consumers even if the
+// process dies right after making it.
+type OutboxEntry struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Type      PaymentEventType   `bson:"type"`
+	PaymentID primitive.ObjectID `bson:"payment_id"`
+	// Payment is the payment after the change, or before it for deletions
+	Payment   *Payment  `bson:"payment,omitempty"`
+	CreatedAt time.Time `bson:"created_at"`
+	// LockedUntil is set while a worker processes the entry
+	LockedUntil *time.Time `bson:"locked_until,omitempty"`
+	// PublishedTo names the publishers the entry has been published to
+	PublishedTo []string `bson:"published_to,omitempty"`
+	// ProcessedAt is set once the entry has been published everywhere
+	ProcessedAt *time.Time `bson:"processed_at,omitempty"`
+}
+
+// Published reports whether the entry has been published to publisher.
+func (e *OutboxEntry) Published(publisher string) bool {
+	for _, name := range e.PublishedTo {
+		if name == publisher {
+			return true
+		}
+	}
+	return false
+}
+
+// PaymentEventMessage is the JSON form of a payment change, as POSTed to
+// webhooks and published by the outbox relay.
+type PaymentEventMessage struct {
+	// ID identifies the event; every retry of it repeats the same ID
+	ID        string           `json:"id"`
+	Type      WebhookEventType `json:"type"`
+	CreatedAt time.Time        `json:"created_at"`
+	PaymentID string           `json:"payment_id"`
+	// Payment is the payment after the change, or before it for deletions
+	Payment *PaymentResponse `json:"payment,omitempty"`
+}
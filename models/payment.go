@@ -1,19 +1,93 @@
 package models
 
 import (
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+type PaymentStatus string
+
+const (
+	PaymentStatusPending    PaymentStatus = "pending"
+	PaymentStatusAuthorized PaymentStatus = "authorized"
+	PaymentStatusCaptured   PaymentStatus = "captured"
+	PaymentStatusRefunded   PaymentStatus = "refunded"
+	PaymentStatusFailed     PaymentStatus = "failed"
+	PaymentStatusCancelled  PaymentStatus = "cancelled"
+)
+
+// Valid reports whether s is one of the known payment statuses.
+func (s PaymentStatus) Valid() bool {
+	switch s {
+	case PaymentStatusPending, PaymentStatusAuthorized, PaymentStatusCaptured,
+		PaymentStatusRefunded, PaymentStatusFailed, PaymentStatusCancelled:
+		return true
+	}
+	return false
+}
+
 type Payment struct {
-	ID     primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Amount float64            `json:"amount" bson:"amount" validate:"required,gt=0"`
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Amount         Money              `json:"amount" bson:"amount" validate:"required"`
+	Status         PaymentStatus      `json:"status" bson:"status"`
+	RefundedAmount Money              `json:"refunded_amount" bson:"refunded_amount"`
+	IdempotencyKey string             `json:"-" bson:"idempotency_key,omitempty"`
+	RequestHash    string             `json:"-" bson:"request_hash,omitempty"`
+	// OwnerID is the user who created the payment. Payments created before
+	// ownership was recorded have none and are only visible to admins.
+	OwnerID string `json:"owner_id,omitempty" bson:"owner_id,omitempty"`
+	// CreatedAt and UpdatedAt are unset on payments stored before they were
+	// recorded, which were created at the time in their ID
+	CreatedAt time.Time `json:"created_at" bson:"created_at,omitempty"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at,omitempty"`
+	// DeletedAt is set on deleted payments, which can be restored until
+	// they are purged
+	DeletedAt *time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
 }
 
 type PaymentRequest struct {
-	Amount float64 `json:"amount" validate:"required,gt=0"`
+	Amount Decimal `json:"amount" validate:"required" swaggertype:"string" example:"10.50"`
+	// Currency is an ISO 4217 code and defaults to DefaultCurrency
+	Currency string `json:"currency" example:"USD"`
+	// IdempotencyKey is taken from the Idempotency-Key header or the gRPC
+	// request, never from the JSON body
+	IdempotencyKey string `json:"-"`
 }
 
 type PaymentResponse struct {
-	ID     string  `json:"id"`
-	Amount float64 `json:"amount"`
+	ID             string        `json:"id"`
+	Amount         Decimal       `json:"amount" swaggertype:"string" example:"10.50"`
+	Currency       string        `json:"currency" example:"USD"`
+	Status         PaymentStatus `json:"status"`
+	RefundedAmount Decimal       `json:"refunded_amount" swaggertype:"string" example:"0.00"`
+	OwnerID        string        `json:"owner_id,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+	// DeletedAt is only set on deleted payments, which admins can list
+	// with include_deleted
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// PaymentListRequest filters and pages through payments. The amount range is
+// in Currency, which defaults to DefaultCurrency when a bound is given.
+type PaymentListRequest struct {
+	ListRequest
+	// OwnerID filters by owner. It only applies to admins; everyone else
+	// only ever sees their own payments.
+	OwnerID       string        `form:"owner_id"`
+	Status        PaymentStatus `form:"status"`
+	MinAmount     Decimal       `form:"min_amount"`
+	MaxAmount     Decimal       `form:"max_amount"`
+	Currency      string        `form:"currency"`
+	CreatedAfter  time.Time     `form:"created_after"`
+	CreatedBefore time.Time     `form:"created_before"`
+	// IncludeDeleted also lists deleted payments. It only applies to
+	// admins.
+	IncludeDeleted bool `form:"include_deleted"`
+}
+
+type PaymentListResponse struct {
+	Payments      []PaymentResponse `json:"payments"`
+	NextPageToken string            `json:"next_page_token,omitempty"`
 }
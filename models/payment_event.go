@@ -0,0 +1,33 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type PaymentEventType string
+
+const (
+	PaymentEventCreated PaymentEventType = "created"
+	PaymentEventUpdated PaymentEventType = "updated"
+	PaymentEventDeleted PaymentEventType = "deleted"
+	// PaymentEventRestored is a deleted payment being restored
+	PaymentEventRestored PaymentEventType = "restored"
+)
+
+// PaymentEvent is a change to a payment.
+type PaymentEvent struct {
+	Type      PaymentEventType
+	PaymentID primitive.ObjectID
+	// Payment is the payment after the change, or before it for deletions
+	// that removed it for good.
+	// It is nil when that state is not known.
+	Payment *Payment
+	// ResumeToken identifies the position of the event in the stream of
+	// changes, so watching can continue right after it.
+	ResumeToken string
+}
+
+type PaymentEventResponse struct {
+	Type        PaymentEventType `json:"type"`
+	PaymentID   string           `json:"payment_id"`
+	Payment     *PaymentResponse `json:"payment,omitempty"`
+	ResumeToken string           `json:"resume_token"`
+}
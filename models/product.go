@@ -1,22 +1,143 @@
 package models
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Product struct {
 	ID    primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	Name  string             `json:"name" bson:"name" validate:"required"`
-	Price float64            `json:"price" bson:"price" validate:"required,gt=0"`
+	Price Money              `json:"price" bson:"price" validate:"required"`
+	// CreatedAt and UpdatedAt are unset on products stored before they were
+	// recorded, which were created at the time in their ID
+	CreatedAt time.Time `json:"created_at" bson:"created_at,omitempty"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at,omitempty"`
+	// Stock is the quantity on hand, reserved units included. Products
+	// stored before stock was tracked have none and are not limited until
+	// their stock is first adjusted.
+	Stock *int64 `json:"stock,omitempty" bson:"stock,omitempty"`
+	// Reserved is the quantity held by Reservations
+	Reserved     int64              `json:"reserved" bson:"reserved,omitempty"`
+	Reservations []StockReservation `json:"reservations,omitempty" bson:"reservations,omitempty"`
+	// Version counts the updates to the name and price, so that concurrent
+	// edits cannot overwrite each other. Stock changes do not count. It is
+	// 0 for products stored before it was recorded.
+	Version int64 `json:"version" bson:"version,omitempty"`
+	// DeletedAt is set on deleted products, which can be restored until
+	// they are purged
+	DeletedAt *time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+}
+
+// Available returns the quantity that can still be reserved, or nil if the
+// product is not limited.
+func (p *Product) Available() *int64 {
+	if p.Stock == nil {
+		return nil
+	}
+	available := *p.Stock - p.Reserved
+	return &available
+}
+
+// StockReservation holds units of a product, for an order, until it expires.
+type StockReservation struct {
+	ID        primitive.ObjectID `json:"id" bson:"id"`
+	Quantity  int64              `json:"quantity" bson:"quantity"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
 }
 
 type ProductRequest struct {
 	Name  string  `json:"name" validate:"required"`
-	Price float64 `json:"price" validate:"required,gt=0"`
+	Price Decimal `json:"price" validate:"required" swaggertype:"string" example:"10.50"`
+	// Currency is an ISO 4217 code and defaults to DefaultCurrency
+	Currency string `json:"currency" example:"USD"`
+	// Stock is the initial stock of a new product. Updates ignore it; stock
+	// is changed through stock adjustments.
+	Stock int64 `json:"stock" example:"100"`
+}
+
+// ProductPatch is a JSON Merge Patch (RFC 7396) of a product. Absent fields
+// are left unchanged. None of them can be removed, so null is rejected, and
+// stock is changed through stock adjustments instead.
+type ProductPatch struct {
+	Name  *string  `json:"name,omitempty" example:"Mechanical keyboard"`
+	Price *Decimal `json:"price,omitempty" swaggertype:"string" example:"12.50"`
+	// Currency changes the currency of the current price, or of Price if
+	// it is patched too
+	Currency *string `json:"currency,omitempty" example:"USD"`
+}
+
+func (p *ProductPatch) UnmarshalJSON(data []byte) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil || members == nil {
+		return fmt.Errorf("merge patch must be a JSON object")
+	}
+
+	*p = ProductPatch{}
+	for name, value := range members {
+		var target any
+		switch name {
+		case "name":
+			target = &p.Name
+		case "price":
+			target = &p.Price
+		case "currency":
+			target = &p.Currency
+		case "stock":
+			return fmt.Errorf("stock is changed through stock adjustments")
+		default:
+			return fmt.Errorf("%s cannot be patched", name)
+		}
+		if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			return fmt.Errorf("%s cannot be removed", name)
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
 }
 
 type ProductResponse struct {
-	ID    string  `json:"id"`
-	Name  string  `json:"name"`
-	Price float64 `json:"price"`
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Price     Decimal   `json:"price" swaggertype:"string" example:"10.50"`
+	Currency  string    `json:"currency" example:"USD"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Stock and Available are omitted for products whose stock is not
+	// tracked, which are not limited
+	Stock     *int64 `json:"stock,omitempty" example:"100"`
+	Reserved  int64  `json:"reserved" example:"5"`
+	Available *int64 `json:"available,omitempty" example:"95"`
+	// Version is also sent as the ETag of the product. Updates must send
+	// it back in If-Match.
+	Version int64 `json:"version" example:"3"`
+	// DeletedAt is only set on deleted products, which admins can list
+	// with include_deleted
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// ProductListRequest filters and pages through products. The price range is
+// in Currency, which defaults to DefaultCurrency when a bound is given.
+type ProductListRequest struct {
+	ListRequest
+	NamePrefix    string    `form:"name_prefix"`
+	MinPrice      Decimal   `form:"min_price"`
+	MaxPrice      Decimal   `form:"max_price"`
+	Currency      string    `form:"currency"`
+	CreatedAfter  time.Time `form:"created_after"`
+	CreatedBefore time.Time `form:"created_before"`
+	// IncludeDeleted also lists deleted products. It only applies to
+	// admins.
+	IncludeDeleted bool `form:"include_deleted"`
+}
+
+type ProductListResponse struct {
+	Products      []ProductResponse `json:"products"`
+	NextPageToken string            `json:"next_page_token,omitempty"`
 }
@@ -0,0 +1,33 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type ProductEventType string
+
+const (
+	ProductEventCreated ProductEventType = "created"
+	ProductEventUpdated ProductEventType = "updated"
+	ProductEventDeleted ProductEventType = "deleted"
+	// ProductEventRestored is a deleted product being restored
+	ProductEventRestored ProductEventType = "restored"
+)
+
+// ProductEvent is a change to a product.
+type ProductEvent struct {
+	Type      ProductEventType
+	ProductID primitive.ObjectID
+	// Product is the product after the change, or before it for deletions
+	// that removed it for good.
+	// It is nil when that state is not known.
+	Product *Product
+	// ResumeToken identifies the position of the event in the stream of
+	// changes, so watching can continue right after it.
+	ResumeToken string
+}
+
+type ProductEventResponse struct {
+	Type        ProductEventType `json:"type"`
+	ProductID   string           `json:"product_id"`
+	Product     *ProductResponse `json:"product,omitempty"`
+	ResumeToken string           `json:"resume_token"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Refund struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	PaymentID primitive.ObjectID `json:"payment_id" bson:"payment_id"`
+	Amount    Money              `json:"amount" bson:"amount" validate:"required"`
+	Reason    string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// RefundRequest refunds part of a payment in the payment's currency. An
+// empty amount refunds whatever is left of the payment.
+type RefundRequest struct {
+	Amount Decimal `json:"amount" swaggertype:"string" example:"5.00"`
+	// Currency is optional but must match the payment's currency if set
+	Currency string `json:"currency,omitempty" example:"USD"`
+	Reason   string `json:"reason"`
+}
+
+type RefundResponse struct {
+	ID        string    `json:"id"`
+	PaymentID string    `json:"payment_id"`
+	Amount    Decimal   `json:"amount" swaggertype:"string" example:"5.00"`
+	Currency  string    `json:"currency" example:"USD"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
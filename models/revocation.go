@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TokenRevocation revokes access tokens before they expire. It names either
+// a single token by its jti claim, or a user, in which case every token
+// issued to that user up to RevokedAt is revoked. It is kept until every
+// token it can match has expired.
+type TokenRevocation struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	JTI       string             `bson:"jti,omitempty"`
+	UserID    string             `bson:"user_id,omitempty"`
+	Reason    string             `bson:"reason,omitempty"`
+	RevokedBy string             `bson:"revoked_by"`
+	RevokedAt time.Time          `bson:"revoked_at"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+}
+
+// RevocationRequest names exactly one of JTI and UserID.
+type RevocationRequest struct {
+	JTI    string `json:"jti" example:"3f1c9a0d5b7e4f2a8c6d1e0b9a7f5c3d"`
+	UserID string `json:"user_id" example:"665f1c2e8b3a4d5e6f708192"`
+	Reason string `json:"reason" example:"account compromised"`
+}
+
+type RevocationResponse struct {
+	ID        string    `json:"id"`
+	JTI       string    `json:"jti,omitempty"`
+	UserID    string    `json:"user_id,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	RevokedBy string    `json:"revoked_by"`
+	RevokedAt time.Time `json:"revoked_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StockAdjustmentReason tells why the stock of a product was adjusted.
+type StockAdjustmentReason string
+
+const (
+	StockReasonRestock    StockAdjustmentReason = "restock"
+	StockReasonReturn     StockAdjustmentReason = "return"
+	StockReasonDamaged    StockAdjustmentReason = "damaged"
+	StockReasonLost       StockAdjustmentReason = "lost"
+	StockReasonCorrection StockAdjustmentReason = "correction"
+)
+
+// Valid reports whether r is a known adjustment reason.
+func (r StockAdjustmentReason) Valid() bool {
+	switch r {
+	case StockReasonRestock, StockReasonReturn, StockReasonDamaged, StockReasonLost, StockReasonCorrection:
+		return true
+	}
+	return false
+}
+
+// StockAdjustment records a manual change to the stock of a product. Sales
+// are not adjustments; they take units out of stock by committing the
+// reservations of paid orders.
+type StockAdjustment struct {
+	ID        primitive.ObjectID    `bson:"_id,omitempty"`
+	ProductID primitive.ObjectID    `bson:"product_id"`
+	Delta     int64                 `bson:"delta"`
+	Reason    StockAdjustmentReason `bson:"reason"`
+	Note      string                `bson:"note,omitempty"`
+	// StockAfter is the stock right after the adjustment
+	StockAfter int64     `bson:"stock_after"`
+	AdjustedBy string    `bson:"adjusted_by"`
+	CreatedAt  time.Time `bson:"created_at"`
+}
+
+type StockAdjustmentRequest struct {
+	// Delta is added to the stock, so it is negative to remove units
+	Delta  int64                 `json:"delta" example:"25"`
+	Reason StockAdjustmentReason `json:"reason" example:"restock"`
+	Note   string                `json:"note,omitempty" example:"Weekly delivery"`
+}
+
+type StockAdjustmentResponse struct {
+	ID         string                `json:"id"`
+	ProductID  string                `json:"product_id"`
+	Delta      int64                 `json:"delta" example:"25"`
+	Reason     StockAdjustmentReason `json:"reason" example:"restock"`
+	Note       string                `json:"note,omitempty"`
+	StockAfter int64                 `json:"stock_after" example:"125"`
+	AdjustedBy string                `json:"adjusted_by"`
+	CreatedAt  time.Time             `json:"created_at"`
+}
+
+type StockAdjustmentListResponse struct {
+	Adjustments   []StockAdjustmentResponse `json:"adjustments"`
+	NextPageToken string                    `json:"next_page_token,omitempty"`
+}
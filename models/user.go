@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// RoleCustomer is granted to every registered user
+	RoleCustomer = "customer"
+	// RoleAdmin is granted to staff, who manage the catalog and payments
+	RoleAdmin = "admin"
+)
+
+type User struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Email        string             `json:"email" bson:"email"`
+	PasswordHash string             `json:"-" bson:"password_hash"`
+	Roles        []string           `json:"roles" bson:"roles"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// RefreshToken is the server-side record of a refresh token. Only a hash of
+// the token is stored. Every refresh replaces the token with a new one in the
+// same family, so a family represents one login session.
+type RefreshToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	FamilyID  primitive.ObjectID `bson:"family_id"`
+	TokenHash string             `bson:"token_hash"`
+	CreatedAt time.Time          `bson:"created_at"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+	RevokedAt *time.Time         `bson:"revoked_at,omitempty"`
+}
+
+type RegisterRequest struct {
+	Email    string `json:"email" binding:"required" example:"jane@example.com"`
+	Password string `json:"password" binding:"required" example:"correct horse battery staple"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required" example:"jane@example.com"`
+	Password string `json:"password" binding:"required"`
+}
+
+// RefreshRequest carries the refresh token for POST /refresh and /logout.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// UserRolesRequest replaces the roles of a user. Every user keeps the
+// customer role, so only whether admin is listed matters today.
+type UserRolesRequest struct {
+	Roles []string `json:"roles" binding:"required" example:"customer,admin"`
+}
+
+type UserResponse struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Roles     []string  `json:"roles"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Session is the result of a login or refresh: the user it authenticates,
+// their current roles and the refresh token that continues it.
+type Session struct {
+	UserID                string
+	Roles                 []string
+	RefreshToken          string
+	RefreshTokenExpiresAt time.Time
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type" example:"Bearer"`
+	ExpiresIn    int    `json:"expires_in" example:"900"`
+	RefreshToken string `json:"refresh_token"`
+}
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WebhookEventType names the payment changes a webhook can subscribe to.
+type WebhookEventType string
+
+const (
+	WebhookEventPaymentCreated  WebhookEventType = "payment.created"
+	WebhookEventPaymentUpdated  WebhookEventType = "payment.updated"
+	WebhookEventPaymentDeleted  WebhookEventType = "payment.deleted"
+	WebhookEventPaymentRestored WebhookEventType = "payment.restored"
+)
+
+// Valid reports whether t is one of the known webhook event types.
+func (t WebhookEventType) Valid() bool {
+	switch t {
+	case WebhookEventPaymentCreated, WebhookEventPaymentUpdated, WebhookEventPaymentDeleted, WebhookEventPaymentRestored:
+		return true
+	}
+	return false
+}
+
+// Webhook subscribes an external URL to payment changes.
+type Webhook struct {
+	ID  primitive.ObjectID `bson:"_id,omitempty"`
+	URL string             `bson:"url"`
+	// Secret keys the HMAC-SHA256 signature of every delivery
+	Secret string `bson:"secret"`
+	// Events lists the event types delivered, or every type if empty
+	Events    []WebhookEventType `bson:"events,omitempty"`
+	Active    bool               `bson:"active"`
+	CreatedBy string             `bson:"created_by"`
+	CreatedAt time.Time          `bson:"created_at"`
+}
+
+// Subscribes reports whether the webhook receives events of type t.
+func (w *Webhook) Subscribes(t WebhookEventType) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, event := range w.Events {
+		if event == t {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookRequest struct {
+	URL string `json:"url" example:"https://erp.example.com/hooks/payments"`
+	// Events lists the event types to deliver, or every type if empty
+	Events []WebhookEventType `json:"events" example:"payment.created"`
+	// Active defaults to true on creation and is left unchanged on update
+	// when omitted
+	Active *bool `json:"active" example:"true"`
+}
+
+type WebhookResponse struct {
+	ID     string             `json:"id"`
+	URL    string             `json:"url"`
+	Events []WebhookEventType `json:"events"`
+	Active bool               `json:"active"`
+	// Secret is only returned when the webhook is created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered"
+	// WebhookDeliveryFailed deliveries ran out of attempts and are kept as
+	// dead letters until they are retried
+	WebhookDeliveryFailed WebhookDeliveryStatus = "failed"
+)
+
+// Valid reports whether s is one of the known delivery statuses.
+func (s WebhookDeliveryStatus) Valid() bool {
+	switch s {
+	case WebhookDeliveryPending, WebhookDeliveryDelivered, WebhookDeliveryFailed:
+		return true
+	}
+	return false
+}
+
+// WebhookDelivery is one event on its way to one webhook.
+type WebhookDelivery struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	WebhookID primitive.ObjectID `bson:"webhook_id"`
+	// EventID is the ID of the outbox entry the event was created from
+	EventID   primitive.ObjectID `bson:"event_id"`
+	EventType WebhookEventType   `bson:"event_type"`
+	// Payload is fixed when the delivery is created, so every attempt sends
+	// and signs the same body
+	Payload        string                `bson:"payload"`
+	Status         WebhookDeliveryStatus `bson:"status"`
+	Attempts       int                   `bson:"attempts"`
+	NextAttemptAt  time.Time             `bson:"next_attempt_at"`
+	LastError      string                `bson:"last_error,omitempty"`
+	LastStatusCode int                   `bson:"last_status_code,omitempty"`
+	CreatedAt      time.Time             `bson:"created_at"`
+	DeliveredAt    *time.Time            `bson:"delivered_at,omitempty"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID             string                `json:"id"`
+	WebhookID      string                `json:"webhook_id"`
+	EventID        string                `json:"event_id"`
+	EventType      WebhookEventType      `json:"event_type"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"`
+	NextAttemptAt  *time.Time            `json:"next_attempt_at,omitempty"`
+	LastError      string                `json:"last_error,omitempty"`
+	LastStatusCode int                   `json:"last_status_code,omitempty"`
+	CreatedAt      time.Time             `json:"created_at"`
+	DeliveredAt    *time.Time            `json:"delivered_at,omitempty"`
+}
+
+// WebhookDeliveryListRequest pages through the deliveries of a webhook,
+// newest first by default.
+type WebhookDeliveryListRequest struct {
+	ListRequest
+	Status WebhookDeliveryStatus `form:"status"`
+}
+
+type WebhookDeliveryListResponse struct {
+	Deliveries    []WebhookDeliveryResponse `json:"deliveries"`
+	NextPageToken string                    `json:"next_page_token,omitempty"`
+}
@@ -0,0 +1,269 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SupportsChangeStreams reports whether the deployment behind db supports
+// change streams, which need a replica set or a sharded cluster.
+func SupportsChangeStreams(ctx context.Context, db *mongo.Database) (bool, error) {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := db.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return false, fmt.Errorf("failed to inspect deployment: %w", err)
+	}
+	return hello.SetName != "" || hello.Msg == "isdbgrid", nil
+}
+
+// EnablePreImages makes MongoDB record the state of documents before they
+// change, so deletion events can carry the deleted document. It needs
+// MongoDB 6.0 or later.
+func EnablePreImages(ctx context.Context, collection *mongo.Collection) error {
+	err := collection.Database().RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: collection.Name()},
+		{Key: "changeStreamPreAndPostImages", Value: bson.M{"enabled": true}},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to enable pre-images of %s: %w", collection.Name(), err)
+	}
+	return nil
+}
+
+// change is a decoded change stream event of a collection of T.
+type change[T any] struct {
+	OperationType string `bson:"operationType"`
+	DocumentKey   struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+	// FullDocument is the document after the change, nil for deletions
+	FullDocument *T `bson:"fullDocument"`
+	// FullDocumentBeforeChange is only set when pre-images are enabled
+	FullDocumentBeforeChange *T `bson:"fullDocumentBeforeChange"`
+	// UpdateDescription lists the fields set and removed by updates
+	UpdateDescription struct {
+		UpdatedFields bson.M   `bson:"updatedFields"`
+		RemovedFields []string `bson:"removedFields"`
+	} `bson:"updateDescription"`
+}
+
+// softDeletes reports whether the change is an update marking the document
+// deleted.
+func (c change[T]) softDeletes() bool {
+	_, set := c.UpdateDescription.UpdatedFields["deleted_at"]
+	return c.OperationType == "update" && set
+}
+
+// restores reports whether the change is an update removing the deleted
+// mark of the document.
+func (c change[T]) restores() bool {
+	if c.OperationType != "update" {
+		return false
+	}
+	for _, field := range c.UpdateDescription.RemovedFields {
+		if field == "deleted_at" {
+			return true
+		}
+	}
+	return false
+}
+
+// Server error codes that mean a resume token can no longer be used:
+// InvalidResumeToken, ChangeStreamFatalError and ChangeStreamHistoryLost.
+var expiredResumeTokenCodes = []int{260, 280, 286}
+
+// watchChanges opens a change stream on the inserts, updates, replacements
+// and deletions of collection and calls fn with every change and its resume
+// token until ctx is done or fn returns an error.
+func watchChanges[T any](ctx context.Context, collection *mongo.Collection, resumeToken string, fn func(change[T], string) error) error {
+	opts := options.ChangeStream().
+		SetFullDocument(options.UpdateLookup).
+		SetFullDocumentBeforeChange(options.WhenAvailable)
+	if resumeToken != "" {
+		token, err := base64.RawURLEncoding.DecodeString(resumeToken)
+		if err != nil || bson.Raw(token).Validate() != nil {
+			return fmt.Errorf("%w: malformed resume token", ErrInvalidQuery)
+		}
+		opts.SetResumeAfter(bson.Raw(token))
+	}
+
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{
+		"operationType": bson.M{"$in": bson.A{"insert", "update", "replace", "delete"}},
+	}}}}
+	stream, err := collection.Watch(ctx, pipeline, opts)
+	if err != nil {
+		return changeStreamError(collection, err)
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		var event change[T]
+		if err := stream.Decode(&event); err != nil {
+			return fmt.Errorf("failed to decode %s change: %w", collection.Name(), err)
+		}
+		if err := fn(event, base64.RawURLEncoding.EncodeToString(stream.ResumeToken())); err != nil {
+			return err
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return changeStreamError(collection, stream.Err())
+}
+
+func changeStreamError(collection *mongo.Collection, err error) error {
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) {
+		for _, code := range expiredResumeTokenCodes {
+			if serverErr.HasErrorCode(code) {
+				return fmt.Errorf("failed to watch %s: %w", collection.Name(), ErrResumeTokenExpired)
+			}
+		}
+	}
+	return fmt.Errorf("failed to watch %s: %w", collection.Name(), err)
+}
+
+// Sizes of the in-process event buffers. The backlog bounds how far back
+// a client can resume; a subscriber that falls further behind than its
+// queue is disconnected and resumes from the backlog.
+const (
+	eventBacklog    = 1000
+	subscriberQueue = 64
+)
+
+var errWatcherFellBehind = errors.New("watcher fell behind")
+
+// broadcaster publishes events of type E to the watchers in the same
+// process. It is the fallback for standalone MongoDB servers, which have no
+// change streams, and only sees the changes made by this process.
+type broadcaster[E any] struct {
+	// setResumeToken stores the resume token of an event in it
+	setResumeToken func(event *E, token string)
+
+	mu          sync.Mutex
+	epoch       uint64 // identifies this process in resume tokens
+	sequence    uint64
+	backlog     []E
+	subscribers map[chan E]struct{}
+}
+
+func newBroadcaster[E any](setResumeToken func(event *E, token string)) *broadcaster[E] {
+	var epoch [8]byte
+	_, _ = rand.Read(epoch[:])
+
+	return &broadcaster[E]{
+		setResumeToken: setResumeToken,
+		epoch:          binary.BigEndian.Uint64(epoch[:]),
+		subscribers:    make(map[chan E]struct{}),
+	}
+}
+
+func (b *broadcaster[E]) publish(event E) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sequence++
+	b.setResumeToken(&event, b.resumeToken(b.sequence))
+
+	b.backlog = append(b.backlog, event)
+	if len(b.backlog) > eventBacklog {
+		b.backlog = b.backlog[len(b.backlog)-eventBacklog:]
+	}
+
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			close(subscriber)
+			delete(b.subscribers, subscriber)
+		}
+	}
+}
+
+// watch calls fn for every event published after resumeToken, or from now
+// if it is empty, until ctx is done or fn returns an error.
+func (b *broadcaster[E]) watch(ctx context.Context, resumeToken string, fn func(E) error) error {
+	subscriber := make(chan E, subscriberQueue)
+
+	b.mu.Lock()
+	missed, err := b.eventsAfter(resumeToken)
+	if err != nil {
+		b.mu.Unlock()
+		return err
+	}
+	b.subscribers[subscriber] = struct{}{}
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		if _, ok := b.subscribers[subscriber]; ok {
+			close(subscriber)
+			delete(b.subscribers, subscriber)
+		}
+		b.mu.Unlock()
+	}()
+
+	for _, event := range missed {
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-subscriber:
+			if !ok {
+				return errWatcherFellBehind
+			}
+			if err := fn(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// eventsAfter returns the backlog after the event resumeToken was issued
+// for. It must be called with b.mu held.
+func (b *broadcaster[E]) eventsAfter(resumeToken string) ([]E, error) {
+	if resumeToken == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(resumeToken)
+	if err != nil || len(data) != 16 {
+		return nil, fmt.Errorf("%w: malformed resume token", ErrInvalidQuery)
+	}
+	epoch, sequence := binary.BigEndian.Uint64(data[:8]), binary.BigEndian.Uint64(data[8:])
+
+	// Tokens from before a restart, or older than the backlog, cannot be
+	// resumed from
+	oldest := b.sequence - uint64(len(b.backlog))
+	if epoch != b.epoch || sequence < oldest || sequence > b.sequence {
+		return nil, ErrResumeTokenExpired
+	}
+
+	missed := b.backlog[len(b.backlog)-int(b.sequence-sequence):]
+	return append([]E(nil), missed...), nil
+}
+
+func (b *broadcaster[E]) resumeToken(sequence uint64) string {
+	var data [16]byte
+	binary.BigEndian.PutUint64(data[:8], b.epoch)
+	binary.BigEndian.PutUint64(data[8:], sequence)
+	return base64.RawURLEncoding.EncodeToString(data[:])
+}
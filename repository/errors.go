@@ -0,0 +1,22 @@
+package repository
+
+import "errors"
+
+var (
+	// ErrNotFound is returned when a document matching the query does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicateKey is returned when a write violates a unique index.
+	ErrDuplicateKey = errors.New("duplicate key")
+	// ErrInvalidQuery is returned for an unknown sort field or a malformed
+	// page token.
+	ErrInvalidQuery = errors.New("invalid query")
+	// ErrResumeTokenExpired is returned when watching resumes from a
+	// position that is no longer retained.
+	ErrResumeTokenExpired = errors.New("resume token expired")
+	// ErrInsufficientStock is returned when a product has fewer units
+	// available than a reservation or stock adjustment needs.
+	ErrInsufficientStock = errors.New("insufficient stock")
+	// ErrVersionMismatch is returned when a document changed since the
+	// version an update was based on.
+	ErrVersionMismatch = errors.New("version mismatch")
+)
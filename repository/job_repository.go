@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type JobRepository interface {
+	// Register creates the state of a job with its first run at nextRunAt.
+	// A job registered before keeps its state, unless its schedule changed,
+	// in which case its next run moves to nextRunAt.
+	Register(ctx context.Context, name, schedule string, nextRunAt time.Time) error
+	// Acquire leases a job to owner for lease if it is due and not paused,
+	// or if a run was requested, and it is not leased to another owner. A
+	// lease whose owner died expires, so the job is acquired again. It fails
+	// with ErrNotFound when the job is not due or already leased.
+	Acquire(ctx context.Context, name, owner string, lease time.Duration) (*models.JobState, error)
+	// Renew extends the lease of owner. It fails with ErrNotFound once the
+	// lease has been lost.
+	Renew(ctx context.Context, name, owner string, lease time.Duration) error
+	// Finish records the last run and next run of a job and releases the
+	// lease of job.LockedBy. A run requested before the last run started is
+	// cleared. It fails with ErrNotFound once the lease has been lost.
+	Finish(ctx context.Context, job *models.JobState) error
+	// RequestRun asks for a run of a job as soon as possible, even if it is
+	// paused. A job that is running runs again once it is done.
+	RequestRun(ctx context.Context, name string) (*models.JobState, error)
+	SetPaused(ctx context.Context, name string, paused bool) (*models.JobState, error)
+	FindAll(ctx context.Context) ([]models.JobState, error)
+	FindByName(ctx context.Context, name string) (*models.JobState, error)
+}
+
+type jobRepository struct {
+	collection *mongo.Collection
+}
+
+func NewJobRepository(collection *mongo.Collection) JobRepository {
+	return &jobRepository{
+		collection: collection,
+	}
+}
+
+func (r *jobRepository) Register(ctx context.Context, name, schedule string, nextRunAt time.Time) error {
+	// Jobs that exist with the same schedule do not match, so the upsert
+	// tries to insert them again and fails on their ID
+	filter := bson.M{"_id": name, "schedule": bson.M{"$ne": schedule}}
+	update := bson.M{"$set": bson.M{"schedule": schedule, "next_run_at": nextRunAt}}
+	_, err := r.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to register job %s: %w", name, err)
+	}
+	return nil
+}
+
+func (r *jobRepository) Acquire(ctx context.Context, name, owner string, lease time.Duration) (*models.JobState, error) {
+	now := time.Now()
+	filter := bson.M{
+		"_id": name,
+		"$and": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{"next_run_at": bson.M{"$lte": now}, "paused": bson.M{"$ne": true}},
+				bson.M{"run_requested_at": bson.M{"$lte": now}},
+			}},
+			bson.M{"$or": bson.A{
+				bson.M{"locked_until": nil},
+				bson.M{"locked_until": bson.M{"$lte": now}},
+			}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"locked_by": owner, "locked_until": now.Add(lease)}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var job models.JobState
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("due job %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to acquire job %s: %w", name, err)
+	}
+	return &job, nil
+}
+
+func (r *jobRepository) Renew(ctx context.Context, name, owner string, lease time.Duration) error {
+	update := bson.M{"$set": bson.M{"locked_until": time.Now().Add(lease)}}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": name, "locked_by": owner}, update)
+	if err != nil {
+		return fmt.Errorf("failed to renew job %s: %w", name, err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("job lease %w", ErrNotFound)
+	}
+	return nil
+}
+
+func (r *jobRepository) Finish(ctx context.Context, job *models.JobState) error {
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"next_run_at":      job.NextRunAt,
+			"last_run_by":      job.LastRunBy,
+			"last_started_at":  job.LastStartedAt,
+			"last_finished_at": job.LastFinishedAt,
+			"last_error":       bson.M{"$literal": job.LastError},
+			"run_requested_at": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{"$run_requested_at", job.LastStartedAt}},
+				"$run_requested_at",
+				"$$REMOVE",
+			}},
+		}}},
+		{{Key: "$unset", Value: bson.A{"locked_by", "locked_until"}}},
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": job.Name, "locked_by": job.LockedBy}, update)
+	if err != nil {
+		return fmt.Errorf("failed to finish job %s: %w", job.Name, err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("job lease %w", ErrNotFound)
+	}
+	return nil
+}
+
+func (r *jobRepository) RequestRun(ctx context.Context, name string) (*models.JobState, error) {
+	return r.update(ctx, name, bson.M{"$set": bson.M{"run_requested_at": time.Now()}})
+}
+
+func (r *jobRepository) SetPaused(ctx context.Context, name string, paused bool) (*models.JobState, error) {
+	return r.update(ctx, name, bson.M{"$set": bson.M{"paused": paused}})
+}
+
+// update applies update to a job and returns the updated job.
+func (r *jobRepository) update(ctx context.Context, name string, update bson.M) (*models.JobState, error) {
+	var job models.JobState
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": name}, update, opts).Decode(&job)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("job %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to update job %s: %w", name, err)
+	}
+	return &job, nil
+}
+
+func (r *jobRepository) FindAll(ctx context.Context) ([]models.JobState, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find jobs: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	jobs := []models.JobState{}
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to decode jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+func (r *jobRepository) FindByName(ctx context.Context, name string) (*models.JobState, error) {
+	var job models.JobState
+	err := r.collection.FindOne(ctx, bson.M{"_id": name}).Decode(&job)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("job %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to find job: %w", err)
+	}
+	return &job, nil
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// jobRunRetention is how long the history of job runs is kept.
+const jobRunRetention = 90 * 24 * time.Hour
+
+type JobRunRepository interface {
+	Create(ctx context.Context, run *models.JobRun) error
+	// Finish stores the status, end, error and counts of a run.
+	Finish(ctx context.Context, run *models.JobRun) error
+	// Abandon marks the runs of job that are still running as abandoned at
+	// finishedAt and returns how many it marked. The owner of the job's
+	// lease calls it before running the job, when no other run can be in
+	// progress.
+	Abandon(ctx context.Context, job string, finishedAt time.Time) (int64, error)
+	// Find returns one page of the runs of a job along with the token of
+	// the next page.
+	Find(ctx context.Context, job string, page PageOptions) ([]models.JobRun, string, error)
+}
+
+// jobRunSortFields maps the sort names accepted by Find to run fields.
+var jobRunSortFields = map[string]string{
+	"started_at": "_id",
+}
+
+type jobRunRepository struct {
+	collection *mongo.Collection
+}
+
+func NewJobRunRepository(collection *mongo.Collection) JobRunRepository {
+	return &jobRunRepository{
+		collection: collection,
+	}
+}
+
+// EnsureJobRunIndexes creates the index that lists the runs of a job and a
+// TTL index that deletes runs after jobRunRetention.
+func EnsureJobRunIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "job", Value: 1}, {Key: "_id", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "started_at", Value: 1}},
+			Options: options.Index().SetName("started_at_ttl").SetExpireAfterSeconds(int32(jobRunRetention.Seconds())),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create job run indexes: %w", err)
+	}
+	return nil
+}
+
+func (r *jobRunRepository) Create(ctx context.Context, run *models.JobRun) error {
+	// Runs are created as they start, so their IDs sort them by start
+	result, err := r.collection.InsertOne(ctx, run)
+	if err != nil {
+		return fmt.Errorf("failed to create job run: %w", err)
+	}
+	run.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *jobRunRepository) Finish(ctx context.Context, run *models.JobRun) error {
+	update := bson.M{"$set": bson.M{
+		"status":      run.Status,
+		"finished_at": run.FinishedAt,
+		"error":       run.Error,
+		"counts":      run.Counts,
+	}}
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": run.ID}, update); err != nil {
+		return fmt.Errorf("failed to finish job run: %w", err)
+	}
+	return nil
+}
+
+func (r *jobRunRepository) Abandon(ctx context.Context, job string, finishedAt time.Time) (int64, error) {
+	update := bson.M{"$set": bson.M{
+		"status":      models.JobRunAbandoned,
+		"finished_at": finishedAt,
+		"error":       "the replica running the job stopped renewing its lease",
+	}}
+	result, err := r.collection.UpdateMany(ctx, bson.M{"job": job, "status": models.JobRunRunning}, update)
+	if err != nil {
+		return 0, fmt.Errorf("failed to abandon job runs: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+func (r *jobRunRepository) Find(ctx context.Context, job string, page PageOptions) ([]models.JobRun, string, error) {
+	runs, next, err := findPage[models.JobRun](ctx, r.collection, bson.M{"job": job}, jobRunSortFields, page)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find job runs: %w", err)
+	}
+	return runs, next, nil
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"p3-graded-challenge-2-ziancarlos/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MigrateLegacyPayments rewrites the payments stored before amounts carried
+// a currency and payments had a status, the way they are read: a plain
+// double amount becomes Money in models.DefaultCurrency and a missing status
+// becomes pending. Listings can then filter, sort and page through them
+// like any other payment. It returns how many payments it rewrote and can
+// be run again.
+func MigrateLegacyPayments(ctx context.Context, collection *mongo.Collection) (int64, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"amount": bson.M{"$type": "double"}},
+		bson.M{"status": bson.M{"$exists": false}},
+	}}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"amount": legacyMoney("amount"),
+		"status": bson.M{"$ifNull": bson.A{"$status", models.PaymentStatusPending}},
+	}}}}
+
+	result, err := collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("failed to migrate legacy payments: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+// MigrateLegacyProducts rewrites the plain double prices of the products
+// stored before prices carried a currency into Money in
+// models.DefaultCurrency, the way they are read. It returns how many
+// products it rewrote and can be run again.
+func MigrateLegacyProducts(ctx context.Context, collection *mongo.Collection) (int64, error) {
+	filter := bson.M{"price": bson.M{"$type": "double"}}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{"price": legacyMoney("price")}}}}
+
+	result, err := collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("failed to migrate legacy products: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+// legacyMoney is an expression converting field to Money in
+// models.DefaultCurrency if it holds a plain double, and leaving it as is
+// otherwise.
+func legacyMoney(field string) bson.M {
+	exponent, _ := models.CurrencyExponent(models.DefaultCurrency)
+	value := "$" + field
+	return bson.M{"$cond": bson.A{
+		bson.M{"$eq": bson.A{bson.M{"$type": value}, "double"}},
+		bson.M{
+			"units":    bson.M{"$toLong": bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{value, math.Pow10(exponent)}}, 0}}},
+			"currency": models.DefaultCurrency,
+		},
+		value,
+	}}
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testCollection returns an empty collection on the MongoDB server at
+// TEST_MONGO_URI, skipping the test when it is not set.
+func testCollection(t *testing.T) *mongo.Collection {
+	uri := os.Getenv("TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGO_URI is not set")
+	}
+
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
+	require.NoError(t, err)
+	collection := client.Database("repository_test").Collection(t.Name())
+	require.NoError(t, collection.Drop(context.Background()))
+	t.Cleanup(func() {
+		collection.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+	return collection
+}
+
+func TestMigrateLegacyPayments_FiltersFindLegacyAmounts(t *testing.T) {
+	collection := testCollection(t)
+	ctx := context.Background()
+
+	_, err := collection.InsertMany(ctx, []interface{}{
+		bson.M{"_id": primitive.NewObjectID(), "amount": 30.5, "status": models.PaymentStatusCaptured},
+		&models.Payment{ID: primitive.NewObjectID(), Amount: models.Money{Units: 1000, Currency: "USD"}, Status: models.PaymentStatusCaptured},
+	})
+	require.NoError(t, err)
+
+	migrated, err := MigrateLegacyPayments(ctx, collection)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), migrated)
+
+	repo := NewPaymentRepository(collection)
+	payments, _, err := repo.Find(ctx, PaymentFilter{Currency: "USD", MinAmount: &models.Money{Units: 3000, Currency: "USD"}}, PageOptions{Size: 10})
+	require.NoError(t, err)
+	require.Len(t, payments, 1)
+	assert.Equal(t, int64(3050), payments[0].Amount.Units)
+}
+
+// findAllPayments pages through every payment matching filter, two at a
+// time.
+func findAllPayments(t *testing.T, repo PaymentRepository, filter PaymentFilter, sort string) []models.Payment {
+	var all []models.Payment
+	page := PageOptions{Size: 2, Sort: sort}
+	for {
+		payments, next, err := repo.Find(context.Background(), filter, page)
+		require.NoError(t, err)
+		all = append(all, payments...)
+		if next == "" {
+			return all
+		}
+		page.Token = next
+	}
+}
+
+func TestMigrateLegacyPayments_PagesAcrossLegacyAndNewPayments(t *testing.T) {
+	collection := testCollection(t)
+	ctx := context.Background()
+
+	// Payments stored before amounts carried a currency and payments had a
+	// status, mixed with current ones
+	_, err := collection.InsertMany(ctx, []interface{}{
+		bson.M{"_id": primitive.NewObjectID(), "amount": 30.5},
+		&models.Payment{ID: primitive.NewObjectID(), Amount: models.Money{Units: 1000, Currency: "USD"}, Status: models.PaymentStatusCaptured},
+		bson.M{"_id": primitive.NewObjectID(), "amount": 20.0},
+		&models.Payment{ID: primitive.NewObjectID(), Amount: models.Money{Units: 4000, Currency: "USD"}, Status: models.PaymentStatusPending},
+		&models.Payment{ID: primitive.NewObjectID(), Amount: models.Money{Units: 2500, Currency: "EUR"}, Status: models.PaymentStatusPending},
+	})
+	require.NoError(t, err)
+
+	repo := NewPaymentRepository(collection)
+	// Paging reaches every payment even before the migration, when the
+	// legacy ones have no amount.units or status to sort on
+	for _, sort := range []string{"amount", "-amount", "status", "-status"} {
+		assert.Len(t, findAllPayments(t, repo, PaymentFilter{}, sort), 5, sort)
+	}
+
+	migrated, err := MigrateLegacyPayments(ctx, collection)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), migrated)
+
+	// Migrating again changes nothing
+	migrated, err = MigrateLegacyPayments(ctx, collection)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), migrated)
+
+	var units []int64
+	for _, payment := range findAllPayments(t, repo, PaymentFilter{Currency: "USD"}, "amount") {
+		units = append(units, payment.Amount.Units)
+	}
+	assert.Equal(t, []int64{1000, 2000, 3050, 4000}, units)
+	assert.Len(t, findAllPayments(t, repo, PaymentFilter{Currency: "USD"}, "-status"), 4)
+
+	pending, _, err := repo.Find(ctx, PaymentFilter{Status: models.PaymentStatusPending, Currency: "USD", MinAmount: &models.Money{Units: 2000, Currency: "USD"}}, PageOptions{Size: 10})
+	require.NoError(t, err)
+	assert.Len(t, pending, 3)
+}
+
+func TestMigrateLegacyProducts_RewritesDoublePrices(t *testing.T) {
+	collection := testCollection(t)
+	ctx := context.Background()
+
+	legacyID := primitive.NewObjectID()
+	_, err := collection.InsertMany(ctx, []interface{}{
+		bson.M{"_id": legacyID, "name": "Keyboard", "price": 49.99},
+		&models.Product{ID: primitive.NewObjectID(), Name: "Mouse", Price: models.Money{Units: 1999, Currency: "USD"}},
+	})
+	require.NoError(t, err)
+
+	migrated, err := MigrateLegacyProducts(ctx, collection)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), migrated)
+
+	var raw bson.Raw
+	require.NoError(t, collection.FindOne(ctx, bson.M{"_id": legacyID}).Decode(&raw))
+	assert.Equal(t, int64(4999), raw.Lookup("price", "units").Int64())
+	assert.Equal(t, "USD", raw.Lookup("price", "currency").StringValue())
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type OrderRepository interface {
+	Create(ctx context.Context, order *models.Order) error
+	// FindAll returns the orders of ownerID, or every order if ownerID is
+	// empty.
+	FindAll(ctx context.Context, ownerID string) ([]models.Order, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Order, error)
+	// FindByPaymentID returns the order paid for by a payment. It fails with
+	// ErrNotFound when no order has the payment.
+	FindByPaymentID(ctx context.Context, paymentID string) (*models.Order, error)
+	// FindByStatus returns every order in a status.
+	FindByStatus(ctx context.Context, status models.OrderStatus) ([]models.Order, error)
+	// UpdateStatus moves the order to status "to" only if it is currently in
+	// status "from". It reports whether the order was updated.
+	UpdateStatus(ctx context.Context, id primitive.ObjectID, from, to models.OrderStatus) (bool, error)
+	// Claim moves a pending order to processing, storing the items and
+	// total it is being checked out at. It reports whether the order was
+	// still pending.
+	Claim(ctx context.Context, id primitive.ObjectID, items []models.OrderItem, total models.Money) (bool, error)
+	// AwaitPayment records the payment of an order in processing and moves
+	// it to awaiting_payment. It reports whether the order was still in
+	// processing.
+	AwaitPayment(ctx context.Context, id primitive.ObjectID, paymentID string) (bool, error)
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+type orderRepository struct {
+	collection *mongo.Collection
+}
+
+func NewOrderRepository(collection *mongo.Collection) OrderRepository {
+	return &orderRepository{
+		collection: collection,
+	}
+}
+
+// EnsureOrderIndexes creates the indexes that list the orders of a user,
+// find orders by status and find the order of a payment.
+func EnsureOrderIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "owner_id", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "payment_id", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create order indexes: %w", err)
+	}
+	return nil
+}
+
+func (r *orderRepository) Create(ctx context.Context, order *models.Order) error {
+	result, err := r.collection.InsertOne(ctx, order)
+	if err != nil {
+		return fmt.Errorf("failed to create order: %w", err)
+	}
+	order.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *orderRepository) FindAll(ctx context.Context, ownerID string) ([]models.Order, error) {
+	filter := bson.M{}
+	if ownerID != "" {
+		filter["owner_id"] = ownerID
+	}
+
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find orders: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var orders []models.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, fmt.Errorf("failed to decode orders: %w", err)
+	}
+
+	return orders, nil
+}
+
+func (r *orderRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Order, error) {
+	var order models.Order
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&order)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("order %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to find order: %w", err)
+	}
+	return &order, nil
+}
+
+func (r *orderRepository) FindByPaymentID(ctx context.Context, paymentID string) (*models.Order, error) {
+	var order models.Order
+	err := r.collection.FindOne(ctx, bson.M{"payment_id": paymentID}).Decode(&order)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("order %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to find order: %w", err)
+	}
+	return &order, nil
+}
+
+func (r *orderRepository) FindByStatus(ctx context.Context, status models.OrderStatus) ([]models.Order, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"status": status})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find orders: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var orders []models.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, fmt.Errorf("failed to decode orders: %w", err)
+	}
+
+	return orders, nil
+}
+
+func (r *orderRepository) UpdateStatus(ctx context.Context, id primitive.ObjectID, from, to models.OrderStatus) (bool, error) {
+	update := bson.M{
+		"$set": bson.M{
+			"status": to,
+		},
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "status": from}, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to update order status: %w", err)
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (r *orderRepository) Claim(ctx context.Context, id primitive.ObjectID, items []models.OrderItem, total models.Money) (bool, error) {
+	update := bson.M{
+		"$set": bson.M{
+			"items":  items,
+			"total":  total,
+			"status": models.OrderStatusProcessing,
+		},
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "status": models.OrderStatusPending}, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim order: %w", err)
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (r *orderRepository) AwaitPayment(ctx context.Context, id primitive.ObjectID, paymentID string) (bool, error) {
+	update := bson.M{
+		"$set": bson.M{
+			"status":     models.OrderStatusAwaitingPayment,
+			"payment_id": paymentID,
+		},
+		"$unset": bson.M{"reserved_until": ""},
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "status": models.OrderStatusProcessing}, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to record order payment: %w", err)
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (r *orderRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete order: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("order %w", ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// outboxRetention is how long processed entries are kept for inspection.
+const outboxRetention = 7 * 24 * time.Hour
+
+type OutboxRepository interface {
+	Add(ctx context.Context, entry *models.OutboxEntry) error
+	// ClaimNext locks the oldest unprocessed entry for lease, so no other
+	// worker processes it meanwhile. Later entries wait until it is
+	// processed, so entries are processed one at a time in the order they
+	// were added. An entry whose lock expired, because its worker died, is
+	// claimed again. It fails with ErrNotFound when there is nothing to
+	// process or the oldest entry is locked.
+	ClaimNext(ctx context.Context, lease time.Duration) (*models.OutboxEntry, error)
+	// Unlock gives up the lock on an entry, so it can be claimed again
+	// right away.
+	Unlock(ctx context.Context, id primitive.ObjectID) error
+	// MarkPublished records that an entry has been published to publisher.
+	MarkPublished(ctx context.Context, id primitive.ObjectID, publisher string) error
+	// MarkProcessed records that an entry needs no further publishing.
+	MarkProcessed(ctx context.Context, id primitive.ObjectID) error
+}
+
+type outboxRepository struct {
+	collection *mongo.Collection
+}
+
+func NewOutboxRepository(collection *mongo.Collection) OutboxRepository {
+	return &outboxRepository{
+		collection: collection,
+	}
+}
+
+// EnsureOutboxIndexes creates the index that finds unprocessed entries and a
+// TTL index that deletes processed ones after outboxRetention.
+func EnsureOutboxIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "processed_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "processed_at", Value: 1}},
+			Options: options.Index().SetName("processed_at_ttl").SetExpireAfterSeconds(int32(outboxRetention.Seconds())),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create outbox indexes: %w", err)
+	}
+	return nil
+}
+
+func (r *outboxRepository) Add(ctx context.Context, entry *models.OutboxEntry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	result, err := r.collection.InsertOne(ctx, entry)
+	if err != nil {
+		return fmt.Errorf("failed to add outbox entry: %w", err)
+	}
+	entry.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *outboxRepository) ClaimNext(ctx context.Context, lease time.Duration) (*models.OutboxEntry, error) {
+	// Only the oldest entry can be claimed, so a locked one holds back the
+	// entries after it instead of being overtaken by them
+	var oldest struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	err := r.collection.FindOne(ctx, bson.M{"processed_at": nil}, options.FindOne().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetProjection(bson.M{"_id": 1}),
+	).Decode(&oldest)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("outbox entry %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to find outbox entry: %w", err)
+	}
+
+	now := time.Now()
+	filter := bson.M{
+		"_id":          oldest.ID,
+		"processed_at": nil,
+		"$or": bson.A{
+			bson.M{"locked_until": nil},
+			bson.M{"locked_until": bson.M{"$lte": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"locked_until": now.Add(lease)}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var entry models.OutboxEntry
+	err = r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&entry)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("outbox entry %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to claim outbox entry: %w", err)
+	}
+	return &entry, nil
+}
+
+func (r *outboxRepository) Unlock(ctx context.Context, id primitive.ObjectID) error {
+	update := bson.M{"$unset": bson.M{"locked_until": ""}}
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+		return fmt.Errorf("failed to unlock outbox entry: %w", err)
+	}
+	return nil
+}
+
+func (r *outboxRepository) MarkPublished(ctx context.Context, id primitive.ObjectID, publisher string) error {
+	update := bson.M{"$addToSet": bson.M{"published_to": publisher}}
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+		return fmt.Errorf("failed to mark outbox entry published: %w", err)
+	}
+	return nil
+}
+
+func (r *outboxRepository) MarkProcessed(ctx context.Context, id primitive.ObjectID) error {
+	update := bson.M{
+		"$set":   bson.M{"processed_at": time.Now()},
+		"$unset": bson.M{"locked_until": ""},
+	}
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+		return fmt.Errorf("failed to mark outbox entry processed: %w", err)
+	}
+	return nil
+}
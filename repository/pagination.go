@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PageOptions selects one page of a list query.
+type PageOptions struct {
+	// Size is the maximum number of documents to return
+	Size int
+	// Token is the NextPageToken of the previous page, empty for the first
+	Token string
+	// Sort is one of the sort fields of the collection, prefixed with "-"
+	// for descending order. Empty sorts by creation time.
+	Sort string
+}
+
+// pageToken is the position of the last document of a page. It records the
+// sort it was issued for so it cannot be replayed against another order.
+type pageToken struct {
+	Sort  string             `bson:"s"`
+	Value bson.RawValue      `bson:"v"`
+	ID    primitive.ObjectID `bson:"id"`
+}
+
+// findPage runs a keyset paginated query. sortFields maps the sort names
+// accepted in PageOptions to document fields; ties are broken on _id, which
+// also orders documents by creation time. It returns the next page token,
+// which is empty on the last page.
+func findPage[T any](ctx context.Context, collection *mongo.Collection, filter bson.M, sortFields map[string]string, page PageOptions) ([]T, string, error) {
+	sortName := strings.TrimPrefix(page.Sort, "-")
+	if sortName == "" {
+		sortName = "created_at"
+	}
+	field, ok := sortFields[sortName]
+	if !ok {
+		return nil, "", fmt.Errorf("%w: cannot sort by %q", ErrInvalidQuery, sortName)
+	}
+	direction, op := 1, "$gt"
+	if strings.HasPrefix(page.Sort, "-") {
+		direction, op = -1, "$lt"
+	}
+
+	if page.Token != "" {
+		token, err := decodePageToken(page.Token)
+		if err != nil {
+			return nil, "", err
+		}
+		if token.Sort != page.Sort {
+			return nil, "", fmt.Errorf("%w: page token was issued for a different sort", ErrInvalidQuery)
+		}
+
+		after := bson.M{"_id": bson.M{op: token.ID}}
+		switch {
+		case field == "_id":
+		case token.Value.Type == bsontype.Null:
+			// Documents without the field, such as payments not migrated
+			// by MigrateLegacyPayments, sort before all others and only
+			// match null
+			after = bson.M{field: nil, "_id": bson.M{op: token.ID}}
+			if direction == 1 {
+				after = bson.M{"$or": bson.A{bson.M{field: bson.M{"$ne": nil}}, after}}
+			}
+		default:
+			next := bson.A{
+				bson.M{field: bson.M{op: token.Value}},
+				bson.M{field: token.Value, "_id": bson.M{op: token.ID}},
+			}
+			if direction == -1 {
+				next = append(next, bson.M{field: nil})
+			}
+			after = bson.M{"$or": next}
+		}
+		filter = bson.M{"$and": bson.A{filter, after}}
+	}
+
+	sort := bson.D{{Key: field, Value: direction}}
+	if field != "_id" {
+		sort = append(sort, bson.E{Key: "_id", Value: direction})
+	}
+	// Fetch one extra document to learn whether there is another page
+	opts := options.Find().SetSort(sort).SetLimit(int64(page.Size) + 1)
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []bson.Raw
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(docs) > page.Size {
+		docs = docs[:page.Size]
+		next, err = encodePageToken(page.Sort, field, docs[len(docs)-1])
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	results := make([]T, 0, len(docs))
+	for _, doc := range docs {
+		var result T
+		if err := bson.Unmarshal(doc, &result); err != nil {
+			return nil, "", err
+		}
+		results = append(results, result)
+	}
+
+	return results, next, nil
+}
+
+func encodePageToken(sort, field string, last bson.Raw) (string, error) {
+	id, ok := last.Lookup("_id").ObjectIDOK()
+	if !ok {
+		return "", fmt.Errorf("document has no ObjectID")
+	}
+
+	token := pageToken{Sort: sort, ID: id}
+	value, err := last.LookupErr(strings.Split(field, ".")...)
+	if err != nil {
+		value = bson.RawValue{Type: bsontype.Null}
+	}
+	token.Value = value
+
+	data, err := bson.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodePageToken(encoded string) (*pageToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed page token", ErrInvalidQuery)
+	}
+
+	var token pageToken
+	if err := bson.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("%w: malformed page token", ErrInvalidQuery)
+	}
+	return &token, nil
+}
+
+// addCreatedRange restricts filter to documents created at or after "after"
+// and before "before", using the creation time embedded in their ObjectID.
+// Zero times leave that side of the range open.
+func addCreatedRange(filter bson.M, after, before time.Time) {
+	id := bson.M{}
+	if !after.IsZero() {
+		id["$gte"] = primitive.NewObjectIDFromTimestamp(after)
+	}
+	if !before.IsZero() {
+		id["$lt"] = primitive.NewObjectIDFromTimestamp(before)
+	}
+	if len(id) > 0 {
+		filter["_id"] = id
+	}
+}
+
+// addMoneyRange restricts filter to amounts of field in the given currency
+// between min and max inclusive. Nil bounds leave that side open.
+func addMoneyRange(filter bson.M, field, currency string, min, max *models.Money) {
+	if currency != "" {
+		filter[field+".currency"] = currency
+	}
+	units := bson.M{}
+	if min != nil {
+		units["$gte"] = min.Units
+	}
+	if max != nil {
+		units["$lte"] = max.Units
+	}
+	if len(units) > 0 {
+		filter[field+".units"] = units
+	}
+}
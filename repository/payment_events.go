@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PaymentEventSource delivers changes to payments in the order they happen.
+type PaymentEventSource interface {
+	// Watch calls fn for every change after resumeToken, or from now if it
+	// is empty, until ctx is done or fn returns an error. It fails with
+	// ErrResumeTokenExpired if the changes after resumeToken are no longer
+	// retained.
+	Watch(ctx context.Context, resumeToken string, fn func(models.PaymentEvent) error) error
+}
+
+type paymentChangeStream struct {
+	collection *mongo.Collection
+}
+
+// NewPaymentChangeStream creates a PaymentEventSource backed by a MongoDB
+// change stream, which sees the changes made by every process.
+func NewPaymentChangeStream(collection *mongo.Collection) PaymentEventSource {
+	return &paymentChangeStream{
+		collection: collection,
+	}
+}
+
+func (s *paymentChangeStream) Watch(ctx context.Context, resumeToken string, fn func(models.PaymentEvent) error) error {
+	return watchChanges(ctx, s.collection, resumeToken, func(change change[models.Payment], token string) error {
+		event := models.PaymentEvent{
+			PaymentID:   change.DocumentKey.ID,
+			Payment:     change.FullDocument,
+			ResumeToken: token,
+		}
+		switch {
+		case change.OperationType == "insert":
+			event.Type = models.PaymentEventCreated
+		case change.OperationType == "delete":
+			event.Type = models.PaymentEventDeleted
+			event.Payment = change.FullDocumentBeforeChange
+		case change.softDeletes():
+			event.Type = models.PaymentEventDeleted
+		case change.restores():
+			event.Type = models.PaymentEventRestored
+		default:
+			event.Type = models.PaymentEventUpdated
+		}
+		return fn(event)
+	})
+}
+
+// paymentBroadcaster is a PaymentRepository that publishes the changes made
+// through it to the watchers in the same process.
+type paymentBroadcaster struct {
+	PaymentRepository
+	events *broadcaster[models.PaymentEvent]
+}
+
+// NewPaymentBroadcaster wraps repo so that every payment it creates,
+// updates or deletes is published to the returned PaymentEventSource. It is
+// the fallback for MongoDB deployments without change streams.
+func NewPaymentBroadcaster(repo PaymentRepository) (PaymentRepository, PaymentEventSource) {
+	broadcaster := &paymentBroadcaster{
+		PaymentRepository: repo,
+		events: newBroadcaster(func(event *models.PaymentEvent, token string) {
+			event.ResumeToken = token
+		}),
+	}
+	return broadcaster, broadcaster
+}
+
+func (b *paymentBroadcaster) Create(ctx context.Context, payment *models.Payment) error {
+	if err := b.PaymentRepository.Create(ctx, payment); err != nil {
+		return err
+	}
+
+	created := *payment
+	b.events.publish(models.PaymentEvent{Type: models.PaymentEventCreated, PaymentID: payment.ID, Payment: &created})
+	return nil
+}
+
+func (b *paymentBroadcaster) UpdateStatus(ctx context.Context, id primitive.ObjectID, from []models.PaymentStatus, to models.PaymentStatus) (bool, error) {
+	updated, err := b.PaymentRepository.UpdateStatus(ctx, id, from, to)
+	if updated {
+		b.publishUpdate(ctx, id)
+	}
+	return updated, err
+}
+
+func (b *paymentBroadcaster) AddRefund(ctx context.Context, refund *models.Refund) (bool, error) {
+	updated, err := b.PaymentRepository.AddRefund(ctx, refund)
+	if updated {
+		b.publishUpdate(ctx, refund.PaymentID)
+	}
+	return updated, err
+}
+
+func (b *paymentBroadcaster) Delete(ctx context.Context, id primitive.ObjectID) error {
+	// Load the payment first so the event can say whose payment it was
+	payment, _ := b.PaymentRepository.FindByID(ctx, id)
+	if err := b.PaymentRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	b.events.publish(models.PaymentEvent{Type: models.PaymentEventDeleted, PaymentID: id, Payment: payment})
+	return nil
+}
+
+func (b *paymentBroadcaster) Restore(ctx context.Context, id primitive.ObjectID) (*models.Payment, error) {
+	payment, err := b.PaymentRepository.Restore(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	restored := *payment
+	b.events.publish(models.PaymentEvent{Type: models.PaymentEventRestored, PaymentID: id, Payment: &restored})
+	return payment, nil
+}
+
+func (b *paymentBroadcaster) publishUpdate(ctx context.Context, id primitive.ObjectID) {
+	// Like a change stream without a lookup result, an update whose
+	// payment cannot be loaded is published without its state
+	payment, _ := b.PaymentRepository.FindByID(ctx, id)
+	b.events.publish(models.PaymentEvent{Type: models.PaymentEventUpdated, PaymentID: id, Payment: payment})
+}
+
+func (b *paymentBroadcaster) Watch(ctx context.Context, resumeToken string, fn func(models.PaymentEvent) error) error {
+	if err := b.events.watch(ctx, resumeToken, fn); err != nil {
+		return fmt.Errorf("failed to watch payments: %w", err)
+	}
+	return nil
+}
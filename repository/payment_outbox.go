@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"p3-graded-challenge-2-ziancarlos/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// paymentOutbox is a PaymentRepository that records every change made
+// through it in an outbox.
+type paymentOutbox struct {
+	PaymentRepository
+	outbox       OutboxRepository
+	transactions Transactor
+}
+
+// NewPaymentOutbox wraps repo so that every payment it creates, updates or
+// deletes is recorded in outbox in the same transaction as the change.
+// Without transactions a change can be made and never published.
+func NewPaymentOutbox(repo PaymentRepository, outbox OutboxRepository, transactions Transactor) PaymentRepository {
+	return &paymentOutbox{
+		PaymentRepository: repo,
+		outbox:            outbox,
+		transactions:      transactions,
+	}
+}
+
+func (o *paymentOutbox) Create(ctx context.Context, payment *models.Payment) error {
+	return o.transactions.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := o.PaymentRepository.Create(ctx, payment); err != nil {
+			return err
+		}
+
+		created := *payment
+		return o.outbox.Add(ctx, &models.OutboxEntry{Type: models.PaymentEventCreated, PaymentID: payment.ID, Payment: &created})
+	})
+}
+
+func (o *paymentOutbox) UpdateStatus(ctx context.Context, id primitive.ObjectID, from []models.PaymentStatus, to models.PaymentStatus) (bool, error) {
+	var updated bool
+	err := o.transactions.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		updated, err = o.PaymentRepository.UpdateStatus(ctx, id, from, to)
+		if err != nil || !updated {
+			return err
+		}
+		return o.addUpdate(ctx, id)
+	})
+	return updated, err
+}
+
+func (o *paymentOutbox) AddRefund(ctx context.Context, refund *models.Refund) (bool, error) {
+	var updated bool
+	err := o.transactions.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		updated, err = o.PaymentRepository.AddRefund(ctx, refund)
+		if err != nil || !updated {
+			return err
+		}
+		return o.addUpdate(ctx, refund.PaymentID)
+	})
+	return updated, err
+}
+
+func (o *paymentOutbox) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return o.transactions.WithTransaction(ctx, func(ctx context.Context) error {
+		// Load the payment first so the entry can say what was deleted
+		payment, err := o.PaymentRepository.FindByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := o.PaymentRepository.Delete(ctx, id); err != nil {
+			return err
+		}
+		return o.outbox.Add(ctx, &models.OutboxEntry{Type: models.PaymentEventDeleted, PaymentID: id, Payment: payment})
+	})
+}
+
+func (o *paymentOutbox) Restore(ctx context.Context, id primitive.ObjectID) (*models.Payment, error) {
+	var payment *models.Payment
+	err := o.transactions.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		payment, err = o.PaymentRepository.Restore(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		restored := *payment
+		return o.outbox.Add(ctx, &models.OutboxEntry{Type: models.PaymentEventRestored, PaymentID: id, Payment: &restored})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+func (o *paymentOutbox) addUpdate(ctx context.Context, id primitive.ObjectID) error {
+	payment, err := o.PaymentRepository.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	return o.outbox.Add(ctx, &models.OutboxEntry{Type: models.PaymentEventUpdated, PaymentID: id, Payment: payment})
+}
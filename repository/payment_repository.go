@@ -2,19 +2,61 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"p3-graded-challenge-2-ziancarlos/models"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type PaymentRepository interface {
 	Create(ctx context.Context, payment *models.Payment) error
-	FindAll(ctx context.Context) ([]models.Payment, error)
+	// Find returns one page of the payments matching filter along with the
+	// token of the next page, which is empty on the last page.
+	Find(ctx context.Context, filter PaymentFilter, page PageOptions) ([]models.Payment, string, error)
 	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Payment, error)
+	// FindByIdempotencyKey finds the payment an owner created with key, even
+	// if it was deleted since, so that retries never create it twice.
+	FindByIdempotencyKey(ctx context.Context, ownerID, key string) (*models.Payment, error)
+	// UpdateStatus moves the payment to status "to" only if its current
+	// status is one of "from". It reports whether the payment was updated.
+	UpdateStatus(ctx context.Context, id primitive.ObjectID, from []models.PaymentStatus, to models.PaymentStatus) (bool, error)
+	// AddRefund adds the amount of refund to the refunded total of its
+	// captured payment as long as the total stays within the payment amount,
+	// marking the payment refunded once it is fully refunded. It reports
+	// whether the payment was updated.
+	AddRefund(ctx context.Context, refund *models.Refund) (bool, error)
+	// Delete marks a payment deleted. Deleted payments are left out of
+	// Find, unless asked for, and FindByID, and their status and refunds
+	// cannot change until they are restored.
 	Delete(ctx context.Context, id primitive.ObjectID) error
+	// Restore undeletes a payment and returns it. It fails with ErrNotFound
+	// when no deleted payment has the ID.
+	Restore(ctx context.Context, id primitive.ObjectID) (*models.Payment, error)
+}
+
+// PaymentFilter narrows a payment listing. Zero fields do not filter.
+type PaymentFilter struct {
+	OwnerID       string
+	Status        models.PaymentStatus
+	Currency      string
+	MinAmount     *models.Money
+	MaxAmount     *models.Money
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// IncludeDeleted also finds deleted payments
+	IncludeDeleted bool
+}
+
+// paymentSortFields maps the sort names accepted by Find to payment fields.
+var paymentSortFields = map[string]string{
+	"created_at": "_id",
+	"amount":     "amount.units",
+	"status":     "status",
 }
 
 type paymentRepository struct {
@@ -27,49 +69,181 @@ func NewPaymentRepository(collection *mongo.Collection) PaymentRepository {
 	}
 }
 
+// EnsurePaymentIndexes creates the indexes the payment repository relies on.
+func EnsurePaymentIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "owner_id", Value: 1}, {Key: "idempotency_key", Value: 1}},
+			Options: options.Index().
+				SetName("owner_idempotency_key_unique").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"idempotency_key": bson.M{"$exists": true}}),
+		},
+		{Keys: bson.D{{Key: "owner_id", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "_id", Value: 1}}},
+		// Finds the payments due for retention by status and age
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "updated_at", Value: 1}}},
+		{Keys: bson.D{{Key: "amount.currency", Value: 1}, {Key: "amount.units", Value: 1}, {Key: "_id", Value: 1}}},
+		// Finds the deleted payments due for purging
+		{
+			Keys:    bson.D{{Key: "deleted_at", Value: 1}},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"deleted_at": bson.M{"$exists": true}}),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create payment indexes: %w", err)
+	}
+
+	// Idempotency keys used to be unique across all users rather than per
+	// owner. Codes 26 and 27 mean there is no such index to drop.
+	if _, err := collection.Indexes().DropOne(ctx, "idempotency_key_unique"); err != nil {
+		var cmdErr mongo.CommandError
+		if !errors.As(err, &cmdErr) || (cmdErr.Code != 26 && cmdErr.Code != 27) {
+			return fmt.Errorf("failed to drop legacy idempotency key index: %w", err)
+		}
+	}
+	return nil
+}
+
 func (r *paymentRepository) Create(ctx context.Context, payment *models.Payment) error {
 	result, err := r.collection.InsertOne(ctx, payment)
 	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("failed to create payment: %w", ErrDuplicateKey)
+		}
 		return fmt.Errorf("failed to create payment: %w", err)
 	}
 	payment.ID = result.InsertedID.(primitive.ObjectID)
 	return nil
 }
 
-func (r *paymentRepository) FindAll(ctx context.Context) ([]models.Payment, error) {
-	cursor, err := r.collection.Find(ctx, bson.M{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to find payments: %w", err)
+func (r *paymentRepository) Find(ctx context.Context, filter PaymentFilter, page PageOptions) ([]models.Payment, string, error) {
+	query := bson.M{}
+	if !filter.IncludeDeleted {
+		query["deleted_at"] = nil
+	}
+	if filter.OwnerID != "" {
+		query["owner_id"] = filter.OwnerID
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+		// Payments stored before statuses were introduced are pending
+		if filter.Status == models.PaymentStatusPending {
+			query["status"] = bson.M{"$in": bson.A{filter.Status, nil}}
+		}
 	}
-	defer cursor.Close(ctx)
+	addMoneyRange(query, "amount", filter.Currency, filter.MinAmount, filter.MaxAmount)
+	addCreatedRange(query, filter.CreatedAfter, filter.CreatedBefore)
 
-	var payments []models.Payment
-	if err := cursor.All(ctx, &payments); err != nil {
-		return nil, fmt.Errorf("failed to decode payments: %w", err)
+	payments, next, err := findPage[models.Payment](ctx, r.collection, query, paymentSortFields, page)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find payments: %w", err)
 	}
 
-	return payments, nil
+	return payments, next, nil
 }
 
 func (r *paymentRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Payment, error) {
 	var payment models.Payment
-	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&payment)
+	err := r.collection.FindOne(ctx, bson.M{"_id": id, "deleted_at": nil}).Decode(&payment)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("payment not found")
+			return nil, fmt.Errorf("payment %w", ErrNotFound)
 		}
 		return nil, fmt.Errorf("failed to find payment: %w", err)
 	}
 	return &payment, nil
 }
 
+func (r *paymentRepository) FindByIdempotencyKey(ctx context.Context, ownerID, key string) (*models.Payment, error) {
+	var payment models.Payment
+	err := r.collection.FindOne(ctx, bson.M{"owner_id": ownerID, "idempotency_key": key}).Decode(&payment)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("payment %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to find payment: %w", err)
+	}
+	return &payment, nil
+}
+
+func (r *paymentRepository) UpdateStatus(ctx context.Context, id primitive.ObjectID, from []models.PaymentStatus, to models.PaymentStatus) (bool, error) {
+	statuses := bson.A{}
+	for _, status := range from {
+		statuses = append(statuses, status)
+		// Payments stored before statuses were introduced have no status
+		// field and are treated as pending
+		if status == models.PaymentStatusPending {
+			statuses = append(statuses, nil)
+		}
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"status":     to,
+			"updated_at": time.Now(),
+		},
+	}
+	filter := bson.M{"_id": id, "status": bson.M{"$in": statuses}, "deleted_at": nil}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to update payment status: %w", err)
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (r *paymentRepository) AddRefund(ctx context.Context, refund *models.Refund) (bool, error) {
+	refunded := bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$refunded_amount.units", 0}}, refund.Amount.Units}}
+	filter := bson.M{
+		"_id":             refund.PaymentID,
+		"deleted_at":      nil,
+		"status":          models.PaymentStatusCaptured,
+		"amount.currency": refund.Amount.Currency,
+		"$expr":           bson.M{"$lte": bson.A{refunded, "$amount.units"}},
+	}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"refunded_amount": bson.M{
+				"units":    refunded,
+				"currency": "$amount.currency",
+			},
+			"updated_at": "$$NOW",
+		}}},
+		{{Key: "$set", Value: bson.M{"status": bson.M{"$cond": bson.A{
+			bson.M{"$gte": bson.A{"$refunded_amount.units", "$amount.units"}},
+			models.PaymentStatusRefunded,
+			"$status",
+		}}}}},
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to refund payment: %w", err)
+	}
+	return result.ModifiedCount > 0, nil
+}
+
 func (r *paymentRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
-	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	update := bson.M{"$set": bson.M{"deleted_at": time.Now()}}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "deleted_at": nil}, update)
 	if err != nil {
 		return fmt.Errorf("failed to delete payment: %w", err)
 	}
-	if result.DeletedCount == 0 {
-		return fmt.Errorf("payment not found")
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("payment %w", ErrNotFound)
 	}
 	return nil
 }
+
+func (r *paymentRepository) Restore(ctx context.Context, id primitive.ObjectID) (*models.Payment, error) {
+	var payment models.Payment
+	update := bson.M{"$unset": bson.M{"deleted_at": ""}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": id, "deleted_at": bson.M{"$ne": nil}}, update, opts).Decode(&payment)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("deleted payment %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to restore payment: %w", err)
+	}
+	return &payment, nil
+}
@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ProductEventSource delivers changes to products in the order they happen.
+type ProductEventSource interface {
+	// Watch calls fn for every change after resumeToken, or from now if it
+	// is empty, until ctx is done or fn returns an error. It fails with
+	// ErrResumeTokenExpired if the changes after resumeToken are no longer
+	// retained.
+	Watch(ctx context.Context, resumeToken string, fn func(models.ProductEvent) error) error
+}
+
+type productChangeStream struct {
+	collection *mongo.Collection
+}
+
+// NewProductChangeStream creates a ProductEventSource backed by a MongoDB
+// change stream, which sees the changes made by every process.
+func NewProductChangeStream(collection *mongo.Collection) ProductEventSource {
+	return &productChangeStream{
+		collection: collection,
+	}
+}
+
+func (s *productChangeStream) Watch(ctx context.Context, resumeToken string, fn func(models.ProductEvent) error) error {
+	return watchChanges(ctx, s.collection, resumeToken, func(change change[models.Product], token string) error {
+		event := models.ProductEvent{
+			ProductID:   change.DocumentKey.ID,
+			Product:     change.FullDocument,
+			ResumeToken: token,
+		}
+		switch {
+		case change.OperationType == "insert":
+			event.Type = models.ProductEventCreated
+		case change.OperationType == "delete":
+			event.Type = models.ProductEventDeleted
+			event.Product = change.FullDocumentBeforeChange
+		case change.softDeletes():
+			event.Type = models.ProductEventDeleted
+		case change.restores():
+			event.Type = models.ProductEventRestored
+		default:
+			event.Type = models.ProductEventUpdated
+		}
+		return fn(event)
+	})
+}
+
+// productBroadcaster is a ProductRepository that publishes the changes made
+// through it to the watchers in the same process.
+type productBroadcaster struct {
+	ProductRepository
+	events *broadcaster[models.ProductEvent]
+}
+
+// NewProductBroadcaster wraps repo so that every product it creates,
+// updates or deletes is published to the returned ProductEventSource. It is
+// the fallback for MongoDB deployments without change streams.
+func NewProductBroadcaster(repo ProductRepository) (ProductRepository, ProductEventSource) {
+	broadcaster := &productBroadcaster{
+		ProductRepository: repo,
+		events: newBroadcaster(func(event *models.ProductEvent, token string) {
+			event.ResumeToken = token
+		}),
+	}
+	return broadcaster, broadcaster
+}
+
+func (b *productBroadcaster) Create(ctx context.Context, product *models.Product) error {
+	if err := b.ProductRepository.Create(ctx, product); err != nil {
+		return err
+	}
+
+	created := *product
+	b.events.publish(models.ProductEvent{Type: models.ProductEventCreated, ProductID: product.ID, Product: &created})
+	return nil
+}
+
+func (b *productBroadcaster) Update(ctx context.Context, id primitive.ObjectID, product *models.Product, version int64) error {
+	if err := b.ProductRepository.Update(ctx, id, product, version); err != nil {
+		return err
+	}
+
+	updated := *product
+	b.events.publish(models.ProductEvent{Type: models.ProductEventUpdated, ProductID: id, Product: &updated})
+	return nil
+}
+
+func (b *productBroadcaster) Patch(ctx context.Context, id primitive.ObjectID, changes ProductChanges, version int64) (*models.Product, error) {
+	product, err := b.ProductRepository.Patch(ctx, id, changes, version)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *product
+	b.events.publish(models.ProductEvent{Type: models.ProductEventUpdated, ProductID: id, Product: &updated})
+	return product, nil
+}
+
+func (b *productBroadcaster) Delete(ctx context.Context, id primitive.ObjectID) error {
+	product, _ := b.ProductRepository.FindByID(ctx, id)
+	if err := b.ProductRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	b.events.publish(models.ProductEvent{Type: models.ProductEventDeleted, ProductID: id, Product: product})
+	return nil
+}
+
+func (b *productBroadcaster) Restore(ctx context.Context, id primitive.ObjectID) (*models.Product, error) {
+	product, err := b.ProductRepository.Restore(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	restored := *product
+	b.events.publish(models.ProductEvent{Type: models.ProductEventRestored, ProductID: id, Product: &restored})
+	return product, nil
+}
+
+func (b *productBroadcaster) Reserve(ctx context.Context, id, reservationID primitive.ObjectID, quantity int64, expiresAt time.Time) error {
+	if err := b.ProductRepository.Reserve(ctx, id, reservationID, quantity, expiresAt); err != nil {
+		return err
+	}
+
+	b.publishUpdate(ctx, id)
+	return nil
+}
+
+func (b *productBroadcaster) Release(ctx context.Context, id, reservationID primitive.ObjectID) error {
+	if err := b.ProductRepository.Release(ctx, id, reservationID); err != nil {
+		return err
+	}
+
+	b.publishUpdate(ctx, id)
+	return nil
+}
+
+func (b *productBroadcaster) Commit(ctx context.Context, id, reservationID primitive.ObjectID) error {
+	if err := b.ProductRepository.Commit(ctx, id, reservationID); err != nil {
+		return err
+	}
+
+	b.publishUpdate(ctx, id)
+	return nil
+}
+
+func (b *productBroadcaster) AdjustStock(ctx context.Context, adjustment *models.StockAdjustment) (*models.Product, error) {
+	product, err := b.ProductRepository.AdjustStock(ctx, adjustment)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *product
+	b.events.publish(models.ProductEvent{Type: models.ProductEventUpdated, ProductID: product.ID, Product: &updated})
+	return product, nil
+}
+
+// publishUpdate publishes the current state of a product that was updated.
+func (b *productBroadcaster) publishUpdate(ctx context.Context, id primitive.ObjectID) {
+	updated, _ := b.ProductRepository.FindByID(ctx, id)
+	b.events.publish(models.ProductEvent{Type: models.ProductEventUpdated, ProductID: id, Product: updated})
+}
+
+func (b *productBroadcaster) Watch(ctx context.Context, resumeToken string, fn func(models.ProductEvent) error) error {
+	if err := b.events.watch(ctx, resumeToken, fn); err != nil {
+		return fmt.Errorf("failed to watch products: %w", err)
+	}
+	return nil
+}
@@ -4,18 +4,84 @@ import (
 	"context"
 	"fmt"
 	"p3-graded-challenge-2-ziancarlos/models"
+	"regexp"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type ProductRepository interface {
 	Create(ctx context.Context, product *models.Product) error
-	FindAll(ctx context.Context) ([]models.Product, error)
+	// Find returns one page of the products matching filter along with the
+	// token of the next page, which is empty on the last page.
+	Find(ctx context.Context, filter ProductFilter, page PageOptions) ([]models.Product, string, error)
 	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Product, error)
-	Update(ctx context.Context, id primitive.ObjectID, product *models.Product) error
+	// Update sets the name and price of a product if it is still at
+	// version, moving it to the next version, and fills product with the
+	// updated product. It fails with ErrVersionMismatch when the product
+	// was updated since.
+	Update(ctx context.Context, id primitive.ObjectID, product *models.Product, version int64) error
+	// Patch sets the fields of a product given in changes if it is still at
+	// version, moving it to the next version, and returns the updated
+	// product. It fails with ErrVersionMismatch when the product was
+	// updated since.
+	Patch(ctx context.Context, id primitive.ObjectID, changes ProductChanges, version int64) (*models.Product, error)
+	// Delete marks a product deleted. Deleted products are left out of
+	// Find, unless asked for, and FindByID, and cannot be updated, adjusted
+	// or reserved until they are restored.
 	Delete(ctx context.Context, id primitive.ObjectID) error
+	// Restore undeletes a product and returns it. It fails with ErrNotFound
+	// when no deleted product has the ID.
+	Restore(ctx context.Context, id primitive.ObjectID) (*models.Product, error)
+	// Reserve holds quantity units of a product for reservationID until
+	// expiresAt. Reserving again for the same reservation only moves its
+	// expiry. It fails with ErrInsufficientStock, holding nothing, when
+	// fewer units are available.
+	Reserve(ctx context.Context, id, reservationID primitive.ObjectID, quantity int64, expiresAt time.Time) error
+	// Release gives back the units held by a reservation, if it still
+	// exists.
+	Release(ctx context.Context, id, reservationID primitive.ObjectID) error
+	// Commit takes the units held by a reservation out of stock. It fails
+	// with ErrNotFound when the reservation expired or was released.
+	Commit(ctx context.Context, id, reservationID primitive.ObjectID) error
+	// ExpireReservations releases the reservations that expired by now and
+	// returns how many products had any.
+	ExpireReservations(ctx context.Context, now time.Time) (int64, error)
+	// AdjustStock adds adjustment.Delta to the stock of a product, setting
+	// adjustment.StockAfter, and returns the updated product. It fails with
+	// ErrInsufficientStock when the stock would drop below the reserved
+	// units.
+	AdjustStock(ctx context.Context, adjustment *models.StockAdjustment) (*models.Product, error)
+}
+
+// ProductFilter narrows a product listing. Zero fields do not filter.
+type ProductFilter struct {
+	NamePrefix    string
+	Currency      string
+	MinPrice      *models.Money
+	MaxPrice      *models.Money
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// IncludeDeleted also finds deleted products
+	IncludeDeleted bool
+}
+
+// ProductChanges are the fields of a product set by Patch. Nil fields are
+// left unchanged.
+type ProductChanges struct {
+	Name      *string
+	Price     *models.Money
+	UpdatedAt time.Time
+}
+
+// productSortFields maps the sort names accepted by Find to product fields.
+var productSortFields = map[string]string{
+	"created_at": "_id",
+	"name":       "name",
+	"price":      "price.units",
 }
 
 type productRepository struct {
@@ -37,58 +103,250 @@ func (r *productRepository) Create(ctx context.Context, product *models.Product)
 	return nil
 }
 
-func (r *productRepository) FindAll(ctx context.Context) ([]models.Product, error) {
-	cursor, err := r.collection.Find(ctx, bson.M{})
+// EnsureProductIndexes creates the indexes used to filter and sort products.
+func EnsureProductIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "price.currency", Value: 1}, {Key: "price.units", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "reservations.expires_at", Value: 1}}},
+		// Finds the deleted products due for purging
+		{
+			Keys:    bson.D{{Key: "deleted_at", Value: 1}},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"deleted_at": bson.M{"$exists": true}}),
+		},
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to find products: %w", err)
+		return fmt.Errorf("failed to create product indexes: %w", err)
 	}
-	defer cursor.Close(ctx)
+	return nil
+}
 
-	var products []models.Product
-	if err := cursor.All(ctx, &products); err != nil {
-		return nil, fmt.Errorf("failed to decode products: %w", err)
+func (r *productRepository) Find(ctx context.Context, filter ProductFilter, page PageOptions) ([]models.Product, string, error) {
+	query := bson.M{}
+	if !filter.IncludeDeleted {
+		query["deleted_at"] = nil
 	}
+	if filter.NamePrefix != "" {
+		query["name"] = bson.M{"$regex": "^" + regexp.QuoteMeta(filter.NamePrefix)}
+	}
+	addMoneyRange(query, "price", filter.Currency, filter.MinPrice, filter.MaxPrice)
+	addCreatedRange(query, filter.CreatedAfter, filter.CreatedBefore)
 
-	return products, nil
+	products, next, err := findPage[models.Product](ctx, r.collection, query, productSortFields, page)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find products: %w", err)
+	}
+
+	return products, next, nil
 }
 
 func (r *productRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Product, error) {
 	var product models.Product
-	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&product)
+	err := r.collection.FindOne(ctx, bson.M{"_id": id, "deleted_at": nil}).Decode(&product)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, fmt.Errorf("product not found")
+			return nil, fmt.Errorf("product %w", ErrNotFound)
 		}
 		return nil, fmt.Errorf("failed to find product: %w", err)
 	}
 	return &product, nil
 }
 
-func (r *productRepository) Update(ctx context.Context, id primitive.ObjectID, product *models.Product) error {
+func (r *productRepository) Update(ctx context.Context, id primitive.ObjectID, product *models.Product, version int64) error {
+	updated, err := r.update(ctx, id, bson.M{
+		"name":       product.Name,
+		"price":      product.Price,
+		"updated_at": product.UpdatedAt,
+	}, version)
+	if err != nil {
+		return err
+	}
+	*product = *updated
+	return nil
+}
+
+func (r *productRepository) Patch(ctx context.Context, id primitive.ObjectID, changes ProductChanges, version int64) (*models.Product, error) {
+	set := bson.M{"updated_at": changes.UpdatedAt}
+	if changes.Name != nil {
+		set["name"] = *changes.Name
+	}
+	if changes.Price != nil {
+		set["price"] = *changes.Price
+	}
+	return r.update(ctx, id, set, version)
+}
+
+// update sets fields of a product that is still at version, moves it to the
+// next version and returns the updated product.
+func (r *productRepository) update(ctx context.Context, id primitive.ObjectID, set bson.M, version int64) (*models.Product, error) {
+	filter := bson.M{"_id": id, "version": version, "deleted_at": nil}
+	if version == 0 {
+		// Products stored before versions were recorded have none
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
 	update := bson.M{
-		"$set": bson.M{
-			"name":  product.Name,
-			"price": product.Price,
+		"$set": set,
+		"$inc": bson.M{"version": 1},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var updated models.Product
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			current, err := r.FindByID(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("product is at version %d: %w", current.Version, ErrVersionMismatch)
+		}
+		return nil, fmt.Errorf("failed to update product: %w", err)
+	}
+	return &updated, nil
+}
+
+func (r *productRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	update := bson.M{"$set": bson.M{"deleted_at": time.Now()}}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "deleted_at": nil}, update)
+	if err != nil {
+		return fmt.Errorf("failed to delete product: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("product %w", ErrNotFound)
+	}
+	return nil
+}
+
+func (r *productRepository) Restore(ctx context.Context, id primitive.ObjectID) (*models.Product, error) {
+	var product models.Product
+	update := bson.M{"$unset": bson.M{"deleted_at": ""}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": id, "deleted_at": bson.M{"$ne": nil}}, update, opts).Decode(&product)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("deleted product %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to restore product: %w", err)
+	}
+	return &product, nil
+}
+
+func (r *productRepository) Reserve(ctx context.Context, id, reservationID primitive.ObjectID, quantity int64, expiresAt time.Time) error {
+	extended, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "reservations.id": reservationID, "deleted_at": nil},
+		bson.M{"$set": bson.M{"reservations.$.expires_at": expiresAt}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to reserve stock: %w", err)
+	}
+	if extended.MatchedCount > 0 {
+		return nil
+	}
+
+	// Checking the available units in the update itself keeps concurrent
+	// reservations from overselling
+	available := bson.M{"$subtract": bson.A{"$stock", bson.M{"$ifNull": bson.A{"$reserved", 0}}}}
+	filter := bson.M{
+		"_id":             id,
+		"deleted_at":      nil,
+		"reservations.id": bson.M{"$ne": reservationID},
+		"$or": bson.A{
+			bson.M{"stock": nil},
+			bson.M{"$expr": bson.M{"$gte": bson.A{available, quantity}}},
 		},
 	}
-	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	update := bson.M{
+		"$inc":  bson.M{"reserved": quantity},
+		"$push": bson.M{"reservations": models.StockReservation{ID: reservationID, Quantity: quantity, ExpiresAt: expiresAt}},
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
 	if err != nil {
-		return fmt.Errorf("failed to update product: %w", err)
+		return fmt.Errorf("failed to reserve stock: %w", err)
 	}
 	if result.MatchedCount == 0 {
-		return fmt.Errorf("product not found")
+		return r.stockError(ctx, id)
 	}
 	return nil
 }
 
-func (r *productRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
-	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+func (r *productRepository) Release(ctx context.Context, id, reservationID primitive.ObjectID) error {
+	update := removeReservations(bson.M{"$eq": bson.A{"$$this.id", reservationID}}, false)
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "reservations.id": reservationID}, update); err != nil {
+		return fmt.Errorf("failed to release stock: %w", err)
+	}
+	return nil
+}
+
+func (r *productRepository) Commit(ctx context.Context, id, reservationID primitive.ObjectID) error {
+	update := removeReservations(bson.M{"$eq": bson.A{"$$this.id", reservationID}}, true)
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "reservations.id": reservationID}, update)
 	if err != nil {
-		return fmt.Errorf("failed to delete product: %w", err)
+		return fmt.Errorf("failed to commit stock: %w", err)
 	}
-	if result.DeletedCount == 0 {
-		return fmt.Errorf("product not found")
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("reservation %w", ErrNotFound)
 	}
 	return nil
 }
 
+func (r *productRepository) ExpireReservations(ctx context.Context, now time.Time) (int64, error) {
+	update := removeReservations(bson.M{"$lte": bson.A{"$$this.expires_at", now}}, false)
+	result, err := r.collection.UpdateMany(ctx, bson.M{"reservations.expires_at": bson.M{"$lte": now}}, update)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire reservations: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+// removeReservations is an update removing the reservations for which cond,
+// an expression on $$this, is true. Their units are given back or, when
+// commit is set, taken out of stock.
+func removeReservations(cond bson.M, commit bool) mongo.Pipeline {
+	held := bson.M{"$sum": bson.M{"$map": bson.M{
+		"input": bson.M{"$filter": bson.M{"input": "$reservations", "cond": cond}},
+		"in":    "$$this.quantity",
+	}}}
+	set := bson.M{
+		"reserved":     bson.M{"$subtract": bson.A{"$reserved", held}},
+		"reservations": bson.M{"$filter": bson.M{"input": "$reservations", "cond": bson.M{"$not": bson.A{cond}}}},
+	}
+	if commit {
+		// Products without stock stay untracked
+		set["stock"] = bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{bson.M{"$type": "$stock"}, "missing"}},
+			"$$REMOVE",
+			bson.M{"$subtract": bson.A{"$stock", held}},
+		}}
+	}
+	return mongo.Pipeline{{{Key: "$set", Value: set}}}
+}
+
+func (r *productRepository) AdjustStock(ctx context.Context, adjustment *models.StockAdjustment) (*models.Product, error) {
+	stock := bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$stock", 0}}, adjustment.Delta}}
+	filter := bson.M{
+		"_id":        adjustment.ProductID,
+		"deleted_at": nil,
+		"$expr":      bson.M{"$gte": bson.A{stock, bson.M{"$ifNull": bson.A{"$reserved", 0}}}},
+	}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{"stock": stock, "updated_at": "$$NOW"}}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var product models.Product
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&product)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, r.stockError(ctx, adjustment.ProductID)
+		}
+		return nil, fmt.Errorf("failed to adjust stock: %w", err)
+	}
+	adjustment.StockAfter = *product.Stock
+	return &product, nil
+}
+
+// stockError explains why a conditional stock update matched no product.
+func (r *productRepository) stockError(ctx context.Context, id primitive.ObjectID) error {
+	if _, err := r.FindByID(ctx, id); err != nil {
+		return err
+	}
+	return fmt.Errorf("product %w", ErrInsufficientStock)
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"p3-graded-challenge-2-ziancarlos/models"
+)
+
+// refundLedger is a PaymentRepository that records every refund applied
+// through it.
+type refundLedger struct {
+	PaymentRepository
+	refunds      RefundRepository
+	transactions Transactor
+}
+
+// NewRefundLedger wraps repo so that every refund it applies is recorded in
+// refunds in the same transaction as the change to the refunded total, so
+// the ledger always adds up to it. Without transactions the refunded total
+// can exceed what the ledger adds up to.
+func NewRefundLedger(repo PaymentRepository, refunds RefundRepository, transactions Transactor) PaymentRepository {
+	return &refundLedger{
+		PaymentRepository: repo,
+		refunds:           refunds,
+		transactions:      transactions,
+	}
+}
+
+func (l *refundLedger) AddRefund(ctx context.Context, refund *models.Refund) (bool, error) {
+	var updated bool
+	err := l.transactions.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		updated, err = l.PaymentRepository.AddRefund(ctx, refund)
+		if err != nil || !updated {
+			return err
+		}
+		return l.refunds.Create(ctx, refund)
+	})
+	if err != nil {
+		return false, err
+	}
+	return updated, nil
+}
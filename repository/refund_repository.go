@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RefundRepository interface {
+	Create(ctx context.Context, refund *models.Refund) error
+	FindByPaymentID(ctx context.Context, paymentID primitive.ObjectID) ([]models.Refund, error)
+}
+
+type refundRepository struct {
+	collection *mongo.Collection
+}
+
+func NewRefundRepository(collection *mongo.Collection) RefundRepository {
+	return &refundRepository{
+		collection: collection,
+	}
+}
+
+func (r *refundRepository) Create(ctx context.Context, refund *models.Refund) error {
+	result, err := r.collection.InsertOne(ctx, refund)
+	if err != nil {
+		return fmt.Errorf("failed to create refund: %w", err)
+	}
+	refund.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *refundRepository) FindByPaymentID(ctx context.Context, paymentID primitive.ObjectID) ([]models.Refund, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"payment_id": paymentID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find refunds: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var refunds []models.Refund
+	if err := cursor.All(ctx, &refunds); err != nil {
+		return nil, fmt.Errorf("failed to decode refunds: %w", err)
+	}
+
+	return refunds, nil
+}
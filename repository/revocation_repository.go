@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RevocationRepository interface {
+	Create(ctx context.Context, revocation *models.TokenRevocation) error
+	// FindActive returns the revocations that have not expired yet.
+	FindActive(ctx context.Context) ([]models.TokenRevocation, error)
+}
+
+type revocationRepository struct {
+	collection *mongo.Collection
+}
+
+func NewRevocationRepository(collection *mongo.Collection) RevocationRepository {
+	return &revocationRepository{
+		collection: collection,
+	}
+}
+
+// EnsureRevocationIndexes creates a TTL index that lets MongoDB delete
+// revocations once every token they match has expired.
+func EnsureRevocationIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create revocation indexes: %w", err)
+	}
+	return nil
+}
+
+func (r *revocationRepository) Create(ctx context.Context, revocation *models.TokenRevocation) error {
+	result, err := r.collection.InsertOne(ctx, revocation)
+	if err != nil {
+		return fmt.Errorf("failed to create revocation: %w", err)
+	}
+	revocation.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *revocationRepository) FindActive(ctx context.Context) ([]models.TokenRevocation, error) {
+	// The TTL monitor only runs once a minute, so filter out expired ones
+	cursor, err := r.collection.Find(ctx, bson.M{"expires_at": bson.M{"$gt": time.Now()}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find revocations: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var revocations []models.TokenRevocation
+	if err := cursor.All(ctx, &revocations); err != nil {
+		return nil, fmt.Errorf("failed to decode revocations: %w", err)
+	}
+
+	return revocations, nil
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type StockAdjustmentRepository interface {
+	Create(ctx context.Context, adjustment *models.StockAdjustment) error
+	// Find returns one page of the adjustments of a product along with the
+	// token of the next page.
+	Find(ctx context.Context, productID primitive.ObjectID, page PageOptions) ([]models.StockAdjustment, string, error)
+}
+
+// stockAdjustmentSortFields maps the sort names accepted by Find to
+// adjustment fields.
+var stockAdjustmentSortFields = map[string]string{
+	"created_at": "_id",
+}
+
+type stockAdjustmentRepository struct {
+	collection *mongo.Collection
+}
+
+func NewStockAdjustmentRepository(collection *mongo.Collection) StockAdjustmentRepository {
+	return &stockAdjustmentRepository{
+		collection: collection,
+	}
+}
+
+// EnsureStockAdjustmentIndexes creates the index that lists the adjustments
+// of a product.
+func EnsureStockAdjustmentIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "product_id", Value: 1}, {Key: "_id", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create stock adjustment indexes: %w", err)
+	}
+	return nil
+}
+
+func (r *stockAdjustmentRepository) Create(ctx context.Context, adjustment *models.StockAdjustment) error {
+	// Adjustments are created as they happen, so their IDs sort them by time
+	result, err := r.collection.InsertOne(ctx, adjustment)
+	if err != nil {
+		return fmt.Errorf("failed to create stock adjustment: %w", err)
+	}
+	adjustment.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *stockAdjustmentRepository) Find(ctx context.Context, productID primitive.ObjectID, page PageOptions) ([]models.StockAdjustment, string, error) {
+	adjustments, next, err := findPage[models.StockAdjustment](ctx, r.collection, bson.M{"product_id": productID}, stockAdjustmentSortFields, page)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find stock adjustments: %w", err)
+	}
+	return adjustments, next, nil
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"p3-graded-challenge-2-ziancarlos/models"
+)
+
+// stockLedger is a ProductRepository that records every stock adjustment
+// made through it.
+type stockLedger struct {
+	ProductRepository
+	adjustments  StockAdjustmentRepository
+	transactions Transactor
+}
+
+// NewStockLedger wraps repo so that every stock adjustment it applies is
+// recorded in adjustments in the same transaction as the change. Without
+// transactions a stock level can change with no adjustment explaining it.
+func NewStockLedger(repo ProductRepository, adjustments StockAdjustmentRepository, transactions Transactor) ProductRepository {
+	return &stockLedger{
+		ProductRepository: repo,
+		adjustments:       adjustments,
+		transactions:      transactions,
+	}
+}
+
+func (l *stockLedger) AdjustStock(ctx context.Context, adjustment *models.StockAdjustment) (*models.Product, error) {
+	var product *models.Product
+	err := l.transactions.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		product, err = l.ProductRepository.AdjustStock(ctx, adjustment)
+		if err != nil {
+			return err
+		}
+		return l.adjustments.Create(ctx, adjustment)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
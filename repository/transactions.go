@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Transactor runs functions atomically.
+type Transactor interface {
+	// WithTransaction calls fn in a transaction, retrying it on transient
+	// errors. Repository calls made with the context passed to fn join the
+	// transaction, and so do nested WithTransaction calls.
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type transactor struct {
+	client  *mongo.Client
+	enabled bool
+}
+
+// NewTransactor creates a Transactor running transactions on client. When
+// enabled is false, as on standalone servers, fn runs without one and is
+// not atomic: if the process dies midway, the writes fn made so far stay
+// and the rest are never made.
+func NewTransactor(client *mongo.Client, enabled bool) Transactor {
+	return &transactor{
+		client:  client,
+		enabled: enabled,
+	}
+}
+
+// SupportsTransactions reports whether the deployment behind db supports
+// multi-document transactions, which, like change streams, need a replica
+// set or a sharded cluster.
+func SupportsTransactions(ctx context.Context, db *mongo.Database) (bool, error) {
+	return SupportsChangeStreams(ctx, db)
+}
+
+func (t *transactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !t.enabled || mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	session, err := t.client.StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(context.Background())
+
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessionCtx)
+	})
+	return err
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// deliveredRetention is how long successful deliveries are kept.
+const deliveredRetention = 30 * 24 * time.Hour
+
+// duplicateKeyCode is the server error code of unique index violations.
+const duplicateKeyCode = 11000
+
+type WebhookDeliveryRepository interface {
+	// CreateMany records deliveries, skipping the ones already recorded for
+	// the same webhook and event, so creating them twice is harmless.
+	CreateMany(ctx context.Context, deliveries []models.WebhookDelivery) error
+	// ClaimDue locks the pending delivery that has been due the longest for
+	// lease by moving its next attempt past the lease, so no other worker
+	// attempts it meanwhile. It fails with ErrNotFound when none is due.
+	ClaimDue(ctx context.Context, lease time.Duration) (*models.WebhookDelivery, error)
+	// RecordAttempt stores the status, attempts, next attempt and outcome
+	// of the last attempt of a delivery.
+	RecordAttempt(ctx context.Context, delivery *models.WebhookDelivery) error
+	// Find returns one page of the deliveries of a webhook, optionally
+	// filtered by status, along with the token of the next page.
+	Find(ctx context.Context, webhookID primitive.ObjectID, status models.WebhookDeliveryStatus, page PageOptions) ([]models.WebhookDelivery, string, error)
+	FindByID(ctx context.Context, webhookID, id primitive.ObjectID) (*models.WebhookDelivery, error)
+	// Retry makes a failed delivery pending again with a fresh set of
+	// attempts. It reports whether the delivery was updated.
+	Retry(ctx context.Context, webhookID, id primitive.ObjectID) (bool, error)
+	DeleteByWebhook(ctx context.Context, webhookID primitive.ObjectID) error
+}
+
+// webhookDeliverySortFields maps the sort names accepted by Find to delivery
+// fields.
+var webhookDeliverySortFields = map[string]string{
+	"created_at":      "_id",
+	"next_attempt_at": "next_attempt_at",
+}
+
+type webhookDeliveryRepository struct {
+	collection *mongo.Collection
+}
+
+func NewWebhookDeliveryRepository(collection *mongo.Collection) WebhookDeliveryRepository {
+	return &webhookDeliveryRepository{
+		collection: collection,
+	}
+}
+
+// EnsureWebhookDeliveryIndexes creates the indexes the delivery repository
+// relies on, including the unique index that makes CreateMany idempotent
+// and a TTL index that deletes successful deliveries after
+// deliveredRetention.
+func EnsureWebhookDeliveryIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "webhook_id", Value: 1}, {Key: "event_id", Value: 1}},
+			Options: options.Index().SetName("webhook_event_unique").SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "_id", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "delivered_at", Value: 1}},
+			Options: options.Index().SetName("delivered_at_ttl").SetExpireAfterSeconds(int32(deliveredRetention.Seconds())),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create webhook delivery indexes: %w", err)
+	}
+	return nil
+}
+
+func (r *webhookDeliveryRepository) CreateMany(ctx context.Context, deliveries []models.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	documents := make([]interface{}, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		documents = append(documents, delivery)
+	}
+	_, err := r.collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, writeErr := range bulkErr.WriteErrors {
+			if writeErr.Code != duplicateKeyCode {
+				return fmt.Errorf("failed to create webhook deliveries: %w", err)
+			}
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+func (r *webhookDeliveryRepository) ClaimDue(ctx context.Context, lease time.Duration) (*models.WebhookDelivery, error) {
+	now := time.Now()
+	filter := bson.M{
+		"status":          models.WebhookDeliveryPending,
+		"next_attempt_at": bson.M{"$lte": now},
+	}
+	update := bson.M{"$set": bson.M{"next_attempt_at": now.Add(lease)}}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}})
+
+	var delivery models.WebhookDelivery
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&delivery)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("webhook delivery %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to claim webhook delivery: %w", err)
+	}
+	return &delivery, nil
+}
+
+func (r *webhookDeliveryRepository) RecordAttempt(ctx context.Context, delivery *models.WebhookDelivery) error {
+	set := bson.M{
+		"status":           delivery.Status,
+		"attempts":         delivery.Attempts,
+		"next_attempt_at":  delivery.NextAttemptAt,
+		"last_error":       delivery.LastError,
+		"last_status_code": delivery.LastStatusCode,
+	}
+	if delivery.DeliveredAt != nil {
+		set["delivered_at"] = delivery.DeliveredAt
+	}
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": delivery.ID}, bson.M{"$set": set}); err != nil {
+		return fmt.Errorf("failed to record webhook delivery attempt: %w", err)
+	}
+	return nil
+}
+
+func (r *webhookDeliveryRepository) Find(ctx context.Context, webhookID primitive.ObjectID, status models.WebhookDeliveryStatus, page PageOptions) ([]models.WebhookDelivery, string, error) {
+	query := bson.M{"webhook_id": webhookID}
+	if status != "" {
+		query["status"] = status
+	}
+
+	deliveries, next, err := findPage[models.WebhookDelivery](ctx, r.collection, query, webhookDeliverySortFields, page)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find webhook deliveries: %w", err)
+	}
+
+	return deliveries, next, nil
+}
+
+func (r *webhookDeliveryRepository) FindByID(ctx context.Context, webhookID, id primitive.ObjectID) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := r.collection.FindOne(ctx, bson.M{"_id": id, "webhook_id": webhookID}).Decode(&delivery)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("webhook delivery %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to find webhook delivery: %w", err)
+	}
+	return &delivery, nil
+}
+
+func (r *webhookDeliveryRepository) Retry(ctx context.Context, webhookID, id primitive.ObjectID) (bool, error) {
+	update := bson.M{
+		"$set": bson.M{
+			"status":          models.WebhookDeliveryPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+		},
+	}
+	filter := bson.M{"_id": id, "webhook_id": webhookID, "status": models.WebhookDeliveryFailed}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to retry webhook delivery: %w", err)
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (r *webhookDeliveryRepository) DeleteByWebhook(ctx context.Context, webhookID primitive.ObjectID) error {
+	if _, err := r.collection.DeleteMany(ctx, bson.M{"webhook_id": webhookID}); err != nil {
+		return fmt.Errorf("failed to delete webhook deliveries: %w", err)
+	}
+	return nil
+}
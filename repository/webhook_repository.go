@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type WebhookRepository interface {
+	Create(ctx context.Context, webhook *models.Webhook) error
+	FindAll(ctx context.Context) ([]models.Webhook, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Webhook, error)
+	// FindSubscribed returns the active webhooks that receive events of
+	// eventType.
+	FindSubscribed(ctx context.Context, eventType models.WebhookEventType) ([]models.Webhook, error)
+	// Update replaces the URL, events and active flag of a webhook.
+	Update(ctx context.Context, id primitive.ObjectID, webhook *models.Webhook) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+type webhookRepository struct {
+	collection *mongo.Collection
+}
+
+func NewWebhookRepository(collection *mongo.Collection) WebhookRepository {
+	return &webhookRepository{
+		collection: collection,
+	}
+}
+
+func (r *webhookRepository) Create(ctx context.Context, webhook *models.Webhook) error {
+	result, err := r.collection.InsertOne(ctx, webhook)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+	webhook.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (r *webhookRepository) FindAll(ctx context.Context) ([]models.Webhook, error) {
+	return r.find(ctx, bson.M{})
+}
+
+func (r *webhookRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Webhook, error) {
+	var webhook models.Webhook
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&webhook)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("webhook %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to find webhook: %w", err)
+	}
+	return &webhook, nil
+}
+
+func (r *webhookRepository) FindSubscribed(ctx context.Context, eventType models.WebhookEventType) ([]models.Webhook, error) {
+	return r.find(ctx, bson.M{
+		"active": true,
+		"$or": bson.A{
+			bson.M{"events": eventType},
+			bson.M{"events": nil},
+			bson.M{"events": bson.A{}},
+		},
+	})
+}
+
+func (r *webhookRepository) find(ctx context.Context, filter bson.M) ([]models.Webhook, error) {
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find webhooks: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var webhooks []models.Webhook
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, fmt.Errorf("failed to decode webhooks: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+func (r *webhookRepository) Update(ctx context.Context, id primitive.ObjectID, webhook *models.Webhook) error {
+	update := bson.M{
+		"$set": bson.M{
+			"url":    webhook.URL,
+			"events": webhook.Events,
+			"active": webhook.Active,
+		},
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("webhook %w", ErrNotFound)
+	}
+	return nil
+}
+
+func (r *webhookRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("webhook %w", ErrNotFound)
+	}
+	return nil
+}
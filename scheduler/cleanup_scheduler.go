@@ -2,72 +2,84 @@ package scheduler
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
-	"time"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// CleanupScheduler handles scheduled cleanup tasks
+// defaultRetentionBatchSize is used when no positive batch size is given.
+const defaultRetentionBatchSize = 500
+
+// CleanupOptions configures how retention policies are applied.
+type CleanupOptions struct {
+	// BatchSize is how many documents are archived or deleted at once.
+	BatchSize int
+	// DryRun only counts the documents that would be removed.
+	DryRun bool
+}
+
+// CleanupScheduler applies retention policies. Register its Run with a
+// JobScheduler to apply them on a schedule, and run that job on demand
+// through the jobs API.
 type CleanupScheduler struct {
-	paymentCollection *mongo.Collection
-	productCollection *mongo.Collection
-	interval          time.Duration
+	policies []RetentionPolicy
+	options  CleanupOptions
 }
 
-// NewCleanupScheduler creates a new cleanup scheduler
-func NewCleanupScheduler(paymentCollection, productCollection *mongo.Collection, interval time.Duration) *CleanupScheduler {
+// NewCleanupScheduler creates a new cleanup scheduler.
+func NewCleanupScheduler(policies []RetentionPolicy, options CleanupOptions) *CleanupScheduler {
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaultRetentionBatchSize
+	}
 	return &CleanupScheduler{
-		paymentCollection: paymentCollection,
-		productCollection: productCollection,
-		interval:          interval,
+		policies: policies,
+		options:  options,
 	}
 }
 
-// Start begins the scheduled cleanup tasks
-func (s *CleanupScheduler) Start(ctx context.Context) {
-	ticker := time.NewTicker(s.interval)
-	defer ticker.Stop()
-
-	log.Printf("Cleanup scheduler started with interval: %v", s.interval)
-
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("Cleanup scheduler stopped")
-			return
-		case <-ticker.C:
-			s.runCleanup(ctx)
+// Run applies every retention policy, failing if any of them failed. It is
+// a JobFunc, and its counts are the cleanup metrics, kept in the history of
+// the job's runs: how many documents all policies matched, archived and
+// deleted, the same per policy as "<policy>.matched" and so on with
+// "<policy>.batches", and dry_run set to 1 when nothing was removed.
+func (s *CleanupScheduler) Run(ctx context.Context) (map[string]int64, error) {
+	counts := map[string]int64{"matched": 0, "archived": 0, "deleted": 0}
+	if s.options.DryRun {
+		counts["dry_run"] = 1
+	}
+	var errs []error
+	for _, result := range s.runCleanup(ctx) {
+		counts["matched"] += result.Matched
+		counts["archived"] += result.Archived
+		counts["deleted"] += result.Deleted
+		counts[result.Policy+".matched"] = result.Matched
+		counts[result.Policy+".archived"] = result.Archived
+		counts[result.Policy+".deleted"] = result.Deleted
+		counts[result.Policy+".batches"] = int64(result.Batches)
+		if result.Error != "" {
+			errs = append(errs, fmt.Errorf("%s: %s", result.Policy, result.Error))
 		}
 	}
+	return counts, errors.Join(errs...)
 }
 
-// runCleanup performs the cleanup operations
-func (s *CleanupScheduler) runCleanup(ctx context.Context) {
+// runCleanup applies every retention policy in turn. A failing policy does
+// not stop the ones after it.
+func (s *CleanupScheduler) runCleanup(ctx context.Context) []RetentionResult {
 	log.Println("Running scheduled cleanup...")
 
-	// Example: Delete payments older than 30 days (if there's a timestamp field)
-	// For now, we'll just log the count of documents
-	paymentCount, err := s.paymentCollection.CountDocuments(ctx, bson.M{})
-	if err != nil {
-		log.Printf("Error counting payments: %v", err)
-	} else {
-		log.Printf("Current payment count: %d", paymentCount)
-	}
+	report := make([]RetentionResult, 0, len(s.policies))
+	for _, policy := range s.policies {
+		result := policy.apply(ctx, s.options.BatchSize, s.options.DryRun)
+		report = append(report, result)
 
-	productCount, err := s.productCollection.CountDocuments(ctx, bson.M{})
-	if err != nil {
-		log.Printf("Error counting products: %v", err)
-	} else {
-		log.Printf("Current product count: %d", productCount)
+		if result.Error != "" {
+			log.Printf("Error applying retention policy %s: %s", result.Policy, result.Error)
+		}
+		log.Printf("Retention policy %s: matched=%d archived=%d deleted=%d batches=%d duration=%v dry_run=%v",
+			result.Policy, result.Matched, result.Archived, result.Deleted, result.Batches, result.Duration, result.DryRun)
 	}
 
 	log.Println("Cleanup completed")
-}
-
-// RunImmediately executes cleanup task immediately
-func (s *CleanupScheduler) RunImmediately(ctx context.Context) {
-	log.Println("Running immediate cleanup...")
-	s.runCleanup(ctx)
+	return report
 }
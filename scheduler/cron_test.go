@@ -0,0 +1,103 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule_RejectsInvalidExpressions(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{"empty", "", "expected 5 fields, got 0"},
+		{"too few fields", "* * * *", "expected 5 fields, got 4"},
+		{"too many fields", "* * * * * *", "expected 5 fields, got 6"},
+		{"minute out of range", "60 * * * *", "minute"},
+		{"hour out of range", "0 24 * * *", "hour"},
+		{"day of month zero", "0 0 0 * *", "day of month"},
+		{"month out of range", "0 0 1 13 *", "month"},
+		{"day of week out of range", "0 0 * * 8", "day of week"},
+		{"unknown name", "0 0 * FOO *", "month"},
+		{"not a number", "x * * * *", "minute"},
+		{"zero step", "*/0 * * * *", "invalid step"},
+		{"negative step", "*/-5 * * * *", "invalid step"},
+		{"reversed range", "30-10 * * * *", "invalid range"},
+		{"unknown descriptor", "@fortnightly", "expected 5 fields, got 1"},
+		{"interval not a duration", "@every soon", "at least 1s"},
+		{"interval below a second", "@every 500ms", "at least 1s"},
+		{"february 30th never runs", "0 0 30 2 *", "never runs"},
+		{"april 31st never runs", "0 0 31 4 *", "never runs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.expr)
+
+			assert.Nil(t, schedule)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestSchedule_Next(t *testing.T) {
+	at := func(value string) time.Time {
+		t.Helper()
+		parsed, err := time.Parse("2006-01-02 15:04:05", value)
+		require.NoError(t, err)
+		return parsed
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from string
+		want string
+	}{
+		{"next minute", "* * * * *", "2024-10-18 10:07:30", "2024-10-18 10:08:00"},
+		{"step within the hour", "*/15 * * * *", "2024-10-18 10:07:00", "2024-10-18 10:15:00"},
+		{"step into the next hour", "*/15 * * * *", "2024-10-18 10:45:00", "2024-10-18 11:00:00"},
+		{"step from a value", "5/20 * * * *", "2024-10-18 10:46:00", "2024-10-18 11:05:00"},
+		{"hourly", "@hourly", "2024-10-18 10:59:59", "2024-10-18 11:00:00"},
+		{"daily across a day", "@daily", "2024-10-18 00:00:00", "2024-10-19 00:00:00"},
+		{"across a month", "0 0 1 * *", "2024-01-31 12:00:00", "2024-02-01 00:00:00"},
+		{"skips short months", "0 0 31 * *", "2024-04-01 00:00:00", "2024-05-31 00:00:00"},
+		{"across a year", "@yearly", "2024-12-31 23:59:00", "2025-01-01 00:00:00"},
+		{"last minute of the year", "59 23 31 12 *", "2024-12-31 23:59:00", "2025-12-31 23:59:00"},
+		{"leap day", "0 0 29 2 *", "2024-03-01 00:00:00", "2028-02-29 00:00:00"},
+		{"month names", "0 0 1 JAN,JUL *", "2024-02-01 00:00:00", "2024-07-01 00:00:00"},
+		{"weekdays across a weekend", "0 9 * * MON-FRI", "2024-10-18 10:00:00", "2024-10-21 09:00:00"},
+		{"day of week 0 is sunday", "0 0 * * 0", "2024-10-14 00:00:00", "2024-10-20 00:00:00"},
+		{"day of week 7 is sunday", "0 0 * * 7", "2024-10-14 00:00:00", "2024-10-20 00:00:00"},
+		{"day of week 7 in a range", "0 0 * * 6-7", "2024-10-14 00:00:00", "2024-10-19 00:00:00"},
+		// 2024-10-11 is a Friday and 2024-10-13 a Sunday
+		{"day of month or day of week matches the day of week", "0 0 13 * FRI", "2024-10-05 00:00:00", "2024-10-11 00:00:00"},
+		{"day of month or day of week matches the day of month", "0 0 13 * FRI", "2024-10-11 00:00:00", "2024-10-13 00:00:00"},
+		{"any day of week only follows the day of month", "0 0 13 * *", "2024-10-05 00:00:00", "2024-10-13 00:00:00"},
+		{"day of month step and day of week both apply", "0 0 */10 * MON", "2024-10-01 00:00:00", "2024-10-21 00:00:00"},
+		{"every interval", "@every 90m", "2024-10-18 10:00:30", "2024-10-18 11:30:30"},
+		{"every interval drops fractions of a second", "@every 10s", "2024-10-18 10:00:30.75", "2024-10-18 10:00:40"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.expr)
+			require.NoError(t, err)
+
+			assert.Equal(t, at(tt.want), schedule.Next(at(tt.from)))
+		})
+	}
+}
+
+func TestSchedule_NextIsInUTC(t *testing.T) {
+	schedule, err := ParseSchedule("0 9 * * *")
+	require.NoError(t, err)
+
+	jakarta := time.FixedZone("WIB", 7*60*60)
+	next := schedule.Next(time.Date(2024, 10, 18, 10, 0, 0, 0, jakarta))
+
+	assert.Equal(t, time.Date(2024, 10, 18, 9, 0, 0, 0, time.UTC), next)
+}
@@ -0,0 +1,307 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockJobRepository struct {
+	mock.Mock
+}
+
+func (m *MockJobRepository) Register(ctx context.Context, name, schedule string, nextRunAt time.Time) error {
+	args := m.Called(ctx, name, schedule, nextRunAt)
+	return args.Error(0)
+}
+
+func (m *MockJobRepository) Acquire(ctx context.Context, name, owner string, lease time.Duration) (*models.JobState, error) {
+	args := m.Called(ctx, name, owner, lease)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.JobState), args.Error(1)
+}
+
+func (m *MockJobRepository) Renew(ctx context.Context, name, owner string, lease time.Duration) error {
+	args := m.Called(ctx, name, owner, lease)
+	return args.Error(0)
+}
+
+func (m *MockJobRepository) Finish(ctx context.Context, job *models.JobState) error {
+	args := m.Called(ctx, job)
+	return args.Error(0)
+}
+
+func (m *MockJobRepository) RequestRun(ctx context.Context, name string) (*models.JobState, error) {
+	args := m.Called(ctx, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.JobState), args.Error(1)
+}
+
+func (m *MockJobRepository) SetPaused(ctx context.Context, name string, paused bool) (*models.JobState, error) {
+	args := m.Called(ctx, name, paused)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.JobState), args.Error(1)
+}
+
+func (m *MockJobRepository) FindAll(ctx context.Context) ([]models.JobState, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]models.JobState), args.Error(1)
+}
+
+func (m *MockJobRepository) FindByName(ctx context.Context, name string) (*models.JobState, error) {
+	args := m.Called(ctx, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.JobState), args.Error(1)
+}
+
+type MockJobRunRepository struct {
+	mock.Mock
+}
+
+func (m *MockJobRunRepository) Create(ctx context.Context, run *models.JobRun) error {
+	args := m.Called(ctx, run)
+	return args.Error(0)
+}
+
+func (m *MockJobRunRepository) Finish(ctx context.Context, run *models.JobRun) error {
+	args := m.Called(ctx, run)
+	return args.Error(0)
+}
+
+func (m *MockJobRunRepository) Abandon(ctx context.Context, job string, finishedAt time.Time) (int64, error) {
+	args := m.Called(ctx, job, finishedAt)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockJobRunRepository) Find(ctx context.Context, job string, page repository.PageOptions) ([]models.JobRun, string, error) {
+	args := m.Called(ctx, job, page)
+	return args.Get(0).([]models.JobRun), args.String(1), args.Error(2)
+}
+
+// newTestScheduler returns a scheduler on mock repositories with job
+// registered to run every minute.
+func newTestScheduler(t *testing.T, job JobFunc) (*JobScheduler, *MockJobRepository, *MockJobRunRepository) {
+	jobs := new(MockJobRepository)
+	runs := new(MockJobRunRepository)
+	s := NewJobScheduler(jobs, runs)
+
+	jobs.On("Register", mock.Anything, "test-job", "* * * * *", mock.Anything).Return(nil).Once()
+	require.NoError(t, s.Register(context.Background(), "test-job", "* * * * *", job))
+	runs.On("Abandon", mock.Anything, "test-job", mock.Anything).Return(int64(0), nil).Maybe()
+	return s, jobs, runs
+}
+
+func TestJobScheduler_RunDueSkipsJobsNotDue(t *testing.T) {
+	ran := false
+	s, jobs, runs := newTestScheduler(t, func(ctx context.Context) (map[string]int64, error) {
+		ran = true
+		return nil, nil
+	})
+	jobs.On("Acquire", mock.Anything, "test-job", s.owner, jobLease).Return(nil, repository.ErrNotFound)
+
+	s.runDue(context.Background())
+	s.wg.Wait()
+
+	assert.False(t, ran)
+	jobs.AssertExpectations(t)
+	runs.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestJobScheduler_RunDueRecordsSucceededRun(t *testing.T) {
+	s, jobs, runs := newTestScheduler(t, func(ctx context.Context) (map[string]int64, error) {
+		return map[string]int64{"deleted": 3}, nil
+	})
+	jobs.On("Acquire", mock.Anything, "test-job", s.owner, jobLease).Return(&models.JobState{Name: "test-job"}, nil)
+	runs.On("Create", mock.Anything, mock.MatchedBy(func(run *models.JobRun) bool {
+		return run.Job == "test-job" && run.Trigger == models.JobRunScheduled && run.Status == models.JobRunRunning && run.RunBy == s.owner
+	})).Return(nil)
+	jobs.On("Finish", mock.Anything, mock.MatchedBy(func(state *models.JobState) bool {
+		return state.Name == "test-job" && state.LockedBy == s.owner && state.LastError == "" && state.NextRunAt.After(*state.LastFinishedAt)
+	})).Return(nil)
+	runs.On("Finish", mock.Anything, mock.MatchedBy(func(run *models.JobRun) bool {
+		return run.Status == models.JobRunSucceeded && run.FinishedAt != nil && run.Counts["deleted"] == 3
+	})).Return(nil)
+
+	s.runDue(context.Background())
+	s.wg.Wait()
+
+	jobs.AssertExpectations(t)
+	runs.AssertExpectations(t)
+	assert.Empty(t, s.running)
+}
+
+func TestJobScheduler_RunDueRecordsRequestedRunAsManual(t *testing.T) {
+	s, jobs, runs := newTestScheduler(t, func(ctx context.Context) (map[string]int64, error) {
+		return nil, nil
+	})
+	requested := time.Now()
+	jobs.On("Acquire", mock.Anything, "test-job", s.owner, jobLease).Return(&models.JobState{Name: "test-job", RunRequestedAt: &requested}, nil)
+	runs.On("Create", mock.Anything, mock.MatchedBy(func(run *models.JobRun) bool {
+		return run.Trigger == models.JobRunManual
+	})).Return(nil)
+	jobs.On("Finish", mock.Anything, mock.Anything).Return(nil)
+	runs.On("Finish", mock.Anything, mock.Anything).Return(nil)
+
+	s.runDue(context.Background())
+	s.wg.Wait()
+
+	runs.AssertExpectations(t)
+}
+
+func TestJobScheduler_RunDueRecordsFailedRun(t *testing.T) {
+	s, jobs, runs := newTestScheduler(t, func(ctx context.Context) (map[string]int64, error) {
+		return map[string]int64{"deleted": 1}, errors.New("database unavailable")
+	})
+	jobs.On("Acquire", mock.Anything, "test-job", s.owner, jobLease).Return(&models.JobState{Name: "test-job"}, nil)
+	runs.On("Create", mock.Anything, mock.Anything).Return(nil)
+	jobs.On("Finish", mock.Anything, mock.MatchedBy(func(state *models.JobState) bool {
+		return state.LastError == "database unavailable"
+	})).Return(nil)
+	runs.On("Finish", mock.Anything, mock.MatchedBy(func(run *models.JobRun) bool {
+		return run.Status == models.JobRunFailed && run.Error == "database unavailable" && run.Counts["deleted"] == 1
+	})).Return(nil)
+
+	s.runDue(context.Background())
+	s.wg.Wait()
+
+	jobs.AssertExpectations(t)
+	runs.AssertExpectations(t)
+}
+
+func TestJobScheduler_RunDueRunsJobWhenHistoryCannotBeRecorded(t *testing.T) {
+	ran := false
+	s, jobs, runs := newTestScheduler(t, func(ctx context.Context) (map[string]int64, error) {
+		ran = true
+		return nil, nil
+	})
+	jobs.On("Acquire", mock.Anything, "test-job", s.owner, jobLease).Return(&models.JobState{Name: "test-job"}, nil)
+	runs.On("Create", mock.Anything, mock.Anything).Return(errors.New("database unavailable"))
+	jobs.On("Finish", mock.Anything, mock.Anything).Return(nil)
+
+	s.runDue(context.Background())
+	s.wg.Wait()
+
+	assert.True(t, ran)
+	jobs.AssertExpectations(t)
+	runs.AssertNotCalled(t, "Finish", mock.Anything, mock.Anything)
+}
+
+func TestJobScheduler_RunDueSkipsJobStillRunning(t *testing.T) {
+	release := make(chan struct{})
+	s, jobs, runs := newTestScheduler(t, func(ctx context.Context) (map[string]int64, error) {
+		<-release
+		return nil, nil
+	})
+	jobs.On("Acquire", mock.Anything, "test-job", s.owner, jobLease).Return(&models.JobState{Name: "test-job"}, nil).Once()
+	runs.On("Create", mock.Anything, mock.Anything).Return(nil)
+	jobs.On("Finish", mock.Anything, mock.Anything).Return(nil)
+	runs.On("Finish", mock.Anything, mock.Anything).Return(nil)
+
+	ctx := context.Background()
+	s.runDue(ctx)
+	s.runDue(ctx)
+	close(release)
+	s.wg.Wait()
+
+	jobs.AssertNumberOfCalls(t, "Acquire", 1)
+}
+
+func TestJobScheduler_LostLeaseCancelsRun(t *testing.T) {
+	s, jobs, runs := newTestScheduler(t, func(ctx context.Context) (map[string]int64, error) {
+		// The job runs until the scheduler cancels it
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	s.renewInterval = 10 * time.Millisecond
+	jobs.On("Acquire", mock.Anything, "test-job", s.owner, jobLease).Return(&models.JobState{Name: "test-job"}, nil)
+	runs.On("Create", mock.Anything, mock.Anything).Return(nil)
+	jobs.On("Renew", mock.Anything, "test-job", s.owner, jobLease).Return(repository.ErrNotFound).Once()
+	// Another replica holds the lease now, so finishing fails too
+	jobs.On("Finish", mock.Anything, mock.Anything).Return(repository.ErrNotFound)
+	runs.On("Finish", mock.Anything, mock.MatchedBy(func(run *models.JobRun) bool {
+		return run.Status == models.JobRunFailed && run.Error == context.Canceled.Error()
+	})).Return(nil)
+
+	done := make(chan struct{})
+	go func() {
+		s.runDue(context.Background())
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run was not cancelled after losing the lease")
+	}
+	jobs.AssertExpectations(t)
+	runs.AssertExpectations(t)
+}
+
+func TestJobScheduler_RunAbandonsRunsOfReplicasThatDied(t *testing.T) {
+	jobs := new(MockJobRepository)
+	runs := new(MockJobRunRepository)
+	s := NewJobScheduler(jobs, runs)
+	jobs.On("Register", mock.Anything, "test-job", "* * * * *", mock.Anything).Return(nil)
+	require.NoError(t, s.Register(context.Background(), "test-job", "* * * * *", func(ctx context.Context) (map[string]int64, error) {
+		return nil, nil
+	}))
+
+	abandoned := false
+	jobs.On("Acquire", mock.Anything, "test-job", s.owner, jobLease).Return(&models.JobState{Name: "test-job"}, nil)
+	// The replica that held the lease before died mid-run
+	runs.On("Abandon", mock.Anything, "test-job", mock.Anything).Run(func(args mock.Arguments) {
+		abandoned = true
+	}).Return(int64(1), nil).Once()
+	runs.On("Create", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		assert.True(t, abandoned, "previous runs must be abandoned before the new run is recorded")
+	}).Return(nil)
+	jobs.On("Finish", mock.Anything, mock.Anything).Return(nil)
+	runs.On("Finish", mock.Anything, mock.MatchedBy(func(run *models.JobRun) bool {
+		return run.Status == models.JobRunSucceeded
+	})).Return(nil)
+
+	s.runDue(context.Background())
+	s.wg.Wait()
+
+	runs.AssertExpectations(t)
+}
+
+func TestJobScheduler_RunsJobWhenPreviousRunsCannotBeAbandoned(t *testing.T) {
+	jobs := new(MockJobRepository)
+	runs := new(MockJobRunRepository)
+	s := NewJobScheduler(jobs, runs)
+	jobs.On("Register", mock.Anything, "test-job", "* * * * *", mock.Anything).Return(nil)
+	ran := false
+	require.NoError(t, s.Register(context.Background(), "test-job", "* * * * *", func(ctx context.Context) (map[string]int64, error) {
+		ran = true
+		return nil, nil
+	}))
+
+	jobs.On("Acquire", mock.Anything, "test-job", s.owner, jobLease).Return(&models.JobState{Name: "test-job"}, nil)
+	runs.On("Abandon", mock.Anything, "test-job", mock.Anything).Return(int64(0), errors.New("database unavailable"))
+	runs.On("Create", mock.Anything, mock.Anything).Return(nil)
+	jobs.On("Finish", mock.Anything, mock.Anything).Return(nil)
+	runs.On("Finish", mock.Anything, mock.Anything).Return(nil)
+
+	s.runDue(context.Background())
+	s.wg.Wait()
+
+	assert.True(t, ran)
+	runs.AssertExpectations(t)
+}
@@ -0,0 +1,27 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"p3-graded-challenge-2-ziancarlos/service"
+)
+
+// SettleOrders returns a JobFunc that settles the orders whose payment
+// changed while no PaymentSettler was watching, and keeps the stock of the
+// orders still awaiting their payment reserved. authenticate returns ctx
+// with credentials that can read every payment. Its counts tell how many
+// orders were settled and how many still await their payment.
+func SettleOrders(orders service.OrderService, authenticate func(ctx context.Context) (context.Context, error)) JobFunc {
+	return func(ctx context.Context) (map[string]int64, error) {
+		ctx, err := authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		settled, awaiting, err := orders.SettleOrders(ctx)
+		if settled > 0 {
+			log.Printf("Settled %d orders whose payment changed", settled)
+		}
+		return map[string]int64{"settled": settled, "awaiting": awaiting}, err
+	}
+}
@@ -0,0 +1,24 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"p3-graded-challenge-2-ziancarlos/repository"
+	"time"
+)
+
+// ExpireReservations returns a JobFunc that gives back the stock held by
+// reservations past their expiry, such as those of orders never checked
+// out. Its counts tell how many products had expired reservations.
+func ExpireReservations(products repository.ProductRepository) JobFunc {
+	return func(ctx context.Context) (map[string]int64, error) {
+		expired, err := products.ExpireReservations(ctx, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if expired > 0 {
+			log.Printf("Released expired stock reservations of %d products", expired)
+		}
+		return map[string]int64{"products": expired}, nil
+	}
+}
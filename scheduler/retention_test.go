@@ -0,0 +1,188 @@
+package scheduler
+
+import (
+	"context"
+	"os"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testCollections returns empty collections named after the test on the
+// MongoDB server at TEST_MONGO_URI, skipping the test when it is not set.
+func testCollections(t *testing.T, names ...string) []*mongo.Collection {
+	uri := os.Getenv("TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGO_URI is not set")
+	}
+
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+
+	collections := make([]*mongo.Collection, 0, len(names))
+	for _, name := range names {
+		collection := client.Database("scheduler_test").Collection(t.Name() + "_" + name)
+		require.NoError(t, collection.Drop(context.Background()))
+		t.Cleanup(func() { collection.Drop(context.Background()) })
+		collections = append(collections, collection)
+	}
+	return collections
+}
+
+func TestRetentionPolicy_ExpiredFilterAgesFromObjectIDWithoutAgeField(t *testing.T) {
+	cutoff := time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)
+	policy := RetentionPolicy{Filter: bson.M{"status": "cancelled"}, AgeField: "updated_at"}
+
+	clauses := policy.expiredFilter(cutoff)["$and"].(bson.A)
+
+	require.Len(t, clauses, 2)
+	assert.Equal(t, bson.M{"status": "cancelled"}, clauses[0])
+	expired := clauses[1].(bson.M)["$or"].(bson.A)
+	require.Len(t, expired, 2)
+	assert.Equal(t, bson.M{"updated_at": bson.M{"$lt": cutoff}}, expired[0])
+	fallback := expired[1].(bson.M)
+	assert.Contains(t, fallback, "updated_at")
+	assert.Nil(t, fallback["updated_at"])
+	before := fallback["_id"].(bson.M)["$lt"].(primitive.ObjectID)
+	assert.True(t, before.Timestamp().Equal(cutoff))
+}
+
+func TestRetentionPolicy_ExpiredFilterFallsBackToObjectIDTime(t *testing.T) {
+	collections := testCollections(t, "payments")
+	payments := collections[0]
+	ctx := context.Background()
+
+	now := time.Now()
+	old := now.Add(-10 * 24 * time.Hour)
+	oldWithoutAge := primitive.NewObjectIDFromTimestamp(old)
+	oldAge := primitive.NewObjectIDFromTimestamp(now)
+	_, err := payments.InsertMany(ctx, []interface{}{
+		// Stored before payments had updated_at, so they age from their ID
+		bson.M{"_id": oldWithoutAge, "status": models.PaymentStatusCancelled},
+		bson.M{"_id": primitive.NewObjectIDFromTimestamp(now), "status": models.PaymentStatusCancelled},
+		// updated_at wins over the ID when it is set
+		bson.M{"_id": oldAge, "status": models.PaymentStatusCancelled, "updated_at": old},
+		bson.M{"_id": primitive.NewObjectIDFromTimestamp(old), "status": models.PaymentStatusCancelled, "updated_at": now},
+		// Outside the policy filter
+		bson.M{"_id": primitive.NewObjectIDFromTimestamp(old), "status": models.PaymentStatusCaptured},
+	})
+	require.NoError(t, err)
+
+	policy := RetentionPolicy{Filter: bson.M{"status": models.PaymentStatusCancelled}, AgeField: "updated_at"}
+	cursor, err := payments.Find(ctx, policy.expiredFilter(now.Add(-5*24*time.Hour)))
+	require.NoError(t, err)
+	var expired []bson.M
+	require.NoError(t, cursor.All(ctx, &expired))
+
+	var ids []primitive.ObjectID
+	for _, doc := range expired {
+		ids = append(ids, doc["_id"].(primitive.ObjectID))
+	}
+	assert.ElementsMatch(t, []primitive.ObjectID{oldWithoutAge, oldAge}, ids)
+}
+
+func TestRetentionPolicy_RemoveKeepsDocumentsChangedSinceFound(t *testing.T) {
+	collections := testCollections(t, "payments", "archive")
+	payments, archive := collections[0], collections[1]
+	ctx := context.Background()
+
+	old := time.Now().Add(-10 * 24 * time.Hour)
+	changedID := primitive.NewObjectID()
+	_, err := payments.InsertMany(ctx, []interface{}{
+		bson.M{"_id": primitive.NewObjectID(), "status": models.PaymentStatusCancelled, "updated_at": old},
+		bson.M{"_id": changedID, "status": models.PaymentStatusCancelled, "updated_at": old},
+	})
+	require.NoError(t, err)
+
+	policy := PaymentRetentionPolicies(payments, archive, 24*time.Hour, 24*time.Hour)[0]
+	filter := policy.expiredFilter(time.Now().Add(-policy.MaxAge))
+	cursor, err := payments.Find(ctx, filter)
+	require.NoError(t, err)
+	var docs []bson.M
+	require.NoError(t, cursor.All(ctx, &docs))
+	require.Len(t, docs, 2)
+
+	// The payment changes between the find and the delete
+	_, err = payments.UpdateOne(ctx, bson.M{"_id": changedID}, bson.M{"$set": bson.M{"updated_at": time.Now()}})
+	require.NoError(t, err)
+
+	var result RetentionResult
+	require.NoError(t, policy.remove(ctx, docs, filter, &result))
+
+	assert.Equal(t, int64(2), result.Archived)
+	assert.Equal(t, int64(1), result.Deleted)
+	var remaining []bson.M
+	cursor, err = payments.Find(ctx, bson.M{})
+	require.NoError(t, err)
+	require.NoError(t, cursor.All(ctx, &remaining))
+	require.Len(t, remaining, 1)
+	assert.Equal(t, changedID, remaining[0]["_id"])
+	archived, err := archive.CountDocuments(ctx, bson.M{"archived_at": bson.M{"$ne": nil}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), archived)
+}
+
+func TestRetentionPolicy_ArchivesThenDeletesInBatches(t *testing.T) {
+	collections := testCollections(t, "payments", "archive")
+	payments, archive := collections[0], collections[1]
+	ctx := context.Background()
+
+	old := time.Now().Add(-10 * 24 * time.Hour)
+	var docs []interface{}
+	for i := 0; i < 5; i++ {
+		docs = append(docs, bson.M{"_id": primitive.NewObjectID(), "status": models.PaymentStatusCancelled, "updated_at": old})
+	}
+	docs = append(docs, bson.M{"_id": primitive.NewObjectID(), "status": models.PaymentStatusCancelled, "updated_at": time.Now()})
+	_, err := payments.InsertMany(ctx, docs)
+	require.NoError(t, err)
+
+	policy := PaymentRetentionPolicies(payments, archive, 24*time.Hour, 24*time.Hour)[0]
+	result := policy.apply(ctx, 2, false)
+
+	assert.Empty(t, result.Error)
+	assert.Equal(t, int64(5), result.Matched)
+	assert.Equal(t, int64(5), result.Archived)
+	assert.Equal(t, int64(5), result.Deleted)
+	assert.Equal(t, 3, result.Batches)
+	left, err := payments.CountDocuments(ctx, bson.M{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), left)
+}
+
+func TestCleanupScheduler_DryRunOnlyCounts(t *testing.T) {
+	collections := testCollections(t, "payments", "archive")
+	payments, archive := collections[0], collections[1]
+	ctx := context.Background()
+
+	old := time.Now().Add(-10 * 24 * time.Hour)
+	_, err := payments.InsertMany(ctx, []interface{}{
+		bson.M{"_id": primitive.NewObjectID(), "status": models.PaymentStatusCancelled, "updated_at": old},
+		bson.M{"_id": primitive.NewObjectIDFromTimestamp(old), "status": models.PaymentStatusCancelled},
+		bson.M{"_id": primitive.NewObjectID(), "status": models.PaymentStatusCaptured, "updated_at": old},
+	})
+	require.NoError(t, err)
+
+	cleanup := NewCleanupScheduler(PaymentRetentionPolicies(payments, archive, 24*time.Hour, 24*time.Hour), CleanupOptions{DryRun: true})
+	counts, err := cleanup.Run(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), counts["dry_run"])
+	assert.Equal(t, int64(2), counts["matched"])
+	assert.Equal(t, int64(2), counts["archive-cancelled-payments.matched"])
+	assert.Equal(t, int64(0), counts["archived"])
+	assert.Equal(t, int64(0), counts["deleted"])
+	left, err := payments.CountDocuments(ctx, bson.M{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), left)
+	archived, err := archive.CountDocuments(ctx, bson.M{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), archived)
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/repository"
+)
+
+// AuditService queries the audit log of product and payment changes.
+type AuditService interface {
+	GetAuditLog(ctx context.Context, req *models.AuditListRequest) (*models.AuditListResponse, error)
+}
+
+type auditService struct {
+	repo repository.AuditRepository
+}
+
+func NewAuditService(repo repository.AuditRepository) AuditService {
+	return &auditService{
+		repo: repo,
+	}
+}
+
+func (s *auditService) GetAuditLog(ctx context.Context, req *models.AuditListRequest) (*models.AuditListResponse, error) {
+	page, err := pageOptions(req.ListRequest)
+	if err != nil {
+		return nil, err
+	}
+	if page.Sort == "" {
+		page.Sort = "-created_at"
+	}
+	if req.ResourceType != "" && !req.ResourceType.Valid() {
+		return nil, fmt.Errorf("%w: unknown resource type %q", ErrInvalidArgument, req.ResourceType)
+	}
+	if err := checkCreatedRange(req.CreatedAfter, req.CreatedBefore); err != nil {
+		return nil, err
+	}
+
+	entries, next, err := s.repo.Find(ctx, repository.AuditFilter{
+		Actor:         req.Actor,
+		Action:        req.Action,
+		ResourceType:  req.ResourceType,
+		ResourceID:    req.ResourceID,
+		RequestID:     req.RequestID,
+		CreatedAfter:  req.CreatedAfter,
+		CreatedBefore: req.CreatedBefore,
+	}, page)
+	if err != nil {
+		return nil, listError(err)
+	}
+
+	responses := make([]models.AuditEntryResponse, 0, len(entries))
+	for i := range entries {
+		responses = append(responses, *toAuditEntryResponse(&entries[i]))
+	}
+
+	return &models.AuditListResponse{
+		Entries:       responses,
+		NextPageToken: next,
+	}, nil
+}
+
+func toAuditEntryResponse(entry *models.AuditEntry) *models.AuditEntryResponse {
+	return &models.AuditEntryResponse{
+		ID:           entry.ID.Hex(),
+		Actor:        entry.Actor,
+		Action:       entry.Action,
+		ResourceType: entry.ResourceType,
+		ResourceID:   entry.ResourceID,
+		Before:       entry.Before,
+		After:        entry.After,
+		RequestID:    entry.RequestID,
+		CreatedAt:    entry.CreatedAt,
+	}
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/middleware"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MockAuditRepository is a mock implementation of AuditRepository
+type MockAuditRepository struct {
+	mock.Mock
+}
+
+func (m *MockAuditRepository) Create(ctx context.Context, entry *models.AuditEntry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+func (m *MockAuditRepository) Find(ctx context.Context, filter repository.AuditFilter, page repository.PageOptions) ([]models.AuditEntry, string, error) {
+	args := m.Called(ctx, filter, page)
+	return args.Get(0).([]models.AuditEntry), args.String(1), args.Error(2)
+}
+
+func TestAuditedProductService_RecordsUpdate(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	mockAudit := new(MockAuditRepository)
+	service := NewAuditedProductService(NewProductService(mockRepo, new(MockStockAdjustmentRepository), nil), mockAudit)
+
+	ctx := middleware.ContextWithRequestID(adminContext(), "req-1")
+	id := primitive.NewObjectID()
+	mockRepo.On("FindByID", mock.Anything, id).Return(&models.Product{ID: id, Name: "Keyboard", Price: usd(5000), Version: 3}, nil)
+	mockRepo.On("Update", mock.Anything, id, mock.AnythingOfType("*models.Product"), int64(3)).Return(nil)
+	var entry *models.AuditEntry
+	mockAudit.On("Create", mock.Anything, mock.MatchedBy(func(e *models.AuditEntry) bool {
+		entry = e
+		return true
+	})).Return(nil)
+
+	_, err := service.UpdateProduct(ctx, id.Hex(), 3, &models.ProductRequest{Name: "Mechanical keyboard", Price: "55.00"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "admin-1", entry.Actor)
+	assert.Equal(t, models.AuditActionUpdate, entry.Action)
+	assert.Equal(t, models.AuditResourceProduct, entry.ResourceType)
+	assert.Equal(t, id.Hex(), entry.ResourceID)
+	assert.Equal(t, "req-1", entry.RequestID)
+	assert.Equal(t, "Keyboard", entry.Before["name"])
+	assert.Equal(t, "Mechanical keyboard", entry.After["name"])
+	assert.Equal(t, "55.00", entry.After["price"])
+}
+
+func TestAuditedProductService_FailedCallIsNotRecorded(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	mockAudit := new(MockAuditRepository)
+	service := NewAuditedProductService(NewProductService(mockRepo, new(MockStockAdjustmentRepository), nil), mockAudit)
+
+	id := primitive.NewObjectID()
+	mockRepo.On("FindByID", mock.Anything, id).Return(nil, fmt.Errorf("product %w", ErrNotFound))
+	mockRepo.On("Delete", mock.Anything, id).Return(fmt.Errorf("product %w", ErrNotFound))
+
+	err := service.DeleteProduct(adminContext(), id.Hex())
+
+	assert.ErrorIs(t, err, ErrNotFound)
+	mockAudit.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestAuditedProductService_RefusesCallsWithoutCaller(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	mockAudit := new(MockAuditRepository)
+	service := NewAuditedProductService(NewProductService(mockRepo, new(MockStockAdjustmentRepository), nil), mockAudit)
+
+	// A handler that forgot to pass the caller down must not make changes
+	// the audit log cannot attribute
+	ctx := context.Background()
+	_, err := service.CreateProduct(ctx, &models.ProductRequest{Name: "Keyboard", Price: "50.00"})
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+
+	err = service.DeleteProduct(ctx, primitive.NewObjectID().Hex())
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	mockAudit.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestAuditedPaymentService_RecordsDeletion(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockAudit := new(MockAuditRepository)
+	service := NewAuditedPaymentService(NewPaymentService(mockRepo, new(MockRefundRepository), nil), mockAudit)
+
+	ctx := customerContext()
+	id := primitive.NewObjectID()
+	mockRepo.On("FindByID", mock.Anything, id).Return(&models.Payment{ID: id, Amount: usd(1000), OwnerID: "user-1"}, nil)
+	mockRepo.On("Delete", mock.Anything, id).Return(nil)
+	mockAudit.On("Create", mock.Anything, mock.MatchedBy(func(e *models.AuditEntry) bool {
+		return e.Actor == "user-1" && e.Action == models.AuditActionDelete && e.ResourceType == models.AuditResourcePayment &&
+			e.Before["amount"] == "10.00" && e.After == nil
+	})).Return(nil)
+
+	assert.NoError(t, service.DeletePayment(ctx, id.Hex()))
+	mockAudit.AssertExpectations(t)
+}
+
+func TestAuditedPaymentService_IdempotentReplayIsNotRecorded(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockAudit := new(MockAuditRepository)
+	service := NewAuditedPaymentService(NewPaymentService(mockRepo, new(MockRefundRepository), nil), mockAudit)
+
+	ctx := adminContext()
+	existing := &models.Payment{
+		ID:             primitive.NewObjectID(),
+		Amount:         usd(10050),
+		IdempotencyKey: "key-1",
+		RequestHash:    paymentRequestHash(usd(10050)),
+		CreatedAt:      time.Now().Add(-time.Hour),
+	}
+	mockRepo.On("FindByIdempotencyKey", ctx, "admin-1", "key-1").Return(existing, nil)
+
+	_, err := service.CreatePayment(ctx, &models.PaymentRequest{Amount: "100.50", IdempotencyKey: "key-1"})
+
+	assert.NoError(t, err)
+	mockAudit.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestGetAuditLog_NewestFirstByDefault(t *testing.T) {
+	mockAudit := new(MockAuditRepository)
+	service := NewAuditService(mockAudit)
+
+	filter := repository.AuditFilter{ResourceType: models.AuditResourcePayment, ResourceID: "p-1"}
+	page := repository.PageOptions{Size: models.DefaultPageSize, Sort: "-created_at"}
+	mockAudit.On("Find", mock.Anything, filter, page).Return([]models.AuditEntry{{
+		ID:           primitive.NewObjectID(),
+		Actor:        "admin-1",
+		Action:       models.AuditActionCapture,
+		ResourceType: models.AuditResourcePayment,
+		ResourceID:   "p-1",
+		Before:       map[string]interface{}{"status": "authorized"},
+		After:        map[string]interface{}{"status": "captured"},
+	}}, "next", nil)
+
+	result, err := service.GetAuditLog(adminContext(), &models.AuditListRequest{ResourceType: models.AuditResourcePayment, ResourceID: "p-1"})
+
+	assert.NoError(t, err)
+	assert.Len(t, result.Entries, 1)
+	assert.Equal(t, "captured", result.Entries[0].After["status"])
+	assert.Equal(t, "next", result.NextPageToken)
+}
+
+func TestGetAuditLog_UnknownResourceType(t *testing.T) {
+	mockAudit := new(MockAuditRepository)
+	service := NewAuditService(mockAudit)
+
+	result, err := service.GetAuditLog(adminContext(), &models.AuditListRequest{ResourceType: "order"})
+
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+	assert.Nil(t, result)
+	mockAudit.AssertNotCalled(t, "Find", mock.Anything, mock.Anything, mock.Anything)
+}
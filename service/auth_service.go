@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/repository"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// RefreshTokenTTL is how long a refresh token can be used. Each refresh
+	// issues a new token with a fresh TTL.
+	RefreshTokenTTL = 30 * 24 * time.Hour
+
+	minPasswordLength = 8
+	// bcrypt ignores everything past the first 72 bytes of a password
+	maxPasswordLength = 72
+)
+
+// AuthService manages user accounts and the refresh tokens of their login
+// sessions. Access tokens are minted by the caller from the returned
+// session's user ID.
+type AuthService interface {
+	Register(ctx context.Context, req *models.RegisterRequest) (*models.UserResponse, error)
+	Login(ctx context.Context, req *models.LoginRequest) (*models.Session, error)
+	// Refresh exchanges a refresh token for a new one. Presenting a token
+	// that was already rotated revokes the whole session, since it means
+	// the token was stolen or replayed.
+	Refresh(ctx context.Context, refreshToken string) (*models.Session, error)
+	// Logout revokes the session the refresh token belongs to.
+	Logout(ctx context.Context, refreshToken string) error
+	// SetRoles replaces the roles of a user. Callers cannot take the admin
+	// role away from themselves. The change applies to the user's access
+	// tokens from their next refresh.
+	SetRoles(ctx context.Context, userID string, req *models.UserRolesRequest) (*models.UserResponse, error)
+}
+
+type authService struct {
+	users         repository.UserRepository
+	refreshTokens repository.RefreshTokenRepository
+}
+
+// NewAuthService creates an AuthService. Users register as customers; the
+// admin role is granted afterwards by an existing admin or, for the first
+// one, by the grant-admin command.
+func NewAuthService(users repository.UserRepository, refreshTokens repository.RefreshTokenRepository) AuthService {
+	return &authService{
+		users:         users,
+		refreshTokens: refreshTokens,
+	}
+}
+
+// dummyPasswordHash is compared against when a login names an unknown email
+// so that the response time does not reveal which emails are registered.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+var errInvalidCredentials = fmt.Errorf("%w: invalid email or password", ErrUnauthenticated)
+
+func (s *authService) Register(ctx context.Context, req *models.RegisterRequest) (*models.UserResponse, error) {
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Password) < minPasswordLength {
+		return nil, fmt.Errorf("%w: password must be at least %d characters", ErrInvalidArgument, minPasswordLength)
+	}
+	if len(req.Password) > maxPasswordLength {
+		return nil, fmt.Errorf("%w: password must be at most %d bytes", ErrInvalidArgument, maxPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user := &models.User{
+		Email:        email,
+		PasswordHash: string(hash),
+		Roles:        []string{models.RoleCustomer},
+		CreatedAt:    time.Now(),
+	}
+	if err := s.users.Create(ctx, user); err != nil {
+		if errors.Is(err, repository.ErrDuplicateKey) {
+			return nil, fmt.Errorf("%w: email %s is already registered", ErrAlreadyExists, email)
+		}
+		return nil, err
+	}
+
+	return toUserResponse(user), nil
+}
+
+func (s *authService) Login(ctx context.Context, req *models.LoginRequest) (*models.Session, error) {
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		return nil, errInvalidCredentials
+	}
+
+	user, err := s.users.FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+			return nil, errInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		return nil, errInvalidCredentials
+	}
+
+	return s.issue(ctx, user, primitive.NewObjectID())
+}
+
+func (s *authService) Refresh(ctx context.Context, refreshToken string) (*models.Session, error) {
+	token, err := s.findRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	rotated := false
+	if token.RevokedAt == nil {
+		rotated, err = s.refreshTokens.Revoke(ctx, token.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !rotated {
+		log.Printf("Revoked refresh token reused for user %s, revoking its session", token.UserID.Hex())
+		if err := s.refreshTokens.RevokeFamily(ctx, token.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: refresh token has been revoked", ErrUnauthenticated)
+	}
+
+	// Reload the user so role changes apply from the next refresh
+	user, err := s.users.FindByID(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("%w: user no longer exists", ErrUnauthenticated)
+		}
+		return nil, err
+	}
+
+	return s.issue(ctx, user, token.FamilyID)
+}
+
+func (s *authService) Logout(ctx context.Context, refreshToken string) error {
+	token, err := s.findRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+
+	return s.refreshTokens.RevokeFamily(ctx, token.FamilyID)
+}
+
+func (s *authService) SetRoles(ctx context.Context, userID string, req *models.UserRolesRequest) (*models.UserResponse, error) {
+	caller, err := callerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid user ID: %v", ErrInvalidArgument, err)
+	}
+
+	roles := []string{models.RoleCustomer}
+	admin := false
+	for _, role := range req.Roles {
+		switch role {
+		case models.RoleCustomer:
+		case models.RoleAdmin:
+			admin = true
+		default:
+			return nil, fmt.Errorf("%w: unknown role %q", ErrInvalidArgument, role)
+		}
+	}
+	if admin {
+		roles = append(roles, models.RoleAdmin)
+	} else if caller.UserID == userID {
+		return nil, fmt.Errorf("%w: cannot remove your own admin role", ErrFailedPrecondition)
+	}
+
+	user, err := s.users.SetRoles(ctx, objectID, roles)
+	if err != nil {
+		return nil, err
+	}
+
+	return toUserResponse(user), nil
+}
+
+// findRefreshToken looks up an unexpired refresh token, which may already
+// be revoked.
+func (s *authService) findRefreshToken(ctx context.Context, refreshToken string) (*models.RefreshToken, error) {
+	token, err := s.refreshTokens.FindByHash(ctx, hashRefreshToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("%w: invalid refresh token", ErrUnauthenticated)
+		}
+		return nil, err
+	}
+	if time.Now().After(token.ExpiresAt) {
+		return nil, fmt.Errorf("%w: refresh token has expired", ErrUnauthenticated)
+	}
+	return token, nil
+}
+
+// issue stores a new refresh token for the user in the given session family.
+func (s *authService) issue(ctx context.Context, user *models.User, familyID primitive.ObjectID) (*models.Session, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now()
+	token := &models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hashRefreshToken(refreshToken),
+		CreatedAt: now,
+		ExpiresAt: now.Add(RefreshTokenTTL),
+	}
+	if err := s.refreshTokens.Create(ctx, token); err != nil {
+		return nil, err
+	}
+
+	return &models.Session{
+		UserID:                user.ID.Hex(),
+		Roles:                 userRoles(user),
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: token.ExpiresAt,
+	}, nil
+}
+
+func toUserResponse(user *models.User) *models.UserResponse {
+	return &models.UserResponse{
+		ID:        user.ID.Hex(),
+		Email:     user.Email,
+		Roles:     userRoles(user),
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+// userRoles returns the roles of a user. Users stored before roles were
+// introduced are customers.
+func userRoles(user *models.User) []string {
+	if len(user.Roles) == 0 {
+		return []string{models.RoleCustomer}
+	}
+	return user.Roles
+}
+
+// hashRefreshToken returns the form a refresh token is stored in. The token
+// is 256 random bits, so a fast hash is enough.
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeEmail(email string) (string, error) {
+	address, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || address.Name != "" {
+		return "", fmt.Errorf("%w: invalid email address", ErrInvalidArgument)
+	}
+	return strings.ToLower(address.Address), nil
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MockUserRepository is a mock implementation of UserRepository
+type MockUserRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserRepository) Create(ctx context.Context, user *models.User) error {
+	args := m.Called(ctx, user)
+	if args.Get(0) == nil {
+		user.ID = primitive.NewObjectID()
+		return nil
+	}
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockUserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	args := m.Called(ctx, email)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockUserRepository) SetRoles(ctx context.Context, id primitive.ObjectID, roles []string) (*models.User, error) {
+	args := m.Called(ctx, id, roles)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+// MockRefreshTokenRepository is a mock implementation of RefreshTokenRepository
+type MockRefreshTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockRefreshTokenRepository) Create(ctx context.Context, token *models.RefreshToken) error {
+	args := m.Called(ctx, token)
+	if args.Get(0) == nil {
+		token.ID = primitive.NewObjectID()
+		return nil
+	}
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) FindByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	args := m.Called(ctx, hash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.RefreshToken), args.Error(1)
+}
+
+func (m *MockRefreshTokenRepository) Revoke(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRefreshTokenRepository) RevokeFamily(ctx context.Context, familyID primitive.ObjectID) error {
+	args := m.Called(ctx, familyID)
+	return args.Error(0)
+}
+
+func (m *MockRefreshTokenRepository) RevokeUser(ctx context.Context, userID primitive.ObjectID) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func TestRegister_HashesPassword(t *testing.T) {
+	userRepo := new(MockUserRepository)
+	service := NewAuthService(userRepo, new(MockRefreshTokenRepository))
+
+	ctx := context.Background()
+	userRepo.On("Create", ctx, mock.MatchedBy(func(user *models.User) bool {
+		return user.Email == "jane@example.com" &&
+			bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte("s3cret-pass")) == nil
+	})).Return(nil)
+
+	result, err := service.Register(ctx, &models.RegisterRequest{Email: " Jane@Example.com", Password: "s3cret-pass"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "jane@example.com", result.Email)
+	assert.NotEmpty(t, result.ID)
+	userRepo.AssertExpectations(t)
+}
+
+func TestRegister_GrantsOnlyCustomerRole(t *testing.T) {
+	userRepo := new(MockUserRepository)
+	service := NewAuthService(userRepo, new(MockRefreshTokenRepository))
+
+	ctx := context.Background()
+	userRepo.On("Create", ctx, mock.AnythingOfType("*models.User")).Return(nil)
+
+	staff, err := service.Register(ctx, &models.RegisterRequest{Email: "staff@example.com", Password: "s3cret-pass"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{models.RoleCustomer}, staff.Roles)
+}
+
+func TestSetRoles_GrantsAndRevokesAdmin(t *testing.T) {
+	userRepo := new(MockUserRepository)
+	service := NewAuthService(userRepo, new(MockRefreshTokenRepository))
+
+	id := primitive.NewObjectID()
+	admin := []string{models.RoleCustomer, models.RoleAdmin}
+	customer := []string{models.RoleCustomer}
+	userRepo.On("SetRoles", mock.Anything, id, admin).Return(&models.User{ID: id, Email: "staff@example.com", Roles: admin}, nil)
+	userRepo.On("SetRoles", mock.Anything, id, customer).Return(&models.User{ID: id, Email: "staff@example.com", Roles: customer}, nil)
+
+	result, err := service.SetRoles(adminContext(), id.Hex(), &models.UserRolesRequest{Roles: []string{models.RoleAdmin}})
+	assert.NoError(t, err)
+	assert.Equal(t, admin, result.Roles)
+
+	result, err = service.SetRoles(adminContext(), id.Hex(), &models.UserRolesRequest{Roles: []string{}})
+	assert.NoError(t, err)
+	assert.Equal(t, customer, result.Roles)
+	userRepo.AssertExpectations(t)
+}
+
+func TestSetRoles_Validation(t *testing.T) {
+	userRepo := new(MockUserRepository)
+	service := NewAuthService(userRepo, new(MockRefreshTokenRepository))
+
+	_, err := service.SetRoles(adminContext(), "invalid", &models.UserRolesRequest{Roles: []string{models.RoleAdmin}})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	_, err = service.SetRoles(adminContext(), primitive.NewObjectID().Hex(), &models.UserRolesRequest{Roles: []string{"owner"}})
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+
+	// Admins cannot lock themselves out
+	self := primitive.NewObjectID().Hex()
+	ctx := ContextWithCaller(context.Background(), models.Caller{UserID: self, Roles: []string{models.RoleCustomer, models.RoleAdmin}})
+	_, err = service.SetRoles(ctx, self, &models.UserRolesRequest{Roles: []string{models.RoleCustomer}})
+	assert.ErrorIs(t, err, ErrFailedPrecondition)
+
+	_, err = service.SetRoles(context.Background(), primitive.NewObjectID().Hex(), &models.UserRolesRequest{Roles: []string{models.RoleAdmin}})
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	userRepo.AssertNotCalled(t, "SetRoles", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRegister_DuplicateEmail(t *testing.T) {
+	userRepo := new(MockUserRepository)
+	service := NewAuthService(userRepo, new(MockRefreshTokenRepository))
+
+	ctx := context.Background()
+	userRepo.On("Create", ctx, mock.Anything).Return(fmt.Errorf("failed to create user: %w", repository.ErrDuplicateKey))
+
+	result, err := service.Register(ctx, &models.RegisterRequest{Email: "jane@example.com", Password: "s3cret-pass"})
+
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+}
+
+func TestLogin_WrongPassword(t *testing.T) {
+	userRepo := new(MockUserRepository)
+	refreshRepo := new(MockRefreshTokenRepository)
+	service := NewAuthService(userRepo, refreshRepo)
+
+	ctx := context.Background()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("s3cret-pass"), bcrypt.MinCost)
+	userRepo.On("FindByEmail", ctx, "jane@example.com").Return(&models.User{ID: primitive.NewObjectID(), PasswordHash: string(hash)}, nil)
+	userRepo.On("FindByEmail", ctx, "john@example.com").Return(nil, fmt.Errorf("user %w", ErrNotFound))
+
+	for _, req := range []*models.LoginRequest{
+		{Email: "jane@example.com", Password: "wrong-pass"},
+		{Email: "john@example.com", Password: "s3cret-pass"},
+	} {
+		result, err := service.Login(ctx, req)
+
+		assert.Nil(t, result)
+		assert.ErrorIs(t, err, ErrUnauthenticated)
+	}
+	refreshRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestLogin_IssuesRefreshToken(t *testing.T) {
+	userRepo := new(MockUserRepository)
+	refreshRepo := new(MockRefreshTokenRepository)
+	service := NewAuthService(userRepo, refreshRepo)
+
+	ctx := context.Background()
+	userID := primitive.NewObjectID()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("s3cret-pass"), bcrypt.MinCost)
+	userRepo.On("FindByEmail", ctx, "jane@example.com").Return(&models.User{ID: userID, PasswordHash: string(hash)}, nil)
+	refreshRepo.On("Create", ctx, mock.AnythingOfType("*models.RefreshToken")).Return(nil)
+
+	result, err := service.Login(ctx, &models.LoginRequest{Email: "jane@example.com", Password: "s3cret-pass"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, userID.Hex(), result.UserID)
+	assert.Equal(t, []string{models.RoleCustomer}, result.Roles)
+	assert.NotEmpty(t, result.RefreshToken)
+	stored := refreshRepo.Calls[0].Arguments.Get(1).(*models.RefreshToken)
+	assert.Equal(t, hashRefreshToken(result.RefreshToken), stored.TokenHash)
+}
+
+func TestRefresh_RotatesToken(t *testing.T) {
+	userRepo := new(MockUserRepository)
+	refreshRepo := new(MockRefreshTokenRepository)
+	service := NewAuthService(userRepo, refreshRepo)
+
+	ctx := context.Background()
+	old := &models.RefreshToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    primitive.NewObjectID(),
+		FamilyID:  primitive.NewObjectID(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	refreshRepo.On("FindByHash", ctx, hashRefreshToken("old-token")).Return(old, nil)
+	refreshRepo.On("Revoke", ctx, old.ID).Return(true, nil)
+	userRepo.On("FindByID", ctx, old.UserID).Return(&models.User{ID: old.UserID, Roles: []string{models.RoleCustomer, models.RoleAdmin}}, nil)
+	refreshRepo.On("Create", ctx, mock.MatchedBy(func(token *models.RefreshToken) bool {
+		return token.FamilyID == old.FamilyID && token.UserID == old.UserID
+	})).Return(nil)
+
+	result, err := service.Refresh(ctx, "old-token")
+
+	assert.NoError(t, err)
+	assert.Equal(t, old.UserID.Hex(), result.UserID)
+	assert.Equal(t, []string{models.RoleCustomer, models.RoleAdmin}, result.Roles)
+	assert.NotEqual(t, "old-token", result.RefreshToken)
+	refreshRepo.AssertExpectations(t)
+}
+
+func TestRefresh_ReusedTokenRevokesSession(t *testing.T) {
+	userRepo := new(MockUserRepository)
+	refreshRepo := new(MockRefreshTokenRepository)
+	service := NewAuthService(userRepo, refreshRepo)
+
+	ctx := context.Background()
+	revokedAt := time.Now().Add(-time.Minute)
+	old := &models.RefreshToken{
+		ID:        primitive.NewObjectID(),
+		FamilyID:  primitive.NewObjectID(),
+		ExpiresAt: time.Now().Add(time.Hour),
+		RevokedAt: &revokedAt,
+	}
+	refreshRepo.On("FindByHash", ctx, hashRefreshToken("stolen-token")).Return(old, nil)
+	refreshRepo.On("RevokeFamily", ctx, old.FamilyID).Return(nil)
+
+	result, err := service.Refresh(ctx, "stolen-token")
+
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	refreshRepo.AssertExpectations(t)
+	refreshRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/models"
+)
+
+type callerContextKey struct{}
+
+// ContextWithCaller returns a copy of ctx carrying the authenticated caller.
+// Services use it to scope what a caller can see and change.
+func ContextWithCaller(ctx context.Context, caller models.Caller) context.Context {
+	return context.WithValue(ctx, callerContextKey{}, caller)
+}
+
+// callerFromContext returns the caller stored by ContextWithCaller.
+func callerFromContext(ctx context.Context) (models.Caller, error) {
+	caller, ok := ctx.Value(callerContextKey{}).(models.Caller)
+	if !ok || caller.UserID == "" {
+		return models.Caller{}, fmt.Errorf("%w: no authenticated caller", ErrUnauthenticated)
+	}
+	return caller, nil
+}
@@ -0,0 +1,25 @@
+package service
+
+import (
+	"errors"
+	"p3-graded-challenge-2-ziancarlos/repository"
+)
+
+var (
+	// ErrInvalidArgument is returned when a request fails validation.
+	ErrInvalidArgument = errors.New("invalid argument")
+	// ErrNotFound is returned when the requested resource does not exist.
+	ErrNotFound = repository.ErrNotFound
+	// ErrFailedPrecondition is returned when the resource is not in a state
+	// that allows the requested operation.
+	ErrFailedPrecondition = errors.New("failed precondition")
+	// ErrAlreadyExists is returned when a request conflicts with a resource
+	// that was created earlier.
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrUnauthenticated is returned when credentials are missing, wrong or
+	// no longer valid.
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrVersionMismatch is returned when a resource changed since the
+	// version a change was based on.
+	ErrVersionMismatch = repository.ErrVersionMismatch
+)
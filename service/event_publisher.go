@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"sync"
+)
+
+// EventPublisher hands the payment changes recorded in the outbox on to
+// downstream consumers.
+type EventPublisher interface {
+	// Name identifies the publisher in the outbox, which records the
+	// publishers every entry has been published to.
+	Name() string
+	// Publish publishes one change. A change is published again if the
+	// process dies before the outbox records it as published, with the same
+	// event ID, so consumers can drop duplicates.
+	Publish(ctx context.Context, entry *models.OutboxEntry) error
+}
+
+// MemoryPublisher keeps published events in memory, dropping events it has
+// already seen. It is meant for development and tests.
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	seen   map[string]bool
+	events []models.PaymentEventMessage
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{
+		seen: make(map[string]bool),
+	}
+}
+
+func (p *MemoryPublisher) Name() string {
+	return "memory"
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, entry *models.OutboxEntry) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	message := toPaymentEventMessage(entry)
+	if p.seen[message.ID] {
+		return nil
+	}
+	p.seen[message.ID] = true
+	p.events = append(p.events, message)
+	return nil
+}
+
+// Events returns the events published so far, oldest first.
+func (p *MemoryPublisher) Events() []models.PaymentEventMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]models.PaymentEventMessage(nil), p.events...)
+}
+
+type writerPublisher struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewStdoutPublisher creates an EventPublisher that writes every event to w
+// as a line of JSON, for log based pipelines.
+func NewStdoutPublisher(w io.Writer) EventPublisher {
+	return &writerPublisher{
+		w: w,
+	}
+}
+
+func (p *writerPublisher) Name() string {
+	return "stdout"
+}
+
+func (p *writerPublisher) Publish(ctx context.Context, entry *models.OutboxEntry) error {
+	line, err := json.Marshal(toPaymentEventMessage(entry))
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	return nil
+}
+
+// paymentEventType returns the public name of the type of an outbox entry.
+func paymentEventType(entry *models.OutboxEntry) models.WebhookEventType {
+	return models.WebhookEventType("payment." + string(entry.Type))
+}
+
+func toPaymentEventMessage(entry *models.OutboxEntry) models.PaymentEventMessage {
+	message := models.PaymentEventMessage{
+		ID:        entry.ID.Hex(),
+		Type:      paymentEventType(entry),
+		CreatedAt: entry.CreatedAt,
+		PaymentID: entry.PaymentID.Hex(),
+	}
+	if entry.Payment != nil {
+		message.Payment = toPaymentResponse(entry.Payment)
+	}
+	return message
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/repository"
+	"time"
+)
+
+// JobService inspects and controls the jobs run by the job scheduler of
+// every replica.
+type JobService interface {
+	GetAllJobs(ctx context.Context) ([]models.JobResponse, error)
+	// RunJob asks for a run of a job as soon as a replica picks it up, even
+	// if the job is paused.
+	RunJob(ctx context.Context, name string) (*models.JobResponse, error)
+	// PauseJob stops the scheduled runs of a job. A run in progress is not
+	// interrupted.
+	PauseJob(ctx context.Context, name string) (*models.JobResponse, error)
+	// ResumeJob restarts the scheduled runs of a job. A run that was due
+	// while the job was paused happens right away.
+	ResumeJob(ctx context.Context, name string) (*models.JobResponse, error)
+	GetJobRuns(ctx context.Context, name string, req *models.ListRequest) (*models.JobRunListResponse, error)
+}
+
+type jobService struct {
+	repo repository.JobRepository
+	runs repository.JobRunRepository
+}
+
+func NewJobService(repo repository.JobRepository, runs repository.JobRunRepository) JobService {
+	return &jobService{
+		repo: repo,
+		runs: runs,
+	}
+}
+
+func (s *jobService) GetAllJobs(ctx context.Context) ([]models.JobResponse, error) {
+	jobs, err := s.repo.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	responses := make([]models.JobResponse, 0, len(jobs))
+	for i := range jobs {
+		responses = append(responses, *toJobResponse(&jobs[i], now))
+	}
+	return responses, nil
+}
+
+func (s *jobService) RunJob(ctx context.Context, name string) (*models.JobResponse, error) {
+	job, err := s.repo.RequestRun(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return toJobResponse(job, time.Now()), nil
+}
+
+func (s *jobService) PauseJob(ctx context.Context, name string) (*models.JobResponse, error) {
+	job, err := s.repo.SetPaused(ctx, name, true)
+	if err != nil {
+		return nil, err
+	}
+	return toJobResponse(job, time.Now()), nil
+}
+
+func (s *jobService) ResumeJob(ctx context.Context, name string) (*models.JobResponse, error) {
+	job, err := s.repo.SetPaused(ctx, name, false)
+	if err != nil {
+		return nil, err
+	}
+	return toJobResponse(job, time.Now()), nil
+}
+
+func (s *jobService) GetJobRuns(ctx context.Context, name string, req *models.ListRequest) (*models.JobRunListResponse, error) {
+	if _, err := s.repo.FindByName(ctx, name); err != nil {
+		return nil, err
+	}
+
+	page, err := pageOptions(*req)
+	if err != nil {
+		return nil, err
+	}
+	if page.Sort == "" {
+		page.Sort = "-started_at"
+	}
+
+	runs, next, err := s.runs.Find(ctx, name, page)
+	if err != nil {
+		return nil, listError(err)
+	}
+
+	responses := make([]models.JobRunResponse, 0, len(runs))
+	for i := range runs {
+		responses = append(responses, *toJobRunResponse(&runs[i]))
+	}
+
+	return &models.JobRunListResponse{
+		Runs:          responses,
+		NextPageToken: next,
+	}, nil
+}
+
+func toJobResponse(job *models.JobState, now time.Time) *models.JobResponse {
+	response := &models.JobResponse{
+		Name:           job.Name,
+		Schedule:       job.Schedule,
+		Paused:         job.Paused,
+		NextRunAt:      job.NextRunAt,
+		RunRequestedAt: job.RunRequestedAt,
+		LastStartedAt:  job.LastStartedAt,
+		LastFinishedAt: job.LastFinishedAt,
+		LastError:      job.LastError,
+	}
+	// An expired lease belongs to a replica that died mid-run
+	if job.LockedUntil != nil && job.LockedUntil.After(now) {
+		response.RunningOn = job.LockedBy
+	}
+	return response
+}
+
+func toJobRunResponse(run *models.JobRun) *models.JobRunResponse {
+	response := &models.JobRunResponse{
+		ID:         run.ID.Hex(),
+		Job:        run.Job,
+		Trigger:    run.Trigger,
+		RunBy:      run.RunBy,
+		Status:     run.Status,
+		StartedAt:  run.StartedAt,
+		FinishedAt: run.FinishedAt,
+		Error:      run.Error,
+		Counts:     run.Counts,
+	}
+	if run.FinishedAt != nil {
+		response.DurationMS = run.FinishedAt.Sub(run.StartedAt).Milliseconds()
+	}
+	return response
+}
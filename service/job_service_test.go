@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Mock repositories
+type MockJobRepository struct {
+	mock.Mock
+}
+
+func (m *MockJobRepository) Register(ctx context.Context, name, schedule string, nextRunAt time.Time) error {
+	args := m.Called(ctx, name, schedule, nextRunAt)
+	return args.Error(0)
+}
+
+func (m *MockJobRepository) Acquire(ctx context.Context, name, owner string, lease time.Duration) (*models.JobState, error) {
+	args := m.Called(ctx, name, owner, lease)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.JobState), args.Error(1)
+}
+
+func (m *MockJobRepository) Renew(ctx context.Context, name, owner string, lease time.Duration) error {
+	args := m.Called(ctx, name, owner, lease)
+	return args.Error(0)
+}
+
+func (m *MockJobRepository) Finish(ctx context.Context, job *models.JobState) error {
+	args := m.Called(ctx, job)
+	return args.Error(0)
+}
+
+func (m *MockJobRepository) RequestRun(ctx context.Context, name string) (*models.JobState, error) {
+	args := m.Called(ctx, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.JobState), args.Error(1)
+}
+
+func (m *MockJobRepository) SetPaused(ctx context.Context, name string, paused bool) (*models.JobState, error) {
+	args := m.Called(ctx, name, paused)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.JobState), args.Error(1)
+}
+
+func (m *MockJobRepository) FindAll(ctx context.Context) ([]models.JobState, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]models.JobState), args.Error(1)
+}
+
+func (m *MockJobRepository) FindByName(ctx context.Context, name string) (*models.JobState, error) {
+	args := m.Called(ctx, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.JobState), args.Error(1)
+}
+
+type MockJobRunRepository struct {
+	mock.Mock
+}
+
+func (m *MockJobRunRepository) Create(ctx context.Context, run *models.JobRun) error {
+	args := m.Called(ctx, run)
+	return args.Error(0)
+}
+
+func (m *MockJobRunRepository) Finish(ctx context.Context, run *models.JobRun) error {
+	args := m.Called(ctx, run)
+	return args.Error(0)
+}
+
+func (m *MockJobRunRepository) Abandon(ctx context.Context, job string, finishedAt time.Time) (int64, error) {
+	args := m.Called(ctx, job, finishedAt)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockJobRunRepository) Find(ctx context.Context, job string, page repository.PageOptions) ([]models.JobRun, string, error) {
+	args := m.Called(ctx, job, page)
+	return args.Get(0).([]models.JobRun), args.String(1), args.Error(2)
+}
+
+func TestGetAllJobs_ReportsRunningReplica(t *testing.T) {
+	mockRepo := new(MockJobRepository)
+	service := NewJobService(mockRepo, new(MockJobRunRepository))
+
+	leased, expired := time.Now().Add(time.Minute), time.Now().Add(-time.Minute)
+	mockRepo.On("FindAll", mock.Anything).Return([]models.JobState{
+		{Name: "cleanup", Schedule: "0 3 * * *", LockedBy: "replica-1", LockedUntil: &leased},
+		{Name: "expire", Schedule: "@every 1m", LockedBy: "replica-2", LockedUntil: &expired},
+	}, nil)
+
+	jobs, err := service.GetAllJobs(adminContext())
+
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, "replica-1", jobs[0].RunningOn)
+	// The lease of a replica that died mid-run has expired
+	assert.Empty(t, jobs[1].RunningOn)
+}
+
+func TestRunJob_RequestsRun(t *testing.T) {
+	mockRepo := new(MockJobRepository)
+	service := NewJobService(mockRepo, new(MockJobRunRepository))
+
+	requested := time.Now()
+	mockRepo.On("RequestRun", mock.Anything, "cleanup").Return(&models.JobState{Name: "cleanup", Paused: true, RunRequestedAt: &requested}, nil)
+
+	job, err := service.RunJob(adminContext(), "cleanup")
+
+	assert.NoError(t, err)
+	assert.Equal(t, &requested, job.RunRequestedAt)
+	assert.True(t, job.Paused)
+}
+
+func TestRunJob_UnknownJob(t *testing.T) {
+	mockRepo := new(MockJobRepository)
+	service := NewJobService(mockRepo, new(MockJobRunRepository))
+
+	mockRepo.On("RequestRun", mock.Anything, "missing").Return(nil, fmt.Errorf("job %w", ErrNotFound))
+
+	job, err := service.RunJob(adminContext(), "missing")
+
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Nil(t, job)
+}
+
+func TestPauseAndResumeJob(t *testing.T) {
+	mockRepo := new(MockJobRepository)
+	service := NewJobService(mockRepo, new(MockJobRunRepository))
+
+	mockRepo.On("SetPaused", mock.Anything, "cleanup", true).Return(&models.JobState{Name: "cleanup", Paused: true}, nil)
+	mockRepo.On("SetPaused", mock.Anything, "cleanup", false).Return(&models.JobState{Name: "cleanup"}, nil)
+
+	paused, err := service.PauseJob(adminContext(), "cleanup")
+	assert.NoError(t, err)
+	assert.True(t, paused.Paused)
+
+	resumed, err := service.ResumeJob(adminContext(), "cleanup")
+	assert.NoError(t, err)
+	assert.False(t, resumed.Paused)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetJobRuns_NewestFirstByDefault(t *testing.T) {
+	mockRepo := new(MockJobRepository)
+	mockRuns := new(MockJobRunRepository)
+	service := NewJobService(mockRepo, mockRuns)
+
+	started := time.Now().Add(-time.Minute)
+	finished := started.Add(1500 * time.Millisecond)
+	mockRepo.On("FindByName", mock.Anything, "cleanup").Return(&models.JobState{Name: "cleanup"}, nil)
+	mockRuns.On("Find", mock.Anything, "cleanup", repository.PageOptions{Size: models.DefaultPageSize, Sort: "-started_at"}).Return([]models.JobRun{{
+		ID:         primitive.NewObjectID(),
+		Job:        "cleanup",
+		Trigger:    models.JobRunManual,
+		Status:     models.JobRunSucceeded,
+		StartedAt:  started,
+		FinishedAt: &finished,
+		Counts:     map[string]int64{"deleted": 3},
+	}}, "next", nil)
+
+	result, err := service.GetJobRuns(adminContext(), "cleanup", &models.ListRequest{})
+
+	assert.NoError(t, err)
+	assert.Len(t, result.Runs, 1)
+	assert.Equal(t, int64(1500), result.Runs[0].DurationMS)
+	assert.Equal(t, int64(3), result.Runs[0].Counts["deleted"])
+	assert.Equal(t, "next", result.NextPageToken)
+}
+
+func TestGetJobRuns_UnknownJob(t *testing.T) {
+	mockRepo := new(MockJobRepository)
+	mockRuns := new(MockJobRunRepository)
+	service := NewJobService(mockRepo, mockRuns)
+
+	mockRepo.On("FindByName", mock.Anything, "missing").Return(nil, fmt.Errorf("job %w", ErrNotFound))
+
+	result, err := service.GetJobRuns(adminContext(), "missing", &models.ListRequest{})
+
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Nil(t, result)
+	mockRuns.AssertNotCalled(t, "Find", mock.Anything, mock.Anything, mock.Anything)
+}
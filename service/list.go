@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/repository"
+	"strings"
+	"time"
+)
+
+// pageOptions validates the paging parameters of a list request, applying
+// the default page size and capping it at models.MaxPageSize.
+func pageOptions(req models.ListRequest) (repository.PageOptions, error) {
+	size := req.PageSize
+	switch {
+	case size < 0:
+		return repository.PageOptions{}, fmt.Errorf("%w: page_size must not be negative", ErrInvalidArgument)
+	case size == 0:
+		size = models.DefaultPageSize
+	case size > models.MaxPageSize:
+		size = models.MaxPageSize
+	}
+
+	return repository.PageOptions{
+		Size:  size,
+		Token: req.PageToken,
+		Sort:  req.Sort,
+	}, nil
+}
+
+// parseAmountRange parses the bounds of an amount filter. The currency
+// defaults to models.DefaultCurrency when either bound is set and is
+// returned upper-cased.
+func parseAmountRange(field string, min, max models.Decimal, currency string) (string, *models.Money, *models.Money, error) {
+	currency = strings.ToUpper(currency)
+	if currency == "" && (min != "" || max != "") {
+		currency = models.DefaultCurrency
+	}
+
+	parse := func(name string, amount models.Decimal) (*models.Money, error) {
+		if amount == "" {
+			return nil, nil
+		}
+		money, err := models.ParseMoney(amount, currency)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidArgument, name, err)
+		}
+		return &money, nil
+	}
+
+	minMoney, err := parse("min_"+field, min)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	maxMoney, err := parse("max_"+field, max)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if minMoney != nil && maxMoney != nil && minMoney.Units > maxMoney.Units {
+		return "", nil, nil, fmt.Errorf("%w: min_%s must not exceed max_%s", ErrInvalidArgument, field, field)
+	}
+
+	return currency, minMoney, maxMoney, nil
+}
+
+// checkCreatedRange rejects a creation time filter that cannot match.
+func checkCreatedRange(after, before time.Time) error {
+	if !after.IsZero() && !before.IsZero() && !after.Before(before) {
+		return fmt.Errorf("%w: created_after must be before created_before", ErrInvalidArgument)
+	}
+	return nil
+}
+
+// listError reports an invalid sort or page token as an invalid argument.
+func listError(err error) error {
+	if errors.Is(err, repository.ErrInvalidQuery) {
+		return fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+	}
+	return err
+}
+
+// watchError reports the end of a watch. Watches end without error once
+// their context is done; expired resume tokens are a failed precondition,
+// after which clients reload and watch without one.
+func watchError(ctx context.Context, err error) error {
+	switch {
+	case ctx.Err() != nil:
+		return nil
+	case errors.Is(err, repository.ErrResumeTokenExpired):
+		return fmt.Errorf("%w: resume token expired, reload and watch without one", ErrFailedPrecondition)
+	default:
+		return listError(err)
+	}
+}
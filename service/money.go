@@ -0,0 +1,27 @@
+package service
+
+import (
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"strings"
+)
+
+// parsePositiveAmount converts a decimal amount to Money, checking that the
+// currency is supported, that the amount has no more decimal places than the
+// currency allows, and that it is greater than zero. An empty currency
+// defaults to models.DefaultCurrency.
+func parsePositiveAmount(field string, amount models.Decimal, currency string) (models.Money, error) {
+	if currency == "" {
+		currency = models.DefaultCurrency
+	}
+
+	money, err := models.ParseMoney(amount, strings.ToUpper(currency))
+	if err != nil {
+		return models.Money{}, fmt.Errorf("%w: %s: %v", ErrInvalidArgument, field, err)
+	}
+	if money.Units <= 0 {
+		return models.Money{}, fmt.Errorf("%w: %s must be greater than 0", ErrInvalidArgument, field)
+	}
+
+	return money, nil
+}
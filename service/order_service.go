@@ -0,0 +1,538 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/repository"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// orderReservationTTL is how long the stock of a pending order stays
+// reserved. Checking out reserves it again.
+const orderReservationTTL = 15 * time.Minute
+
+// paymentReservationTTL is how long the stock of an order awaiting its
+// payment stays reserved. SettleOrders extends it while the payment is
+// pending.
+const paymentReservationTTL = 24 * time.Hour
+
+type OrderService interface {
+	CreateOrder(ctx context.Context, req *models.OrderRequest) (*models.OrderResponse, error)
+	GetAllOrders(ctx context.Context) ([]models.OrderResponse, error)
+	GetOrderByID(ctx context.Context, id string) (*models.OrderResponse, error)
+	DeleteOrder(ctx context.Context, id string) error
+	// Checkout prices the order with the current product prices and
+	// creates its payment through the PaymentService. The order then
+	// awaits its payment, keeping its stock reserved until SettlePayment
+	// is called. An order left in processing by a checkout that failed
+	// midway is checked out at the price it was claimed at, replaying its
+	// payment if one was made. Only the owner of the order can check it
+	// out, since the payment is made as the caller.
+	Checkout(ctx context.Context, id string) (*models.OrderResponse, error)
+	// SettlePayment completes the checkout of the order awaiting a payment.
+	// A captured payment takes the reserved stock out of stock and marks
+	// the order paid. A failed, cancelled or refunded one gives the stock
+	// back and cancels the order. Other payments are ignored.
+	SettlePayment(ctx context.Context, payment *models.PaymentResponse) error
+	// SettleOrders looks up the payment of every order awaiting one. It
+	// settles the orders whose payment changed while nobody called
+	// SettlePayment, and keeps the stock of the others reserved. ctx must
+	// carry credentials that can read every payment. It returns how many
+	// orders were settled and how many still await their payment.
+	SettleOrders(ctx context.Context) (settled, awaiting int64, err error)
+}
+
+type orderService struct {
+	repo           repository.OrderRepository
+	productRepo    repository.ProductRepository
+	paymentService PaymentService
+}
+
+func NewOrderService(repo repository.OrderRepository, productRepo repository.ProductRepository, paymentService PaymentService) OrderService {
+	return &orderService{
+		repo:           repo,
+		productRepo:    productRepo,
+		paymentService: paymentService,
+	}
+}
+
+func (s *orderService) CreateOrder(ctx context.Context, req *models.OrderRequest) (*models.OrderResponse, error) {
+	caller, err := callerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Items) == 0 {
+		return nil, fmt.Errorf("%w: order must contain at least one item", ErrInvalidArgument)
+	}
+
+	var items []models.OrderItem
+	for _, item := range req.Items {
+		if item.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: quantity must be greater than 0", ErrInvalidArgument)
+		}
+
+		productID, err := primitive.ObjectIDFromHex(item.ProductID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid product ID: %v", ErrInvalidArgument, err)
+		}
+
+		product, err := s.productRepo.FindByID(ctx, productID)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return nil, fmt.Errorf("%w: product %s not found", ErrInvalidArgument, item.ProductID)
+			}
+			return nil, err
+		}
+
+		items = append(items, models.OrderItem{
+			ProductID: product.ID,
+			Name:      product.Name,
+			Quantity:  item.Quantity,
+			Price:     product.Price,
+		})
+	}
+
+	total, err := orderTotal(items)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+	}
+
+	reservedUntil := time.Now().Add(orderReservationTTL)
+	order := &models.Order{
+		// The ID is known up front since the reservations are made for it
+		ID:            primitive.NewObjectID(),
+		Items:         items,
+		Total:         total,
+		Status:        models.OrderStatusPending,
+		OwnerID:       caller.UserID,
+		ReservedUntil: &reservedUntil,
+	}
+
+	if err := s.reserve(ctx, order, reservedUntil); err != nil {
+		s.releaseStock(ctx, order)
+		return nil, err
+	}
+
+	err = s.repo.Create(ctx, order)
+	if err != nil {
+		s.releaseStock(ctx, order)
+		return nil, err
+	}
+
+	return toOrderResponse(order), nil
+}
+
+func (s *orderService) GetAllOrders(ctx context.Context) ([]models.OrderResponse, error) {
+	caller, err := callerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ownerID := caller.UserID
+	if caller.IsAdmin() {
+		ownerID = ""
+	}
+
+	orders, err := s.repo.FindAll(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	var responses []models.OrderResponse
+	for i := range orders {
+		responses = append(responses, *toOrderResponse(&orders[i]))
+	}
+
+	return responses, nil
+}
+
+func (s *orderService) GetOrderByID(ctx context.Context, id string) (*models.OrderResponse, error) {
+	order, err := s.findOwnedOrder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return toOrderResponse(order), nil
+}
+
+func (s *orderService) DeleteOrder(ctx context.Context, id string) error {
+	order, err := s.findOwnedOrder(ctx, id)
+	if err != nil {
+		return err
+	}
+	if order.Status != models.OrderStatusPending {
+		return fmt.Errorf("%w: cannot delete an order that is %s", ErrFailedPrecondition, order.Status)
+	}
+
+	if err := s.repo.Delete(ctx, order.ID); err != nil {
+		return err
+	}
+
+	s.releaseStock(ctx, order)
+	return nil
+}
+
+func (s *orderService) Checkout(ctx context.Context, id string) (*models.OrderResponse, error) {
+	order, err := s.findOwnedOrder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// Admins can see the order, but paying for it would make the payment
+	// theirs instead of the owner's
+	caller, err := callerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if order.OwnerID != caller.UserID {
+		return nil, fmt.Errorf("%w: only the owner of an order can check it out", ErrFailedPrecondition)
+	}
+
+	switch order.Status {
+	case models.OrderStatusPending:
+		if err := s.claim(ctx, order); err != nil {
+			return nil, err
+		}
+	case models.OrderStatusProcessing:
+		// An earlier checkout stopped after claiming the order, maybe
+		// after creating its payment. Paying under the same idempotency
+		// key finishes it without paying twice.
+	default:
+		return nil, fmt.Errorf("%w: order is already %s", ErrFailedPrecondition, order.Status)
+	}
+
+	paid, err := s.pay(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+
+	return toOrderResponse(paid), nil
+}
+
+// findOwnedOrder looks up an order of the caller. Orders of other users are
+// reported as not found unless the caller is an admin.
+func (s *orderService) findOwnedOrder(ctx context.Context, id string) (*models.Order, error) {
+	caller, err := callerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid order ID: %v", ErrInvalidArgument, err)
+	}
+
+	order, err := s.repo.FindByID(ctx, objectID)
+	if err != nil {
+		return nil, err
+	}
+	if order.OwnerID != caller.UserID && !caller.IsAdmin() {
+		return nil, fmt.Errorf("order %w", ErrNotFound)
+	}
+
+	return order, nil
+}
+
+// claim reprices a pending order and moves it to processing, so that
+// concurrent checkouts cannot price it differently.
+func (s *orderService) claim(ctx context.Context, order *models.Order) error {
+	items := make([]models.OrderItem, 0, len(order.Items))
+	for _, item := range order.Items {
+		product, err := s.productRepo.FindByID(ctx, item.ProductID)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("%w: product %s is no longer available", ErrFailedPrecondition, item.ProductID.Hex())
+			}
+			return err
+		}
+
+		item.Name = product.Name
+		item.Price = product.Price
+		items = append(items, item)
+	}
+
+	total, err := orderTotal(items)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrFailedPrecondition, err)
+	}
+
+	claimed, err := s.repo.Claim(ctx, order.ID, items, total)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return fmt.Errorf("%w: order is no longer pending", ErrFailedPrecondition)
+	}
+
+	order.Items = items
+	order.Total = total
+	order.Status = models.OrderStatusProcessing
+	return nil
+}
+
+// pay creates the payment of a claimed order. The order is released back to
+// pending if its stock is gone or the payment was refused. It stays in
+// processing after errors that may hide a created payment, such as
+// timeouts, so that checking it out again replays that payment.
+func (s *orderService) pay(ctx context.Context, order *models.Order) (*models.Order, error) {
+	// Reservations that expired are made again, so the stock is not sold
+	// twice while the payment is made. The stored reserved_until may then be
+	// earlier than the reservations, which is only conservative.
+	if err := s.reserve(ctx, order, time.Now().Add(orderReservationTTL)); err != nil {
+		s.release(ctx, order.ID)
+		return nil, err
+	}
+
+	// A retry after an error that hid a created payment, such as a timeout,
+	// gets that payment back instead of paying for the order twice
+	payment, err := s.paymentService.CreatePayment(ctx, &models.PaymentRequest{
+		Amount:         order.Total.Decimal(),
+		Currency:       order.Total.Currency,
+		IdempotencyKey: orderIdempotencyKey(order.ID),
+	})
+	if err != nil {
+		if paymentRefused(err) {
+			s.release(ctx, order.ID)
+		}
+		return nil, err
+	}
+
+	recorded, err := s.repo.AwaitPayment(ctx, order.ID, payment.ID)
+	if err != nil {
+		log.Printf("Payment %s created but not recorded on order %s, checking it out again records it: %v", payment.ID, order.ID.Hex(), err)
+		return nil, err
+	}
+
+	order.Status = models.OrderStatusAwaitingPayment
+	order.PaymentID = payment.ID
+	order.ReservedUntil = nil
+	if !recorded {
+		// A concurrent checkout of the order recorded the payment first
+		return order, nil
+	}
+
+	// The stock stays reserved until the payment is settled. Failures are
+	// only logged since SettleOrders reserves it again.
+	if err := s.reserve(ctx, order, time.Now().Add(paymentReservationTTL)); err != nil {
+		log.Printf("Failed to reserve stock of order %s until its payment is settled: %v", order.ID.Hex(), err)
+	}
+
+	// A replayed payment may be settled already
+	if _, err := s.settle(ctx, order, payment.Status); err != nil {
+		log.Printf("Failed to settle order %s: %v", order.ID.Hex(), err)
+	}
+	return order, nil
+}
+
+func (s *orderService) SettlePayment(ctx context.Context, payment *models.PaymentResponse) error {
+	order, err := s.repo.FindByPaymentID(ctx, payment.ID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = s.settle(ctx, order, payment.Status)
+	return err
+}
+
+func (s *orderService) SettleOrders(ctx context.Context) (settled, awaiting int64, err error) {
+	orders, err := s.repo.FindByStatus(ctx, models.OrderStatusAwaitingPayment)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var errs []error
+	for i := range orders {
+		order := &orders[i]
+		payment, err := s.paymentService.GetPaymentByID(ctx, order.PaymentID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to look up payment of order %s: %w", order.ID.Hex(), err))
+			continue
+		}
+
+		done, err := s.settle(ctx, order, payment.Status)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to settle order %s: %w", order.ID.Hex(), err))
+			continue
+		}
+		if done {
+			settled++
+			continue
+		}
+
+		awaiting++
+		if err := s.reserve(ctx, order, time.Now().Add(paymentReservationTTL)); err != nil {
+			errs = append(errs, fmt.Errorf("failed to keep stock of order %s reserved: %w", order.ID.Hex(), err))
+		}
+	}
+	return settled, awaiting, errors.Join(errs...)
+}
+
+// settle moves an order awaiting its payment to paid or cancelled once the
+// payment is in a final status. It reports whether it settled the order.
+func (s *orderService) settle(ctx context.Context, order *models.Order, paymentStatus models.PaymentStatus) (bool, error) {
+	if order.Status != models.OrderStatusAwaitingPayment {
+		return false, nil
+	}
+
+	// The stock is settled before the order, so a settlement that stops
+	// midway is finished by the next one
+	var to models.OrderStatus
+	switch paymentStatus {
+	case models.PaymentStatusCaptured:
+		if err := s.commitStock(ctx, order); err != nil {
+			return false, err
+		}
+		to = models.OrderStatusPaid
+	case models.PaymentStatusFailed, models.PaymentStatusCancelled, models.PaymentStatusRefunded:
+		s.releaseStock(ctx, order)
+		to = models.OrderStatusCancelled
+	default:
+		return false, nil
+	}
+
+	settled, err := s.repo.UpdateStatus(ctx, order.ID, models.OrderStatusAwaitingPayment, to)
+	if err != nil {
+		return false, err
+	}
+	if settled {
+		order.Status = to
+	}
+	return settled, nil
+}
+
+func (s *orderService) release(ctx context.Context, id primitive.ObjectID) {
+	if _, err := s.repo.UpdateStatus(ctx, id, models.OrderStatusProcessing, models.OrderStatusPending); err != nil {
+		log.Printf("Failed to release order %s after checkout error: %v", id.Hex(), err)
+	}
+}
+
+// reserve holds the stock of the items of an order until expiresAt, or
+// moves the expiry of the reservations the order already has. It stops at
+// the first product that is out of stock, keeping what it reserved.
+func (s *orderService) reserve(ctx context.Context, order *models.Order, expiresAt time.Time) error {
+	quantities := make(map[primitive.ObjectID]int64)
+	for _, item := range order.Items {
+		quantities[item.ProductID] += int64(item.Quantity)
+	}
+
+	for _, productID := range orderProducts(order) {
+		err := s.productRepo.Reserve(ctx, productID, order.ID, quantities[productID], expiresAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrInsufficientStock):
+				return fmt.Errorf("%w: product %s is out of stock", ErrFailedPrecondition, productID.Hex())
+			case errors.Is(err, ErrNotFound):
+				return fmt.Errorf("%w: product %s is no longer available", ErrFailedPrecondition, productID.Hex())
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseStock gives back the stock reserved for an order. Failures are
+// only logged since the reservations expire anyway.
+func (s *orderService) releaseStock(ctx context.Context, order *models.Order) {
+	for _, productID := range orderProducts(order) {
+		if err := s.productRepo.Release(ctx, productID, order.ID); err != nil {
+			log.Printf("Failed to release stock of product %s for order %s: %v", productID.Hex(), order.ID.Hex(), err)
+		}
+	}
+}
+
+// commitStock takes the stock reserved for a paid order out of stock.
+// Reservations that are gone were committed by an earlier settlement of the
+// order, or expired, which is only logged.
+func (s *orderService) commitStock(ctx context.Context, order *models.Order) error {
+	for _, productID := range orderProducts(order) {
+		err := s.productRepo.Commit(ctx, productID, order.ID)
+		if errors.Is(err, ErrNotFound) {
+			log.Printf("No stock of product %s left reserved to commit for paid order %s", productID.Hex(), order.ID.Hex())
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// paymentRefused reports whether CreatePayment failed without creating a
+// payment. Other errors, such as timeouts, may have been returned after the
+// payment was created.
+func paymentRefused(err error) bool {
+	if st, ok := status.FromError(err); ok {
+		switch st.Code() {
+		case codes.InvalidArgument, codes.OutOfRange, codes.FailedPrecondition, codes.AlreadyExists,
+			codes.Unauthenticated, codes.PermissionDenied:
+			return true
+		}
+		return false
+	}
+	return errors.Is(err, ErrInvalidArgument) || errors.Is(err, ErrFailedPrecondition) ||
+		errors.Is(err, ErrAlreadyExists) || errors.Is(err, ErrUnauthenticated)
+}
+
+// orderIdempotencyKey is the idempotency key of the payment of an order.
+func orderIdempotencyKey(id primitive.ObjectID) string {
+	return "order-" + id.Hex()
+}
+
+// orderProducts returns the distinct products of an order in the order of
+// its items.
+func orderProducts(order *models.Order) []primitive.ObjectID {
+	seen := make(map[primitive.ObjectID]bool)
+	var products []primitive.ObjectID
+	for _, item := range order.Items {
+		if !seen[item.ProductID] {
+			seen[item.ProductID] = true
+			products = append(products, item.ProductID)
+		}
+	}
+	return products
+}
+
+// orderTotal sums the items of an order. All items must be priced in the
+// same currency since an order is paid with a single payment.
+func orderTotal(items []models.OrderItem) (models.Money, error) {
+	var total models.Money
+	for i, item := range items {
+		if i == 0 {
+			total.Currency = item.Price.Currency
+		} else if item.Price.Currency != total.Currency {
+			return models.Money{}, fmt.Errorf("order mixes %s and %s prices", total.Currency, item.Price.Currency)
+		}
+		total = total.Add(item.Price.Mul(int64(item.Quantity)))
+	}
+	return total, nil
+}
+
+func toOrderResponse(order *models.Order) *models.OrderResponse {
+	items := make([]models.OrderItemResponse, 0, len(order.Items))
+	for _, item := range order.Items {
+		items = append(items, models.OrderItemResponse{
+			ProductID: item.ProductID.Hex(),
+			Name:      item.Name,
+			Quantity:  item.Quantity,
+			Price:     item.Price.Decimal(),
+		})
+	}
+
+	return &models.OrderResponse{
+		ID:            order.ID.Hex(),
+		Items:         items,
+		Total:         order.Total.Decimal(),
+		Currency:      order.Total.Currency,
+		Status:        order.Status,
+		PaymentID:     order.PaymentID,
+		OwnerID:       order.OwnerID,
+		ReservedUntil: order.ReservedUntil,
+	}
+}
@@ -0,0 +1,854 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MockOrderRepository is a mock implementation of OrderRepository
+type MockOrderRepository struct {
+	mock.Mock
+}
+
+func (m *MockOrderRepository) Create(ctx context.Context, order *models.Order) error {
+	args := m.Called(ctx, order)
+	if args.Get(0) == nil {
+		if order.ID.IsZero() {
+			order.ID = primitive.NewObjectID()
+		}
+		return nil
+	}
+	return args.Error(0)
+}
+
+func (m *MockOrderRepository) FindAll(ctx context.Context, ownerID string) ([]models.Order, error) {
+	args := m.Called(ctx, ownerID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Order), args.Error(1)
+}
+
+func (m *MockOrderRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Order, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Order), args.Error(1)
+}
+
+func (m *MockOrderRepository) FindByPaymentID(ctx context.Context, paymentID string) (*models.Order, error) {
+	args := m.Called(ctx, paymentID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Order), args.Error(1)
+}
+
+func (m *MockOrderRepository) FindByStatus(ctx context.Context, status models.OrderStatus) ([]models.Order, error) {
+	args := m.Called(ctx, status)
+	return args.Get(0).([]models.Order), args.Error(1)
+}
+
+func (m *MockOrderRepository) UpdateStatus(ctx context.Context, id primitive.ObjectID, from, to models.OrderStatus) (bool, error) {
+	args := m.Called(ctx, id, from, to)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockOrderRepository) Claim(ctx context.Context, id primitive.ObjectID, items []models.OrderItem, total models.Money) (bool, error) {
+	args := m.Called(ctx, id, items, total)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockOrderRepository) AwaitPayment(ctx context.Context, id primitive.ObjectID, paymentID string) (bool, error) {
+	args := m.Called(ctx, id, paymentID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockOrderRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// MockProductRepository is a mock implementation of ProductRepository
+type MockProductRepository struct {
+	mock.Mock
+}
+
+func (m *MockProductRepository) Create(ctx context.Context, product *models.Product) error {
+	args := m.Called(ctx, product)
+	if args.Get(0) == nil {
+		product.ID = primitive.NewObjectID()
+		return nil
+	}
+	return args.Error(0)
+}
+
+func (m *MockProductRepository) Find(ctx context.Context, filter repository.ProductFilter, page repository.PageOptions) ([]models.Product, string, error) {
+	args := m.Called(ctx, filter, page)
+	if args.Get(0) == nil {
+		return nil, "", args.Error(2)
+	}
+	return args.Get(0).([]models.Product), args.String(1), args.Error(2)
+}
+
+func (m *MockProductRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Product, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Product), args.Error(1)
+}
+
+func (m *MockProductRepository) Update(ctx context.Context, id primitive.ObjectID, product *models.Product, version int64) error {
+	args := m.Called(ctx, id, product, version)
+	if args.Get(0) == nil {
+		product.ID = id
+		product.Version = version + 1
+		return nil
+	}
+	return args.Error(0)
+}
+
+func (m *MockProductRepository) Patch(ctx context.Context, id primitive.ObjectID, changes repository.ProductChanges, version int64) (*models.Product, error) {
+	args := m.Called(ctx, id, changes, version)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Product), args.Error(1)
+}
+
+func (m *MockProductRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockProductRepository) Restore(ctx context.Context, id primitive.ObjectID) (*models.Product, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Product), args.Error(1)
+}
+
+func (m *MockProductRepository) Reserve(ctx context.Context, id, reservationID primitive.ObjectID, quantity int64, expiresAt time.Time) error {
+	args := m.Called(ctx, id, reservationID, quantity, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockProductRepository) Release(ctx context.Context, id, reservationID primitive.ObjectID) error {
+	args := m.Called(ctx, id, reservationID)
+	return args.Error(0)
+}
+
+func (m *MockProductRepository) Commit(ctx context.Context, id, reservationID primitive.ObjectID) error {
+	args := m.Called(ctx, id, reservationID)
+	return args.Error(0)
+}
+
+func (m *MockProductRepository) ExpireReservations(ctx context.Context, now time.Time) (int64, error) {
+	args := m.Called(ctx, now)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockProductRepository) AdjustStock(ctx context.Context, adjustment *models.StockAdjustment) (*models.Product, error) {
+	args := m.Called(ctx, adjustment)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Product), args.Error(1)
+}
+
+// MockPaymentService is a mock implementation of PaymentService
+type MockPaymentService struct {
+	mock.Mock
+}
+
+func (m *MockPaymentService) CreatePayment(ctx context.Context, req *models.PaymentRequest) (*models.PaymentResponse, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PaymentResponse), args.Error(1)
+}
+
+func (m *MockPaymentService) GetAllPayments(ctx context.Context, req *models.PaymentListRequest) (*models.PaymentListResponse, error) {
+	args := m.Called(ctx, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PaymentListResponse), args.Error(1)
+}
+
+func (m *MockPaymentService) GetPaymentByID(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PaymentResponse), args.Error(1)
+}
+
+func (m *MockPaymentService) DeletePayment(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockPaymentService) RestorePayment(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PaymentResponse), args.Error(1)
+}
+
+func (m *MockPaymentService) AuthorizePayment(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PaymentResponse), args.Error(1)
+}
+
+func (m *MockPaymentService) CapturePayment(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PaymentResponse), args.Error(1)
+}
+
+func (m *MockPaymentService) RefundPayment(ctx context.Context, id string, req *models.RefundRequest) (*models.PaymentResponse, error) {
+	args := m.Called(ctx, id, req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PaymentResponse), args.Error(1)
+}
+
+func (m *MockPaymentService) GetRefunds(ctx context.Context, id string) ([]models.RefundResponse, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.RefundResponse), args.Error(1)
+}
+
+func (m *MockPaymentService) CancelPayment(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PaymentResponse), args.Error(1)
+}
+
+func (m *MockPaymentService) FailPayment(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PaymentResponse), args.Error(1)
+}
+
+func (m *MockPaymentService) WatchPayments(ctx context.Context, resumeToken string, send func(*models.PaymentEventResponse) error) error {
+	args := m.Called(ctx, resumeToken, send)
+	return args.Error(0)
+}
+
+func TestCreateOrder_SnapshotsPrices(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	productRepo := new(MockProductRepository)
+	service := NewOrderService(orderRepo, productRepo, new(MockPaymentService))
+
+	ctx := customerContext()
+	productID := primitive.NewObjectID()
+	productRepo.On("FindByID", ctx, productID).Return(&models.Product{ID: productID, Name: "Keyboard", Price: usd(2500)}, nil)
+	productRepo.On("Reserve", ctx, productID, mock.Anything, int64(3), mock.Anything).Return(nil)
+	orderRepo.On("Create", ctx, mock.AnythingOfType("*models.Order")).Return(nil)
+
+	result, err := service.CreateOrder(ctx, &models.OrderRequest{
+		Items: []models.OrderItemRequest{{ProductID: productID.Hex(), Quantity: 3}},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.OrderStatusPending, result.Status)
+	assert.NotNil(t, result.ReservedUntil)
+	assert.Equal(t, models.Decimal("75.00"), result.Total)
+	assert.Equal(t, "Keyboard", result.Items[0].Name)
+	assert.Equal(t, models.Decimal("25.00"), result.Items[0].Price)
+	orderRepo.AssertExpectations(t)
+	productRepo.AssertExpectations(t)
+}
+
+func TestCreateOrder_ReservesStockForTheOrder(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	productRepo := new(MockProductRepository)
+	service := NewOrderService(orderRepo, productRepo, new(MockPaymentService))
+
+	ctx := customerContext()
+	productID := primitive.NewObjectID()
+	productRepo.On("FindByID", ctx, productID).Return(&models.Product{ID: productID, Price: usd(2500)}, nil)
+	// Items of the same product are reserved together, for the order
+	var reservationID primitive.ObjectID
+	forReservation := mock.MatchedBy(func(id primitive.ObjectID) bool {
+		reservationID = id
+		return true
+	})
+	productRepo.On("Reserve", ctx, productID, forReservation, int64(5), mock.Anything).Return(nil)
+	orderRepo.On("Create", ctx, mock.AnythingOfType("*models.Order")).Return(nil)
+
+	result, err := service.CreateOrder(ctx, &models.OrderRequest{
+		Items: []models.OrderItemRequest{
+			{ProductID: productID.Hex(), Quantity: 2},
+			{ProductID: productID.Hex(), Quantity: 3},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, reservationID.Hex(), result.ID)
+	productRepo.AssertNumberOfCalls(t, "Reserve", 1)
+}
+
+func TestCreateOrder_OutOfStock(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	productRepo := new(MockProductRepository)
+	service := NewOrderService(orderRepo, productRepo, new(MockPaymentService))
+
+	ctx := customerContext()
+	keyboard := primitive.NewObjectID()
+	mouse := primitive.NewObjectID()
+	productRepo.On("FindByID", ctx, keyboard).Return(&models.Product{ID: keyboard, Price: usd(2500)}, nil)
+	productRepo.On("FindByID", ctx, mouse).Return(&models.Product{ID: mouse, Price: usd(1500)}, nil)
+	productRepo.On("Reserve", ctx, keyboard, mock.Anything, int64(1), mock.Anything).Return(nil)
+	productRepo.On("Reserve", ctx, mouse, mock.Anything, int64(1), mock.Anything).Return(fmt.Errorf("product %w", repository.ErrInsufficientStock))
+	productRepo.On("Release", ctx, mock.Anything, mock.Anything).Return(nil)
+
+	result, err := service.CreateOrder(ctx, &models.OrderRequest{
+		Items: []models.OrderItemRequest{
+			{ProductID: keyboard.Hex(), Quantity: 1},
+			{ProductID: mouse.Hex(), Quantity: 1},
+		},
+	})
+
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, ErrFailedPrecondition)
+	// The keyboard reserved before the mouse ran out is given back
+	productRepo.AssertCalled(t, "Release", ctx, keyboard, mock.Anything)
+	orderRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestCreateOrder_MixedCurrencies(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	productRepo := new(MockProductRepository)
+	service := NewOrderService(orderRepo, productRepo, new(MockPaymentService))
+
+	ctx := customerContext()
+	keyboard := primitive.NewObjectID()
+	mouse := primitive.NewObjectID()
+	productRepo.On("FindByID", ctx, keyboard).Return(&models.Product{ID: keyboard, Price: usd(2500)}, nil)
+	productRepo.On("FindByID", ctx, mouse).Return(&models.Product{ID: mouse, Price: models.Money{Units: 1500, Currency: "EUR"}}, nil)
+
+	result, err := service.CreateOrder(ctx, &models.OrderRequest{
+		Items: []models.OrderItemRequest{
+			{ProductID: keyboard.Hex(), Quantity: 1},
+			{ProductID: mouse.Hex(), Quantity: 1},
+		},
+	})
+
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+	orderRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestCreateOrder_UnknownProduct(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	productRepo := new(MockProductRepository)
+	service := NewOrderService(orderRepo, productRepo, new(MockPaymentService))
+
+	ctx := customerContext()
+	productID := primitive.NewObjectID()
+	productRepo.On("FindByID", ctx, productID).Return(nil, fmt.Errorf("product %w", ErrNotFound))
+
+	result, err := service.CreateOrder(ctx, &models.OrderRequest{
+		Items: []models.OrderItemRequest{{ProductID: productID.Hex(), Quantity: 1}},
+	})
+
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+	orderRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestCreateOrder_RecordsOwner(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	productRepo := new(MockProductRepository)
+	service := NewOrderService(orderRepo, productRepo, new(MockPaymentService))
+
+	ctx := customerContext()
+	productID := primitive.NewObjectID()
+	productRepo.On("FindByID", ctx, productID).Return(&models.Product{ID: productID, Price: usd(2500)}, nil)
+	productRepo.On("Reserve", ctx, productID, mock.Anything, int64(1), mock.Anything).Return(nil)
+	orderRepo.On("Create", ctx, mock.MatchedBy(func(order *models.Order) bool {
+		return order.OwnerID == "user-1"
+	})).Return(nil)
+
+	result, err := service.CreateOrder(ctx, &models.OrderRequest{
+		Items: []models.OrderItemRequest{{ProductID: productID.Hex(), Quantity: 1}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", result.OwnerID)
+
+	result, err = service.CreateOrder(context.Background(), &models.OrderRequest{
+		Items: []models.OrderItemRequest{{ProductID: productID.Hex(), Quantity: 1}},
+	})
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	orderRepo.AssertNumberOfCalls(t, "Create", 1)
+}
+
+func TestGetAllOrders_ScopedToCaller(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	service := NewOrderService(orderRepo, new(MockProductRepository), new(MockPaymentService))
+
+	// Customers only see their own orders, admins see every order
+	orderRepo.On("FindAll", mock.Anything, "user-1").Return([]models.Order{{ID: primitive.NewObjectID(), OwnerID: "user-1"}}, nil)
+	orderRepo.On("FindAll", mock.Anything, "").Return([]models.Order{{ID: primitive.NewObjectID(), OwnerID: "user-1"}, {ID: primitive.NewObjectID(), OwnerID: "user-2"}}, nil)
+
+	orders, err := service.GetAllOrders(customerContext())
+	assert.NoError(t, err)
+	assert.Len(t, orders, 1)
+
+	orders, err = service.GetAllOrders(adminContext())
+	assert.NoError(t, err)
+	assert.Len(t, orders, 2)
+	orderRepo.AssertExpectations(t)
+}
+
+func TestOrders_OtherUsersOrderNotFound(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	paymentService := new(MockPaymentService)
+	service := NewOrderService(orderRepo, new(MockProductRepository), paymentService)
+
+	orderID := primitive.NewObjectID()
+	order := &models.Order{ID: orderID, Status: models.OrderStatusPending, OwnerID: "user-2"}
+	orderRepo.On("FindByID", mock.Anything, orderID).Return(order, nil)
+
+	_, err := service.GetOrderByID(customerContext(), orderID.Hex())
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	err = service.DeleteOrder(customerContext(), orderID.Hex())
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = service.Checkout(customerContext(), orderID.Hex())
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Admins can read any order
+	result, err := service.GetOrderByID(adminContext(), orderID.Hex())
+	assert.NoError(t, err)
+	assert.Equal(t, "user-2", result.OwnerID)
+
+	orderRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	orderRepo.AssertNotCalled(t, "UpdateStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	paymentService.AssertNotCalled(t, "CreatePayment", mock.Anything, mock.Anything)
+}
+
+func TestCheckout_UsesCurrentPrices(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	productRepo := new(MockProductRepository)
+	paymentService := new(MockPaymentService)
+	service := NewOrderService(orderRepo, productRepo, paymentService)
+
+	ctx := customerContext()
+	orderID := primitive.NewObjectID()
+	productID := primitive.NewObjectID()
+	order := &models.Order{
+		ID:      orderID,
+		Items:   []models.OrderItem{{ProductID: productID, Name: "Keyboard", Quantity: 2, Price: usd(2500)}},
+		Total:   usd(5000),
+		Status:  models.OrderStatusPending,
+		OwnerID: "user-1",
+	}
+	repriced := []models.OrderItem{{ProductID: productID, Name: "Keyboard", Quantity: 2, Price: usd(3000)}}
+
+	orderRepo.On("FindByID", ctx, orderID).Return(order, nil)
+	orderRepo.On("Claim", ctx, orderID, repriced, usd(6000)).Return(true, nil)
+	productRepo.On("FindByID", ctx, productID).Return(&models.Product{ID: productID, Name: "Keyboard", Price: usd(3000)}, nil)
+	productRepo.On("Reserve", ctx, productID, orderID, int64(2), mock.Anything).Return(nil)
+	paymentService.On("CreatePayment", ctx, &models.PaymentRequest{Amount: "60.00", Currency: "USD", IdempotencyKey: "order-" + orderID.Hex()}).Return(&models.PaymentResponse{ID: "pay-1", Amount: "60.00", Currency: "USD", Status: models.PaymentStatusPending}, nil)
+	orderRepo.On("AwaitPayment", ctx, orderID, "pay-1").Return(true, nil)
+
+	result, err := service.Checkout(ctx, orderID.Hex())
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.OrderStatusAwaitingPayment, result.Status)
+	assert.Equal(t, models.Decimal("60.00"), result.Total)
+	assert.Equal(t, "pay-1", result.PaymentID)
+	assert.Nil(t, result.ReservedUntil)
+	orderRepo.AssertExpectations(t)
+	productRepo.AssertExpectations(t)
+	paymentService.AssertExpectations(t)
+	// The stock is only committed once the payment is captured
+	productRepo.AssertNumberOfCalls(t, "Reserve", 2)
+	productRepo.AssertNotCalled(t, "Commit", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCheckout_OutOfStockAfterReservationExpired(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	productRepo := new(MockProductRepository)
+	paymentService := new(MockPaymentService)
+	service := NewOrderService(orderRepo, productRepo, paymentService)
+
+	ctx := customerContext()
+	orderID := primitive.NewObjectID()
+	productID := primitive.NewObjectID()
+	order := &models.Order{
+		ID:      orderID,
+		Items:   []models.OrderItem{{ProductID: productID, Quantity: 1, Price: usd(1000)}},
+		Status:  models.OrderStatusPending,
+		OwnerID: "user-1",
+	}
+
+	orderRepo.On("FindByID", ctx, orderID).Return(order, nil)
+	orderRepo.On("Claim", ctx, orderID, mock.Anything, usd(1000)).Return(true, nil)
+	productRepo.On("FindByID", ctx, productID).Return(&models.Product{ID: productID, Price: usd(1000)}, nil)
+	productRepo.On("Reserve", ctx, productID, orderID, int64(1), mock.Anything).Return(fmt.Errorf("product %w", repository.ErrInsufficientStock))
+	orderRepo.On("UpdateStatus", ctx, orderID, models.OrderStatusProcessing, models.OrderStatusPending).Return(true, nil)
+
+	result, err := service.Checkout(ctx, orderID.Hex())
+
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, ErrFailedPrecondition)
+	orderRepo.AssertExpectations(t)
+	paymentService.AssertNotCalled(t, "CreatePayment", mock.Anything, mock.Anything)
+}
+
+func TestCheckout_AlreadyPaid(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	paymentService := new(MockPaymentService)
+	service := NewOrderService(orderRepo, new(MockProductRepository), paymentService)
+
+	ctx := customerContext()
+	orderID := primitive.NewObjectID()
+	orderRepo.On("FindByID", ctx, orderID).Return(&models.Order{ID: orderID, Status: models.OrderStatusPaid, OwnerID: "user-1"}, nil)
+
+	result, err := service.Checkout(ctx, orderID.Hex())
+
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, ErrFailedPrecondition)
+	orderRepo.AssertNotCalled(t, "Claim", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	paymentService.AssertNotCalled(t, "CreatePayment", mock.Anything, mock.Anything)
+}
+
+func TestCheckout_AdminCannotCheckOutOtherUsersOrder(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	paymentService := new(MockPaymentService)
+	service := NewOrderService(orderRepo, new(MockProductRepository), paymentService)
+
+	ctx := adminContext()
+	orderID := primitive.NewObjectID()
+	orderRepo.On("FindByID", ctx, orderID).Return(&models.Order{ID: orderID, Status: models.OrderStatusPending, OwnerID: "user-1"}, nil)
+
+	result, err := service.Checkout(ctx, orderID.Hex())
+
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, ErrFailedPrecondition)
+	orderRepo.AssertNotCalled(t, "Claim", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	paymentService.AssertNotCalled(t, "CreatePayment", mock.Anything, mock.Anything)
+}
+
+func TestCheckout_ReleasesOrderWhenPaymentRefused(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	productRepo := new(MockProductRepository)
+	paymentService := new(MockPaymentService)
+	service := NewOrderService(orderRepo, productRepo, paymentService)
+
+	ctx := customerContext()
+	orderID := primitive.NewObjectID()
+	productID := primitive.NewObjectID()
+	order := &models.Order{
+		ID:      orderID,
+		Items:   []models.OrderItem{{ProductID: productID, Quantity: 1, Price: usd(1000)}},
+		Status:  models.OrderStatusPending,
+		OwnerID: "user-1",
+	}
+
+	orderRepo.On("FindByID", ctx, orderID).Return(order, nil)
+	orderRepo.On("Claim", ctx, orderID, mock.Anything, usd(1000)).Return(true, nil)
+	productRepo.On("FindByID", ctx, productID).Return(&models.Product{ID: productID, Price: usd(1000)}, nil)
+	productRepo.On("Reserve", ctx, productID, orderID, int64(1), mock.Anything).Return(nil)
+	paymentService.On("CreatePayment", ctx, mock.Anything).Return(nil, status.Error(codes.InvalidArgument, "unsupported currency")).Once()
+	orderRepo.On("UpdateStatus", ctx, orderID, models.OrderStatusProcessing, models.OrderStatusPending).Return(true, nil)
+
+	result, err := service.Checkout(ctx, orderID.Hex())
+
+	assert.Nil(t, result)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	orderRepo.AssertExpectations(t)
+	orderRepo.AssertNotCalled(t, "AwaitPayment", mock.Anything, mock.Anything, mock.Anything)
+
+	// Errors that may hide a created payment keep the order claimed
+	order.Status = models.OrderStatusPending
+	paymentService.On("CreatePayment", ctx, mock.Anything).Return(nil, errors.New("payment service unavailable")).Once()
+
+	_, err = service.Checkout(ctx, orderID.Hex())
+
+	assert.Error(t, err)
+	assert.Equal(t, models.OrderStatusProcessing, order.Status)
+	orderRepo.AssertNumberOfCalls(t, "UpdateStatus", 1)
+}
+
+// timeoutAfterCreate is a PaymentService whose first CreatePayment creates
+// the payment but reports a timeout, as a dropped connection would.
+type timeoutAfterCreate struct {
+	PaymentService
+	timedOut bool
+}
+
+func (s *timeoutAfterCreate) CreatePayment(ctx context.Context, req *models.PaymentRequest) (*models.PaymentResponse, error) {
+	payment, err := s.PaymentService.CreatePayment(ctx, req)
+	if err == nil && !s.timedOut {
+		s.timedOut = true
+		return nil, status.Error(codes.DeadlineExceeded, "context deadline exceeded")
+	}
+	return payment, err
+}
+
+func TestCheckout_RetryAfterTimeoutReplaysPayment(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	productRepo := new(MockProductRepository)
+	paymentRepo := new(MockPaymentRepository)
+	service := NewOrderService(orderRepo, productRepo, &timeoutAfterCreate{PaymentService: NewPaymentService(paymentRepo, new(MockRefundRepository), nil)})
+
+	ctx := customerContext()
+	orderID := primitive.NewObjectID()
+	productID := primitive.NewObjectID()
+	order := &models.Order{
+		ID:      orderID,
+		Items:   []models.OrderItem{{ProductID: productID, Quantity: 1, Price: usd(1000)}},
+		Status:  models.OrderStatusPending,
+		OwnerID: "user-1",
+	}
+	key := "order-" + orderID.Hex()
+
+	orderRepo.On("FindByID", ctx, orderID).Return(order, nil)
+	orderRepo.On("Claim", ctx, orderID, mock.Anything, usd(1000)).Return(true, nil)
+	productRepo.On("FindByID", ctx, productID).Return(&models.Product{ID: productID, Price: usd(1000)}, nil)
+	productRepo.On("Reserve", ctx, productID, orderID, int64(1), mock.Anything).Return(nil)
+	paymentRepo.On("FindByIdempotencyKey", ctx, "user-1", key).Return(nil, fmt.Errorf("payment %w", ErrNotFound)).Once()
+	var created *models.Payment
+	paymentRepo.On("Create", ctx, mock.MatchedBy(func(payment *models.Payment) bool {
+		created = payment
+		return payment.IdempotencyKey == key
+	})).Return(nil)
+
+	result, err := service.Checkout(ctx, orderID.Hex())
+	assert.Nil(t, result)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	// The order stays claimed, and the retry finds the payment the first
+	// attempt created
+	assert.Equal(t, models.OrderStatusProcessing, order.Status)
+	paymentRepo.On("FindByIdempotencyKey", ctx, "user-1", key).Return(created, nil)
+	orderRepo.On("AwaitPayment", ctx, orderID, created.ID.Hex()).Return(true, nil)
+
+	result, err = service.Checkout(ctx, orderID.Hex())
+	assert.NoError(t, err)
+	assert.Equal(t, created.ID.Hex(), result.PaymentID)
+	paymentRepo.AssertNumberOfCalls(t, "Create", 1)
+	orderRepo.AssertNumberOfCalls(t, "Claim", 1)
+	orderRepo.AssertNotCalled(t, "UpdateStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCheckout_ResumesOrderLeftInProcessing(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	productRepo := new(MockProductRepository)
+	paymentService := new(MockPaymentService)
+	service := NewOrderService(orderRepo, productRepo, paymentService)
+
+	ctx := customerContext()
+	orderID := primitive.NewObjectID()
+	productID := primitive.NewObjectID()
+	order := &models.Order{
+		ID:      orderID,
+		Items:   []models.OrderItem{{ProductID: productID, Quantity: 1, Price: usd(1000)}},
+		Total:   usd(1000),
+		Status:  models.OrderStatusPending,
+		OwnerID: "user-1",
+	}
+	payment := &models.PaymentResponse{ID: "pay-1", Amount: "10.00", Currency: "USD"}
+	request := &models.PaymentRequest{Amount: "10.00", Currency: "USD", IdempotencyKey: "order-" + orderID.Hex()}
+
+	orderRepo.On("FindByID", ctx, orderID).Return(order, nil)
+	orderRepo.On("Claim", ctx, orderID, mock.Anything, usd(1000)).Return(true, nil)
+	productRepo.On("FindByID", ctx, productID).Return(&models.Product{ID: productID, Price: usd(1000)}, nil).Once()
+	productRepo.On("Reserve", ctx, productID, orderID, int64(1), mock.Anything).Return(nil)
+	paymentService.On("CreatePayment", ctx, request).Return(payment, nil)
+	orderRepo.On("AwaitPayment", ctx, orderID, "pay-1").Return(false, errors.New("connection reset")).Once()
+
+	result, err := service.Checkout(ctx, orderID.Hex())
+	assert.Nil(t, result)
+	assert.Error(t, err)
+	assert.Equal(t, models.OrderStatusProcessing, order.Status)
+
+	// Checking out again pays at the claimed price, replaying the payment
+	orderRepo.On("AwaitPayment", ctx, orderID, "pay-1").Return(true, nil)
+
+	result, err = service.Checkout(ctx, orderID.Hex())
+	assert.NoError(t, err)
+	assert.Equal(t, models.OrderStatusAwaitingPayment, result.Status)
+	assert.Equal(t, "pay-1", result.PaymentID)
+	orderRepo.AssertNumberOfCalls(t, "Claim", 1)
+	paymentService.AssertNumberOfCalls(t, "CreatePayment", 2)
+	productRepo.AssertNumberOfCalls(t, "FindByID", 1)
+}
+
+func TestCheckout_ReplayedCapturedPaymentSettlesOrder(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	productRepo := new(MockProductRepository)
+	paymentService := new(MockPaymentService)
+	service := NewOrderService(orderRepo, productRepo, paymentService)
+
+	ctx := customerContext()
+	orderID := primitive.NewObjectID()
+	productID := primitive.NewObjectID()
+	order := &models.Order{
+		ID:      orderID,
+		Items:   []models.OrderItem{{ProductID: productID, Quantity: 1, Price: usd(1000)}},
+		Total:   usd(1000),
+		Status:  models.OrderStatusProcessing,
+		OwnerID: "user-1",
+	}
+
+	orderRepo.On("FindByID", ctx, orderID).Return(order, nil)
+	productRepo.On("Reserve", ctx, productID, orderID, int64(1), mock.Anything).Return(nil)
+	paymentService.On("CreatePayment", ctx, mock.Anything).Return(&models.PaymentResponse{ID: "pay-1", Status: models.PaymentStatusCaptured}, nil)
+	orderRepo.On("AwaitPayment", ctx, orderID, "pay-1").Return(true, nil)
+	productRepo.On("Commit", ctx, productID, orderID).Return(nil)
+	orderRepo.On("UpdateStatus", ctx, orderID, models.OrderStatusAwaitingPayment, models.OrderStatusPaid).Return(true, nil)
+
+	result, err := service.Checkout(ctx, orderID.Hex())
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.OrderStatusPaid, result.Status)
+	productRepo.AssertExpectations(t)
+	orderRepo.AssertExpectations(t)
+}
+
+func TestSettlePayment_CapturedPaymentCommitsStock(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	productRepo := new(MockProductRepository)
+	service := NewOrderService(orderRepo, productRepo, new(MockPaymentService))
+
+	ctx := context.Background()
+	orderID := primitive.NewObjectID()
+	keyboard := primitive.NewObjectID()
+	mouse := primitive.NewObjectID()
+	order := &models.Order{
+		ID:        orderID,
+		Items:     []models.OrderItem{{ProductID: keyboard, Quantity: 1}, {ProductID: mouse, Quantity: 2}},
+		Status:    models.OrderStatusAwaitingPayment,
+		PaymentID: "pay-1",
+	}
+
+	orderRepo.On("FindByPaymentID", ctx, "pay-1").Return(order, nil)
+	// A reservation committed by an earlier settlement is not an error
+	productRepo.On("Commit", ctx, keyboard, orderID).Return(fmt.Errorf("reservation %w", repository.ErrNotFound))
+	productRepo.On("Commit", ctx, mouse, orderID).Return(nil)
+	orderRepo.On("UpdateStatus", ctx, orderID, models.OrderStatusAwaitingPayment, models.OrderStatusPaid).Return(true, nil)
+
+	err := service.SettlePayment(ctx, &models.PaymentResponse{ID: "pay-1", Status: models.PaymentStatusCaptured})
+
+	assert.NoError(t, err)
+	productRepo.AssertExpectations(t)
+	orderRepo.AssertExpectations(t)
+	productRepo.AssertNotCalled(t, "Release", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSettlePayment_FailedPaymentReleasesStock(t *testing.T) {
+	for _, paymentStatus := range []models.PaymentStatus{models.PaymentStatusFailed, models.PaymentStatusCancelled} {
+		t.Run(string(paymentStatus), func(t *testing.T) {
+			orderRepo := new(MockOrderRepository)
+			productRepo := new(MockProductRepository)
+			service := NewOrderService(orderRepo, productRepo, new(MockPaymentService))
+
+			ctx := context.Background()
+			orderID := primitive.NewObjectID()
+			productID := primitive.NewObjectID()
+			order := &models.Order{
+				ID:        orderID,
+				Items:     []models.OrderItem{{ProductID: productID, Quantity: 3}},
+				Status:    models.OrderStatusAwaitingPayment,
+				PaymentID: "pay-1",
+			}
+
+			orderRepo.On("FindByPaymentID", ctx, "pay-1").Return(order, nil)
+			productRepo.On("Release", ctx, productID, orderID).Return(nil)
+			orderRepo.On("UpdateStatus", ctx, orderID, models.OrderStatusAwaitingPayment, models.OrderStatusCancelled).Return(true, nil)
+
+			err := service.SettlePayment(ctx, &models.PaymentResponse{ID: "pay-1", Status: paymentStatus})
+
+			assert.NoError(t, err)
+			productRepo.AssertExpectations(t)
+			orderRepo.AssertExpectations(t)
+			productRepo.AssertNotCalled(t, "Commit", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestSettlePayment_IgnoresPendingAndUnknownPayments(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	productRepo := new(MockProductRepository)
+	service := NewOrderService(orderRepo, productRepo, new(MockPaymentService))
+
+	ctx := context.Background()
+	order := &models.Order{ID: primitive.NewObjectID(), Status: models.OrderStatusAwaitingPayment, PaymentID: "pay-1"}
+	orderRepo.On("FindByPaymentID", ctx, "pay-1").Return(order, nil)
+	orderRepo.On("FindByPaymentID", ctx, "pay-2").Return(nil, fmt.Errorf("order %w", repository.ErrNotFound))
+
+	assert.NoError(t, service.SettlePayment(ctx, &models.PaymentResponse{ID: "pay-1", Status: models.PaymentStatusAuthorized}))
+	assert.NoError(t, service.SettlePayment(ctx, &models.PaymentResponse{ID: "pay-2", Status: models.PaymentStatusCaptured}))
+	assert.Equal(t, models.OrderStatusAwaitingPayment, order.Status)
+	orderRepo.AssertNotCalled(t, "UpdateStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSettleOrders_SettlesMissedPaymentsAndKeepsOthersReserved(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	productRepo := new(MockProductRepository)
+	paymentService := new(MockPaymentService)
+	service := NewOrderService(orderRepo, productRepo, paymentService)
+
+	ctx := adminContext()
+	failedID := primitive.NewObjectID()
+	pendingID := primitive.NewObjectID()
+	productID := primitive.NewObjectID()
+	orders := []models.Order{
+		{ID: failedID, Items: []models.OrderItem{{ProductID: productID, Quantity: 1}}, Status: models.OrderStatusAwaitingPayment, PaymentID: "pay-failed"},
+		{ID: pendingID, Items: []models.OrderItem{{ProductID: productID, Quantity: 2}}, Status: models.OrderStatusAwaitingPayment, PaymentID: "pay-pending"},
+	}
+
+	orderRepo.On("FindByStatus", ctx, models.OrderStatusAwaitingPayment).Return(orders, nil)
+	paymentService.On("GetPaymentByID", ctx, "pay-failed").Return(&models.PaymentResponse{ID: "pay-failed", Status: models.PaymentStatusFailed}, nil)
+	paymentService.On("GetPaymentByID", ctx, "pay-pending").Return(&models.PaymentResponse{ID: "pay-pending", Status: models.PaymentStatusPending}, nil)
+	productRepo.On("Release", ctx, productID, failedID).Return(nil)
+	orderRepo.On("UpdateStatus", ctx, failedID, models.OrderStatusAwaitingPayment, models.OrderStatusCancelled).Return(true, nil)
+	productRepo.On("Reserve", ctx, productID, pendingID, int64(2), mock.MatchedBy(func(expiresAt time.Time) bool {
+		return expiresAt.After(time.Now().Add(paymentReservationTTL - time.Minute))
+	})).Return(nil)
+
+	settled, awaiting, err := service.SettleOrders(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), settled)
+	assert.Equal(t, int64(1), awaiting)
+	productRepo.AssertExpectations(t)
+	orderRepo.AssertExpectations(t)
+}
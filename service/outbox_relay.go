@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/repository"
+	"time"
+)
+
+// Outbox relay settings. The lease bounds how soon an entry is retried
+// after its relay died.
+const (
+	outboxRelayInterval = time.Second
+	outboxLease         = time.Minute
+)
+
+// OutboxRelay publishes the payment changes recorded in the outbox.
+type OutboxRelay interface {
+	// Relay publishes every unprocessed outbox entry to each publisher, in
+	// the order the entries were written.
+	Relay(ctx context.Context) error
+	// Start relays every second until ctx is done.
+	Start(ctx context.Context)
+}
+
+type outboxRelay struct {
+	outbox     repository.OutboxRepository
+	publishers []EventPublisher
+}
+
+// NewOutboxRelay creates an OutboxRelay. Only the oldest unprocessed entry
+// can be claimed, and every publisher is recorded once it has an entry, so
+// each entry reaches each publisher once and in order even with several
+// relays running. Only a crash between publishing and recording it
+// republishes an entry, which consumers recognize by its event ID.
+func NewOutboxRelay(outbox repository.OutboxRepository, publishers ...EventPublisher) OutboxRelay {
+	return &outboxRelay{
+		outbox:     outbox,
+		publishers: publishers,
+	}
+}
+
+func (r *outboxRelay) Start(ctx context.Context) {
+	ticker := time.NewTicker(outboxRelayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Relay(ctx); err != nil {
+				log.Printf("Error relaying outbox: %v", err)
+			}
+		}
+	}
+}
+
+func (r *outboxRelay) Relay(ctx context.Context) error {
+	for {
+		entry, err := r.outbox.ClaimNext(ctx, outboxLease)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := r.publish(ctx, entry); err != nil {
+			// The entry is unlocked so the next relay retries it before
+			// any later entry
+			if unlockErr := r.outbox.Unlock(ctx, entry.ID); unlockErr != nil {
+				log.Printf("Failed to unlock outbox entry %s: %v", entry.ID.Hex(), unlockErr)
+			}
+			return err
+		}
+	}
+}
+
+// publish publishes a claimed entry to the publishers that do not have it
+// yet and marks it processed.
+func (r *outboxRelay) publish(ctx context.Context, entry *models.OutboxEntry) error {
+	for _, publisher := range r.publishers {
+		if entry.Published(publisher.Name()) {
+			continue
+		}
+		if err := publisher.Publish(ctx, entry); err != nil {
+			return fmt.Errorf("failed to publish outbox entry %s to %s: %w", entry.ID.Hex(), publisher.Name(), err)
+		}
+		if err := r.outbox.MarkPublished(ctx, entry.ID, publisher.Name()); err != nil {
+			return err
+		}
+	}
+
+	return r.outbox.MarkProcessed(ctx, entry.ID)
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Mock repository
+type MockOutboxRepository struct {
+	mock.Mock
+}
+
+func (m *MockOutboxRepository) Add(ctx context.Context, entry *models.OutboxEntry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+func (m *MockOutboxRepository) ClaimNext(ctx context.Context, lease time.Duration) (*models.OutboxEntry, error) {
+	args := m.Called(ctx, lease)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.OutboxEntry), args.Error(1)
+}
+
+func (m *MockOutboxRepository) Unlock(ctx context.Context, id primitive.ObjectID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockOutboxRepository) MarkPublished(ctx context.Context, id primitive.ObjectID, publisher string) error {
+	args := m.Called(ctx, id, publisher)
+	return args.Error(0)
+}
+
+func (m *MockOutboxRepository) MarkProcessed(ctx context.Context, id primitive.ObjectID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// failingPublisher fails every publish.
+type failingPublisher struct{}
+
+func (failingPublisher) Name() string {
+	return "failing"
+}
+
+func (failingPublisher) Publish(ctx context.Context, entry *models.OutboxEntry) error {
+	return errors.New("broker unavailable")
+}
+
+// flakyPublisher fails the first fails publishes and then publishes to
+// its EventPublisher.
+type flakyPublisher struct {
+	EventPublisher
+	fails int
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, entry *models.OutboxEntry) error {
+	if p.fails > 0 {
+		p.fails--
+		return errors.New("broker unavailable")
+	}
+	return p.EventPublisher.Publish(ctx, entry)
+}
+
+func newOutboxEntry() *models.OutboxEntry {
+	payment := &models.Payment{ID: primitive.NewObjectID(), Amount: usd(1050), Status: models.PaymentStatusCaptured}
+	return &models.OutboxEntry{ID: primitive.NewObjectID(), Type: models.PaymentEventUpdated, PaymentID: payment.ID, Payment: payment, CreatedAt: time.Now()}
+}
+
+func TestRelay_PublishesEachEntryOncePerPublisher(t *testing.T) {
+	mockOutbox := new(MockOutboxRepository)
+	memory := NewMemoryPublisher()
+	var stdout strings.Builder
+	relay := NewOutboxRelay(mockOutbox, memory, NewStdoutPublisher(&stdout))
+
+	first, second := newOutboxEntry(), newOutboxEntry()
+	// The second entry already reached memory before its relay died
+	second.PublishedTo = []string{"memory"}
+
+	mockOutbox.On("ClaimNext", mock.Anything, mock.Anything).Return(first, nil).Once()
+	mockOutbox.On("ClaimNext", mock.Anything, mock.Anything).Return(second, nil).Once()
+	mockOutbox.On("ClaimNext", mock.Anything, mock.Anything).Return(nil, errNothingToDo)
+	mockOutbox.On("MarkPublished", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	mockOutbox.On("MarkProcessed", mock.Anything, mock.Anything).Return(nil)
+
+	err := relay.Relay(context.Background())
+
+	assert.NoError(t, err)
+	events := memory.Events()
+	assert.Len(t, events, 1)
+	assert.Equal(t, first.ID.Hex(), events[0].ID)
+	assert.Equal(t, models.WebhookEventPaymentUpdated, events[0].Type)
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	assert.Len(t, lines, 2)
+	var message models.PaymentEventMessage
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &message))
+	assert.Equal(t, second.ID.Hex(), message.ID)
+
+	mockOutbox.AssertCalled(t, "MarkPublished", mock.Anything, first.ID, "memory")
+	mockOutbox.AssertCalled(t, "MarkPublished", mock.Anything, first.ID, "stdout")
+	mockOutbox.AssertNotCalled(t, "MarkPublished", mock.Anything, second.ID, "memory")
+	mockOutbox.AssertCalled(t, "MarkProcessed", mock.Anything, first.ID)
+	mockOutbox.AssertCalled(t, "MarkProcessed", mock.Anything, second.ID)
+}
+
+func TestRelay_FailedPublishLeavesEntryUnprocessed(t *testing.T) {
+	mockOutbox := new(MockOutboxRepository)
+	memory := NewMemoryPublisher()
+	relay := NewOutboxRelay(mockOutbox, memory, failingPublisher{})
+
+	entry := newOutboxEntry()
+	mockOutbox.On("ClaimNext", mock.Anything, mock.Anything).Return(entry, nil).Once()
+	mockOutbox.On("MarkPublished", mock.Anything, entry.ID, "memory").Return(nil)
+	mockOutbox.On("Unlock", mock.Anything, entry.ID).Return(nil)
+
+	err := relay.Relay(context.Background())
+
+	assert.ErrorContains(t, err, "broker unavailable")
+	assert.Len(t, memory.Events(), 1)
+	mockOutbox.AssertNotCalled(t, "MarkPublished", mock.Anything, entry.ID, "failing")
+	mockOutbox.AssertNotCalled(t, "MarkProcessed", mock.Anything, mock.Anything)
+	mockOutbox.AssertCalled(t, "Unlock", mock.Anything, entry.ID)
+}
+
+func TestRelay_RetriesFailedEntryBeforeLaterOnes(t *testing.T) {
+	mockOutbox := new(MockOutboxRepository)
+	memory := NewMemoryPublisher()
+	relay := NewOutboxRelay(mockOutbox, &flakyPublisher{EventPublisher: memory, fails: 1})
+
+	first, second := newOutboxEntry(), newOutboxEntry()
+	// The failed entry is unlocked, so it is claimed again before the
+	// second one
+	mockOutbox.On("ClaimNext", mock.Anything, mock.Anything).Return(first, nil).Twice()
+	mockOutbox.On("ClaimNext", mock.Anything, mock.Anything).Return(second, nil).Once()
+	mockOutbox.On("ClaimNext", mock.Anything, mock.Anything).Return(nil, errNothingToDo)
+	mockOutbox.On("Unlock", mock.Anything, first.ID).Return(nil)
+	mockOutbox.On("MarkPublished", mock.Anything, mock.Anything, "memory").Return(nil)
+	mockOutbox.On("MarkProcessed", mock.Anything, mock.Anything).Return(nil)
+
+	err := relay.Relay(context.Background())
+	assert.ErrorContains(t, err, "broker unavailable")
+	assert.Empty(t, memory.Events())
+	mockOutbox.AssertNumberOfCalls(t, "ClaimNext", 1)
+
+	err = relay.Relay(context.Background())
+	assert.NoError(t, err)
+	events := memory.Events()
+	assert.Len(t, events, 2)
+	assert.Equal(t, first.ID.Hex(), events[0].ID)
+	assert.Equal(t, second.ID.Hex(), events[1].ID)
+	mockOutbox.AssertNumberOfCalls(t, "Unlock", 1)
+}
+
+func TestMemoryPublisher_DropsDuplicates(t *testing.T) {
+	memory := NewMemoryPublisher()
+	entry := newOutboxEntry()
+
+	assert.NoError(t, memory.Publish(context.Background(), entry))
+	assert.NoError(t, memory.Publish(context.Background(), entry))
+
+	assert.Len(t, memory.Events(), 1)
+}
+
+// fakeNATSServer accepts one connection, answers PINGs and reports every
+// HPUB it receives as its subject, headers and payload. It answers each
+// publish with ack, a JetStream publish acknowledgement, unless ack is
+// empty.
+func fakeNATSServer(t *testing.T, ack string) (string, <-chan [3]string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	published := make(chan [3]string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		fmt.Fprint(conn, "INFO {\"headers\":true,\"max_payload\":1048576,\"proto\":1}\r\n")
+
+		subscriptions := make(map[string]string)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			switch {
+			case len(fields) == 0:
+			case fields[0] == "PING":
+				fmt.Fprint(conn, "PONG\r\n")
+			case fields[0] == "SUB":
+				subscriptions[strings.TrimSuffix(fields[1], "*")] = fields[len(fields)-1]
+			case fields[0] == "HPUB" && len(fields) == 5:
+				var headerSize, totalSize int
+				fmt.Sscan(fields[3], &headerSize)
+				fmt.Sscan(fields[4], &totalSize)
+				message := make([]byte, totalSize+2)
+				if _, err := io.ReadFull(reader, message); err != nil {
+					return
+				}
+				published <- [3]string{fields[1], string(message[:headerSize]), string(message[headerSize:totalSize])}
+
+				reply := fields[2]
+				for prefix, sid := range subscriptions {
+					if ack != "" && strings.HasPrefix(reply, prefix) {
+						fmt.Fprintf(conn, "MSG %s %s %d\r\n%s\r\n", reply, sid, len(ack), ack)
+					}
+				}
+			}
+		}
+	}()
+
+	return "nats://" + listener.Addr().String(), published
+}
+
+func TestNATSPublisher_PublishesWithMessageID(t *testing.T) {
+	url, published := fakeNATSServer(t, `{"stream":"PAYMENTS","seq":1}`)
+	publisher := NewNATSPublisher(url, "payments")
+	entry := newOutboxEntry()
+
+	err := publisher.Publish(context.Background(), entry)
+
+	assert.NoError(t, err)
+	message := <-published
+	assert.Equal(t, "payments.payment.updated", message[0])
+	assert.Contains(t, message[1], "Nats-Msg-Id: "+entry.ID.Hex()+"\r\n")
+
+	var event models.PaymentEventMessage
+	assert.NoError(t, json.Unmarshal([]byte(message[2]), &event))
+	assert.Equal(t, entry.ID.Hex(), event.ID)
+	assert.Equal(t, models.PaymentStatusCaptured, event.Payment.Status)
+}
+
+func TestNATSPublisher_StreamErrorFailsPublish(t *testing.T) {
+	url, _ := fakeNATSServer(t, `{"error":{"code":503,"err_code":10077,"description":"maximum messages exceeded"}}`)
+	publisher := NewNATSPublisher(url, "payments")
+
+	err := publisher.Publish(context.Background(), newOutboxEntry())
+
+	assert.ErrorContains(t, err, "maximum messages exceeded")
+}
+
+func TestNATSPublisher_UnacknowledgedPublishFails(t *testing.T) {
+	// Without a stream on the subject the server takes the message but
+	// nothing acknowledges it
+	url, published := fakeNATSServer(t, "")
+	publisher := NewNATSPublisher(url, "payments")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	err := publisher.Publish(ctx, newOutboxEntry())
+
+	assert.Error(t, err)
+	assert.Len(t, published, 1)
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MockPaymentEventSource is a mock implementation of PaymentEventSource
+// that replays the events it is given
+type MockPaymentEventSource struct {
+	mock.Mock
+	events []models.PaymentEvent
+}
+
+func (m *MockPaymentEventSource) Watch(ctx context.Context, resumeToken string, fn func(models.PaymentEvent) error) error {
+	args := m.Called(ctx, resumeToken)
+	for _, event := range m.events {
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return args.Error(0)
+}
+
+func collectEvents(t *testing.T, service PaymentService, ctx context.Context, resumeToken string) []*models.PaymentEventResponse {
+	var events []*models.PaymentEventResponse
+	err := service.WatchPayments(ctx, resumeToken, func(event *models.PaymentEventResponse) error {
+		events = append(events, event)
+		return nil
+	})
+	assert.NoError(t, err)
+	return events
+}
+
+func TestWatchPayments_ScopedToOwner(t *testing.T) {
+	own, other := primitive.NewObjectID(), primitive.NewObjectID()
+	events := &MockPaymentEventSource{events: []models.PaymentEvent{
+		{Type: models.PaymentEventCreated, PaymentID: own, Payment: &models.Payment{ID: own, Amount: usd(1000), OwnerID: "user-1"}},
+		{Type: models.PaymentEventCreated, PaymentID: other, Payment: &models.Payment{ID: other, Amount: usd(1000), OwnerID: "user-2"}},
+		{Type: models.PaymentEventUpdated, PaymentID: other},
+	}}
+	events.On("Watch", mock.Anything, "").Return(nil)
+	service := NewPaymentService(new(MockPaymentRepository), new(MockRefundRepository), events)
+
+	customerEvents := collectEvents(t, service, customerContext(), "")
+	if assert.Len(t, customerEvents, 1) {
+		assert.Equal(t, own.Hex(), customerEvents[0].PaymentID)
+		assert.Equal(t, "user-1", customerEvents[0].Payment.OwnerID)
+	}
+
+	// Admins also see events whose payment is unknown
+	adminEvents := collectEvents(t, service, adminContext(), "")
+	assert.Len(t, adminEvents, 3)
+	assert.Nil(t, adminEvents[2].Payment)
+}
+
+func TestWatchPayments_ResumesAfterToken(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Payment")).Return(nil)
+	repo, events := repository.NewPaymentBroadcaster(mockRepo)
+	service := NewPaymentService(repo, new(MockRefundRepository), events)
+
+	ctx := adminContext()
+	var created []string
+	createPayment := func() {
+		payment, err := service.CreatePayment(ctx, &models.PaymentRequest{Amount: "10.00"})
+		assert.NoError(t, err)
+		created = append(created, payment.ID)
+	}
+
+	// A client watches until its first event and then disconnects. Keep
+	// creating payments until it has subscribed and seen one.
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	firstEvent := make(chan *models.PaymentEventResponse, 1)
+	go func() {
+		_ = service.WatchPayments(watchCtx, "", func(event *models.PaymentEventResponse) error {
+			firstEvent <- event
+			cancel()
+			return nil
+		})
+	}()
+	var first *models.PaymentEventResponse
+	for first == nil {
+		createPayment()
+		select {
+		case first = <-firstEvent:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// Payments created while it was disconnected
+	createPayment()
+	createPayment()
+
+	var missed []string
+	for i, id := range created {
+		if id == first.PaymentID {
+			missed = created[i+1:]
+		}
+	}
+
+	resumeCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	var resumed []string
+	err := service.WatchPayments(resumeCtx, first.ResumeToken, func(event *models.PaymentEventResponse) error {
+		resumed = append(resumed, event.PaymentID)
+		if len(resumed) == len(missed) {
+			stop()
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, missed, resumed)
+}
+
+func TestWatchPayments_ExpiredOrMalformedToken(t *testing.T) {
+	_, events := repository.NewPaymentBroadcaster(new(MockPaymentRepository))
+	service := NewPaymentService(new(MockPaymentRepository), new(MockRefundRepository), events)
+
+	send := func(*models.PaymentEventResponse) error { return nil }
+
+	// A token issued before a restart, i.e. by another epoch
+	expired := base64.RawURLEncoding.EncodeToString(make([]byte, 16))
+	err := service.WatchPayments(adminContext(), expired, send)
+	assert.ErrorIs(t, err, ErrFailedPrecondition)
+
+	err = service.WatchPayments(adminContext(), "not a token", send)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+}
+
+func TestWatchPayments_RequiresCaller(t *testing.T) {
+	events := new(MockPaymentEventSource)
+	service := NewPaymentService(new(MockPaymentRepository), new(MockRefundRepository), events)
+
+	err := service.WatchPayments(context.Background(), "", func(*models.PaymentEventResponse) error { return nil })
+
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	events.AssertNotCalled(t, "Watch", mock.Anything, mock.Anything)
+}
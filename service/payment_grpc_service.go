@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"io"
+	"p3-graded-challenge-2-ziancarlos/models"
+	pb "p3-graded-challenge-2-ziancarlos/proto/payment"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// paymentGRPCService implements PaymentService by calling the payment-server
+// over gRPC. Errors are returned as gRPC status errors so callers can map
+// the status code to their own transport.
+type paymentGRPCService struct {
+	client pb.PaymentServiceClient
+}
+
+func NewPaymentGRPCService(client pb.PaymentServiceClient) PaymentService {
+	return &paymentGRPCService{
+		client: client,
+	}
+}
+
+func (s *paymentGRPCService) CreatePayment(ctx context.Context, req *models.PaymentRequest) (*models.PaymentResponse, error) {
+	payment, err := s.client.CreatePayment(ctx, &pb.CreatePaymentRequest{
+		Amount:         &pb.Money{Amount: string(req.Amount), Currency: req.Currency},
+		IdempotencyKey: req.IdempotencyKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return paymentResponseFromPB(payment), nil
+}
+
+func (s *paymentGRPCService) GetAllPayments(ctx context.Context, req *models.PaymentListRequest) (*models.PaymentListResponse, error) {
+	res, err := s.client.GetAllPayments(ctx, &pb.GetAllPaymentsRequest{
+		PageSize:       int32(req.PageSize),
+		PageToken:      req.PageToken,
+		Sort:           req.Sort,
+		OwnerId:        req.OwnerID,
+		Status:         string(req.Status),
+		MinAmount:      string(req.MinAmount),
+		MaxAmount:      string(req.MaxAmount),
+		Currency:       req.Currency,
+		CreatedAfter:   toPBTime(req.CreatedAfter),
+		CreatedBefore:  toPBTime(req.CreatedBefore),
+		IncludeDeleted: req.IncludeDeleted,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]models.PaymentResponse, 0, len(res.Payments))
+	for _, payment := range res.Payments {
+		responses = append(responses, *paymentResponseFromPB(payment))
+	}
+
+	return &models.PaymentListResponse{
+		Payments:      responses,
+		NextPageToken: res.NextPageToken,
+	}, nil
+}
+
+func (s *paymentGRPCService) GetPaymentByID(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	payment, err := s.client.GetPaymentByID(ctx, &pb.GetPaymentByIDRequest{
+		Id: id,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return paymentResponseFromPB(payment), nil
+}
+
+func (s *paymentGRPCService) DeletePayment(ctx context.Context, id string) error {
+	_, err := s.client.DeletePayment(ctx, &pb.DeletePaymentRequest{
+		Id: id,
+	})
+	return err
+}
+
+func (s *paymentGRPCService) RestorePayment(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	payment, err := s.client.RestorePayment(ctx, &pb.RestorePaymentRequest{
+		Id: id,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return paymentResponseFromPB(payment), nil
+}
+
+func (s *paymentGRPCService) AuthorizePayment(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	payment, err := s.client.AuthorizePayment(ctx, &pb.AuthorizePaymentRequest{
+		Id: id,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return paymentResponseFromPB(payment), nil
+}
+
+func (s *paymentGRPCService) CapturePayment(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	payment, err := s.client.CapturePayment(ctx, &pb.CapturePaymentRequest{
+		Id: id,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return paymentResponseFromPB(payment), nil
+}
+
+func (s *paymentGRPCService) RefundPayment(ctx context.Context, id string, req *models.RefundRequest) (*models.PaymentResponse, error) {
+	refundReq := &pb.RefundPaymentRequest{
+		Id:     id,
+		Reason: req.Reason,
+	}
+	if req.Amount != "" || req.Currency != "" {
+		refundReq.Amount = &pb.Money{Amount: string(req.Amount), Currency: req.Currency}
+	}
+
+	payment, err := s.client.RefundPayment(ctx, refundReq)
+	if err != nil {
+		return nil, err
+	}
+
+	return paymentResponseFromPB(payment), nil
+}
+
+func (s *paymentGRPCService) GetRefunds(ctx context.Context, id string) ([]models.RefundResponse, error) {
+	res, err := s.client.ListRefunds(ctx, &pb.ListRefundsRequest{
+		PaymentId: id,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]models.RefundResponse, 0, len(res.Refunds))
+	for _, refund := range res.Refunds {
+		responses = append(responses, models.RefundResponse{
+			ID:        refund.Id,
+			PaymentID: refund.PaymentId,
+			Amount:    models.Decimal(refund.GetAmount().GetAmount()),
+			Currency:  refund.GetAmount().GetCurrency(),
+			Reason:    refund.Reason,
+			CreatedAt: refund.CreatedAt.AsTime(),
+		})
+	}
+
+	return responses, nil
+}
+
+func (s *paymentGRPCService) CancelPayment(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	payment, err := s.client.CancelPayment(ctx, &pb.CancelPaymentRequest{
+		Id: id,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return paymentResponseFromPB(payment), nil
+}
+
+func (s *paymentGRPCService) FailPayment(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	payment, err := s.client.FailPayment(ctx, &pb.FailPaymentRequest{
+		Id: id,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return paymentResponseFromPB(payment), nil
+}
+
+func (s *paymentGRPCService) WatchPayments(ctx context.Context, resumeToken string, send func(*models.PaymentEventResponse) error) error {
+	stream, err := s.client.WatchPayments(ctx, &pb.WatchPaymentsRequest{
+		ResumeToken: resumeToken,
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		response := &models.PaymentEventResponse{
+			Type:        models.PaymentEventType(event.Type),
+			PaymentID:   event.PaymentId,
+			ResumeToken: event.ResumeToken,
+		}
+		if event.Payment != nil {
+			response.Payment = paymentResponseFromPB(event.Payment)
+		}
+		if err := send(response); err != nil {
+			return err
+		}
+	}
+}
+
+func paymentResponseFromPB(payment *pb.PaymentResponse) *models.PaymentResponse {
+	response := &models.PaymentResponse{
+		ID:             payment.Id,
+		Amount:         models.Decimal(payment.GetAmount().GetAmount()),
+		Currency:       payment.GetAmount().GetCurrency(),
+		Status:         models.PaymentStatus(payment.Status),
+		RefundedAmount: models.Decimal(payment.GetRefundedAmount().GetAmount()),
+		OwnerID:        payment.OwnerId,
+		CreatedAt:      payment.GetCreatedAt().AsTime(),
+		UpdatedAt:      payment.GetUpdatedAt().AsTime(),
+	}
+	if payment.DeletedAt != nil {
+		deletedAt := payment.DeletedAt.AsTime()
+		response.DeletedAt = &deletedAt
+	}
+	return response
+}
+
+// toPBTime converts an optional time, leaving the zero time unset.
+func toPBTime(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
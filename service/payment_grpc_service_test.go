@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"p3-graded-challenge-2-ziancarlos/models"
+	pb "p3-graded-challenge-2-ziancarlos/proto/payment"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MockPaymentServiceClient is a mock implementation of pb.PaymentServiceClient
+type MockPaymentServiceClient struct {
+	mock.Mock
+}
+
+func (m *MockPaymentServiceClient) CreatePayment(ctx context.Context, in *pb.CreatePaymentRequest, opts ...grpc.CallOption) (*pb.PaymentResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*pb.PaymentResponse), args.Error(1)
+}
+
+func (m *MockPaymentServiceClient) GetAllPayments(ctx context.Context, in *pb.GetAllPaymentsRequest, opts ...grpc.CallOption) (*pb.GetAllPaymentsResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*pb.GetAllPaymentsResponse), args.Error(1)
+}
+
+func (m *MockPaymentServiceClient) GetPaymentByID(ctx context.Context, in *pb.GetPaymentByIDRequest, opts ...grpc.CallOption) (*pb.PaymentResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*pb.PaymentResponse), args.Error(1)
+}
+
+func (m *MockPaymentServiceClient) DeletePayment(ctx context.Context, in *pb.DeletePaymentRequest, opts ...grpc.CallOption) (*pb.DeletePaymentResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*pb.DeletePaymentResponse), args.Error(1)
+}
+
+func (m *MockPaymentServiceClient) RestorePayment(ctx context.Context, in *pb.RestorePaymentRequest, opts ...grpc.CallOption) (*pb.PaymentResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*pb.PaymentResponse), args.Error(1)
+}
+
+func (m *MockPaymentServiceClient) AuthorizePayment(ctx context.Context, in *pb.AuthorizePaymentRequest, opts ...grpc.CallOption) (*pb.PaymentResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*pb.PaymentResponse), args.Error(1)
+}
+
+func (m *MockPaymentServiceClient) CapturePayment(ctx context.Context, in *pb.CapturePaymentRequest, opts ...grpc.CallOption) (*pb.PaymentResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*pb.PaymentResponse), args.Error(1)
+}
+
+func (m *MockPaymentServiceClient) RefundPayment(ctx context.Context, in *pb.RefundPaymentRequest, opts ...grpc.CallOption) (*pb.PaymentResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*pb.PaymentResponse), args.Error(1)
+}
+
+func (m *MockPaymentServiceClient) CancelPayment(ctx context.Context, in *pb.CancelPaymentRequest, opts ...grpc.CallOption) (*pb.PaymentResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*pb.PaymentResponse), args.Error(1)
+}
+
+func (m *MockPaymentServiceClient) FailPayment(ctx context.Context, in *pb.FailPaymentRequest, opts ...grpc.CallOption) (*pb.PaymentResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*pb.PaymentResponse), args.Error(1)
+}
+
+func (m *MockPaymentServiceClient) WatchPayments(ctx context.Context, in *pb.WatchPaymentsRequest, opts ...grpc.CallOption) (pb.PaymentService_WatchPaymentsClient, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(pb.PaymentService_WatchPaymentsClient), args.Error(1)
+}
+
+func (m *MockPaymentServiceClient) ListRefunds(ctx context.Context, in *pb.ListRefundsRequest, opts ...grpc.CallOption) (*pb.ListRefundsResponse, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*pb.ListRefundsResponse), args.Error(1)
+}
+
+func TestGRPCCreatePayment_Success(t *testing.T) {
+	mockClient := new(MockPaymentServiceClient)
+	service := NewPaymentGRPCService(mockClient)
+
+	ctx := context.Background()
+	amount := &pb.Money{Amount: "75.25", Currency: "EUR"}
+	mockClient.On("CreatePayment", ctx, &pb.CreatePaymentRequest{Amount: amount}).
+		Return(&pb.PaymentResponse{Id: "abc", Amount: amount}, nil)
+
+	result, err := service.CreatePayment(ctx, &models.PaymentRequest{Amount: "75.25", Currency: "EUR"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", result.ID)
+	assert.Equal(t, models.Decimal("75.25"), result.Amount)
+	assert.Equal(t, "EUR", result.Currency)
+	mockClient.AssertExpectations(t)
+}
+
+func TestGRPCGetPaymentByID_PassesStatusThrough(t *testing.T) {
+	mockClient := new(MockPaymentServiceClient)
+	service := NewPaymentGRPCService(mockClient)
+
+	ctx := context.Background()
+	mockClient.On("GetPaymentByID", ctx, &pb.GetPaymentByIDRequest{Id: "missing"}).
+		Return(nil, status.Error(codes.NotFound, "payment not found"))
+
+	result, err := service.GetPaymentByID(ctx, "missing")
+
+	assert.Nil(t, result)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	mockClient.AssertExpectations(t)
+}
+
+func TestGRPCGetAllPayments_ForwardsPaging(t *testing.T) {
+	mockClient := new(MockPaymentServiceClient)
+	service := NewPaymentGRPCService(mockClient)
+
+	ctx := context.Background()
+	mockClient.On("GetAllPayments", ctx, &pb.GetAllPaymentsRequest{PageSize: 10, PageToken: "page-2", Sort: "-created_at", Status: "captured"}).
+		Return(&pb.GetAllPaymentsResponse{
+			Payments:      []*pb.PaymentResponse{{Id: "abc", Status: "captured"}},
+			NextPageToken: "page-3",
+		}, nil)
+
+	result, err := service.GetAllPayments(ctx, &models.PaymentListRequest{
+		ListRequest: models.ListRequest{PageSize: 10, PageToken: "page-2", Sort: "-created_at"},
+		Status:      models.PaymentStatusCaptured,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", result.Payments[0].ID)
+	assert.Equal(t, "page-3", result.NextPageToken)
+	mockClient.AssertExpectations(t)
+}
@@ -2,90 +2,419 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"p3-graded-challenge-2-ziancarlos/models"
 	"p3-graded-challenge-2-ziancarlos/repository"
+	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type PaymentService interface {
 	CreatePayment(ctx context.Context, req *models.PaymentRequest) (*models.PaymentResponse, error)
-	GetAllPayments(ctx context.Context) ([]models.PaymentResponse, error)
+	GetAllPayments(ctx context.Context, req *models.PaymentListRequest) (*models.PaymentListResponse, error)
 	GetPaymentByID(ctx context.Context, id string) (*models.PaymentResponse, error)
+	// DeletePayment hides a pending payment until it is restored or purged.
+	// Payments past pending are part of the accounting history; deleting
+	// them fails with ErrFailedPrecondition, they are cancelled instead.
 	DeletePayment(ctx context.Context, id string) error
+	// RestorePayment undeletes a payment. It fails with
+	// ErrFailedPrecondition when the payment is not deleted.
+	RestorePayment(ctx context.Context, id string) (*models.PaymentResponse, error)
+	AuthorizePayment(ctx context.Context, id string) (*models.PaymentResponse, error)
+	CapturePayment(ctx context.Context, id string) (*models.PaymentResponse, error)
+	// RefundPayment refunds part or all of a captured payment. The payment
+	// becomes refunded once the refunds add up to its amount.
+	RefundPayment(ctx context.Context, id string, req *models.RefundRequest) (*models.PaymentResponse, error)
+	GetRefunds(ctx context.Context, id string) ([]models.RefundResponse, error)
+	CancelPayment(ctx context.Context, id string) (*models.PaymentResponse, error)
+	FailPayment(ctx context.Context, id string) (*models.PaymentResponse, error)
+	// WatchPayments calls send for every change to a payment visible to the
+	// caller, starting after resumeToken or from now if it is empty, until
+	// ctx is done or send fails.
+	WatchPayments(ctx context.Context, resumeToken string, send func(*models.PaymentEventResponse) error) error
+}
+
+// paymentTransitions lists, for every target status, the statuses a payment
+// may move from.
+var paymentTransitions = map[models.PaymentStatus][]models.PaymentStatus{
+	models.PaymentStatusAuthorized: {models.PaymentStatusPending},
+	models.PaymentStatusCaptured:   {models.PaymentStatusAuthorized},
+	models.PaymentStatusCancelled:  {models.PaymentStatusPending, models.PaymentStatusAuthorized},
+	models.PaymentStatusFailed:     {models.PaymentStatusPending, models.PaymentStatusAuthorized},
 }
 
 type paymentService struct {
-	repo repository.PaymentRepository
+	repo       repository.PaymentRepository
+	refundRepo repository.RefundRepository
+	events     repository.PaymentEventSource
 }
 
-func NewPaymentService(repo repository.PaymentRepository) PaymentService {
+func NewPaymentService(repo repository.PaymentRepository, refundRepo repository.RefundRepository, events repository.PaymentEventSource) PaymentService {
 	return &paymentService{
-		repo: repo,
+		repo:       repo,
+		refundRepo: refundRepo,
+		events:     events,
 	}
 }
 
 func (s *paymentService) CreatePayment(ctx context.Context, req *models.PaymentRequest) (*models.PaymentResponse, error) {
-	if req.Amount <= 0 {
-		return nil, fmt.Errorf("amount must be greater than 0")
+	caller, err := callerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := parsePositiveAmount("amount", req.Amount, req.Currency)
+	if err != nil {
+		return nil, err
 	}
 
+	now := time.Now()
 	payment := &models.Payment{
-		Amount: req.Amount,
+		Amount:         amount,
+		Status:         models.PaymentStatusPending,
+		RefundedAmount: models.Money{Currency: amount.Currency},
+		OwnerID:        caller.UserID,
+		CreatedAt:      now,
+		UpdatedAt:      now,
 	}
 
-	err := s.repo.Create(ctx, payment)
+	if req.IdempotencyKey != "" {
+		payment.IdempotencyKey = req.IdempotencyKey
+		payment.RequestHash = paymentRequestHash(amount)
+
+		existing, err := s.repo.FindByIdempotencyKey(ctx, caller.UserID, req.IdempotencyKey)
+		if err == nil {
+			return replayPayment(existing, payment.RequestHash)
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	err = s.repo.Create(ctx, payment)
 	if err != nil {
+		// A concurrent request with the same key won the race to insert
+		if req.IdempotencyKey != "" && errors.Is(err, repository.ErrDuplicateKey) {
+			existing, findErr := s.repo.FindByIdempotencyKey(ctx, caller.UserID, req.IdempotencyKey)
+			if findErr != nil {
+				return nil, findErr
+			}
+			return replayPayment(existing, payment.RequestHash)
+		}
 		return nil, err
 	}
 
-	return &models.PaymentResponse{
-		ID:     payment.ID.Hex(),
-		Amount: payment.Amount,
+	return toPaymentResponse(payment), nil
+}
+
+// replayPayment returns the payment created earlier with the same idempotency
+// key, provided it was created from the same request body.
+func replayPayment(existing *models.Payment, requestHash string) (*models.PaymentResponse, error) {
+	if existing.RequestHash != requestHash {
+		return nil, fmt.Errorf("%w: idempotency key was already used with a different request", ErrAlreadyExists)
+	}
+	return toPaymentResponse(existing), nil
+}
+
+// paymentRequestHash fingerprints the fields of a payment request that an
+// idempotent retry must repeat unchanged. It hashes the parsed amount so
+// "10.5" and "10.50" count as the same request.
+func paymentRequestHash(amount models.Money) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("amount=%d&currency=%s", amount.Units, amount.Currency)))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *paymentService) GetAllPayments(ctx context.Context, req *models.PaymentListRequest) (*models.PaymentListResponse, error) {
+	caller, err := callerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ownerID := caller.UserID
+	if caller.IsAdmin() {
+		ownerID = req.OwnerID
+	}
+
+	page, err := pageOptions(req.ListRequest)
+	if err != nil {
+		return nil, err
+	}
+	if req.Status != "" && !req.Status.Valid() {
+		return nil, fmt.Errorf("%w: unknown payment status %q", ErrInvalidArgument, req.Status)
+	}
+	currency, minAmount, maxAmount, err := parseAmountRange("amount", req.MinAmount, req.MaxAmount, req.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCreatedRange(req.CreatedAfter, req.CreatedBefore); err != nil {
+		return nil, err
+	}
+
+	payments, next, err := s.repo.Find(ctx, repository.PaymentFilter{
+		OwnerID:        ownerID,
+		Status:         req.Status,
+		Currency:       currency,
+		MinAmount:      minAmount,
+		MaxAmount:      maxAmount,
+		CreatedAfter:   req.CreatedAfter,
+		CreatedBefore:  req.CreatedBefore,
+		IncludeDeleted: req.IncludeDeleted && caller.IsAdmin(),
+	}, page)
+	if err != nil {
+		return nil, listError(err)
+	}
+
+	responses := make([]models.PaymentResponse, 0, len(payments))
+	for i := range payments {
+		responses = append(responses, *toPaymentResponse(&payments[i]))
+	}
+
+	return &models.PaymentListResponse{
+		Payments:      responses,
+		NextPageToken: next,
 	}, nil
 }
 
-func (s *paymentService) GetAllPayments(ctx context.Context) ([]models.PaymentResponse, error) {
-	payments, err := s.repo.FindAll(ctx)
+func (s *paymentService) GetPaymentByID(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	payment, err := s.findOwnedPayment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return toPaymentResponse(payment), nil
+}
+
+func (s *paymentService) DeletePayment(ctx context.Context, id string) error {
+	payment, err := s.findOwnedPayment(ctx, id)
+	if err != nil {
+		return err
+	}
+	if status := paymentStatus(payment); status != models.PaymentStatusPending {
+		return fmt.Errorf("%w: cannot delete a %s payment, only pending ones", ErrFailedPrecondition, status)
+	}
+
+	return s.repo.Delete(ctx, payment.ID)
+}
+
+func (s *paymentService) RestorePayment(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid payment ID: %v", ErrInvalidArgument, err)
+	}
+
+	payment, err := s.repo.Restore(ctx, objectID)
+	if errors.Is(err, ErrNotFound) {
+		if _, findErr := s.repo.FindByID(ctx, objectID); findErr == nil {
+			return nil, fmt.Errorf("%w: payment is not deleted", ErrFailedPrecondition)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return toPaymentResponse(payment), nil
+}
+
+func (s *paymentService) AuthorizePayment(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	return s.transition(ctx, id, models.PaymentStatusAuthorized)
+}
+
+func (s *paymentService) CapturePayment(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	return s.transition(ctx, id, models.PaymentStatusCaptured)
+}
+
+func (s *paymentService) RefundPayment(ctx context.Context, id string, req *models.RefundRequest) (*models.PaymentResponse, error) {
+	payment, err := s.findOwnedPayment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	objectID := payment.ID
+	if paymentStatus(payment) != models.PaymentStatusCaptured {
+		return nil, fmt.Errorf("%w: cannot refund a payment that is %s", ErrFailedPrecondition, paymentStatus(payment))
+	}
+
+	if req.Currency != "" && !strings.EqualFold(req.Currency, payment.Amount.Currency) {
+		return nil, fmt.Errorf("%w: refund currency %s does not match the payment currency %s", ErrInvalidArgument, req.Currency, payment.Amount.Currency)
+	}
+
+	remaining := payment.Amount.Sub(refundedAmount(payment))
+	amount := remaining
+	if req.Amount != "" {
+		amount, err = parsePositiveAmount("amount", req.Amount, payment.Amount.Currency)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if amount.Units <= 0 {
+		return nil, fmt.Errorf("%w: payment is already fully refunded", ErrFailedPrecondition)
+	}
+	if amount.Units > remaining.Units {
+		return nil, fmt.Errorf("%w: refund of %s exceeds the remaining %s", ErrFailedPrecondition, amount, remaining)
+	}
+
+	// The update is conditional, so a concurrent refund that already used up
+	// the remaining amount makes this one fail instead of over-refunding
+	refund := &models.Refund{
+		PaymentID: objectID,
+		Amount:    amount,
+		Reason:    req.Reason,
+		CreatedAt: time.Now(),
+	}
+	updated, err := s.repo.AddRefund(ctx, refund)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, fmt.Errorf("%w: payment was changed by another request, please retry", ErrFailedPrecondition)
+	}
+
+	payment, err = s.repo.FindByID(ctx, objectID)
+	if err != nil {
+		return nil, err
+	}
+
+	return toPaymentResponse(payment), nil
+}
+
+func (s *paymentService) GetRefunds(ctx context.Context, id string) ([]models.RefundResponse, error) {
+	payment, err := s.findOwnedPayment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	refunds, err := s.refundRepo.FindByPaymentID(ctx, payment.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	var responses []models.PaymentResponse
-	for _, payment := range payments {
-		responses = append(responses, models.PaymentResponse{
-			ID:     payment.ID.Hex(),
-			Amount: payment.Amount,
+	responses := make([]models.RefundResponse, 0, len(refunds))
+	for _, refund := range refunds {
+		responses = append(responses, models.RefundResponse{
+			ID:        refund.ID.Hex(),
+			PaymentID: refund.PaymentID.Hex(),
+			Amount:    refund.Amount.Decimal(),
+			Currency:  refund.Amount.Currency,
+			Reason:    refund.Reason,
+			CreatedAt: refund.CreatedAt,
 		})
 	}
 
 	return responses, nil
 }
 
-func (s *paymentService) GetPaymentByID(ctx context.Context, id string) (*models.PaymentResponse, error) {
-	objectID, err := primitive.ObjectIDFromHex(id)
+func (s *paymentService) CancelPayment(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	return s.transition(ctx, id, models.PaymentStatusCancelled)
+}
+
+func (s *paymentService) FailPayment(ctx context.Context, id string) (*models.PaymentResponse, error) {
+	return s.transition(ctx, id, models.PaymentStatusFailed)
+}
+
+// transition moves a payment to the given status, rejecting moves that the
+// payment state machine does not allow.
+func (s *paymentService) transition(ctx context.Context, id string, to models.PaymentStatus) (*models.PaymentResponse, error) {
+	payment, err := s.findOwnedPayment(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("invalid payment ID: %w", err)
+		return nil, err
 	}
 
-	payment, err := s.repo.FindByID(ctx, objectID)
+	updated, err := s.repo.UpdateStatus(ctx, payment.ID, paymentTransitions[to], to)
 	if err != nil {
 		return nil, err
 	}
 
-	return &models.PaymentResponse{
-		ID:     payment.ID.Hex(),
-		Amount: payment.Amount,
-	}, nil
+	payment, err = s.repo.FindByID(ctx, payment.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, fmt.Errorf("%w: cannot move payment from %s to %s", ErrFailedPrecondition, paymentStatus(payment), to)
+	}
+
+	return toPaymentResponse(payment), nil
 }
 
-func (s *paymentService) DeletePayment(ctx context.Context, id string) error {
+func (s *paymentService) WatchPayments(ctx context.Context, resumeToken string, send func(*models.PaymentEventResponse) error) error {
+	caller, err := callerFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.events.Watch(ctx, resumeToken, func(event models.PaymentEvent) error {
+		// Events whose payment is unknown cannot be attributed to an owner
+		if !caller.IsAdmin() && (event.Payment == nil || event.Payment.OwnerID != caller.UserID) {
+			return nil
+		}
+		return send(toPaymentEventResponse(event))
+	})
+	return watchError(ctx, err)
+}
+
+// findOwnedPayment loads a payment on behalf of the caller. Payments owned by
+// someone else are reported as not found unless the caller is an admin, so
+// their existence is not revealed.
+func (s *paymentService) findOwnedPayment(ctx context.Context, id string) (*models.Payment, error) {
+	caller, err := callerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return fmt.Errorf("invalid payment ID: %w", err)
+		return nil, fmt.Errorf("%w: invalid payment ID: %v", ErrInvalidArgument, err)
+	}
+
+	payment, err := s.repo.FindByID(ctx, objectID)
+	if err != nil {
+		return nil, err
+	}
+	if payment.OwnerID != caller.UserID && !caller.IsAdmin() {
+		return nil, fmt.Errorf("payment %w", ErrNotFound)
 	}
 
-	return s.repo.Delete(ctx, objectID)
+	return payment, nil
 }
 
+// paymentStatus returns the status of a payment, treating payments stored
+// before statuses were introduced as pending.
+func paymentStatus(payment *models.Payment) models.PaymentStatus {
+	if payment.Status == "" {
+		return models.PaymentStatusPending
+	}
+	return payment.Status
+}
+
+// refundedAmount returns the refunded total of a payment in the payment's
+// currency, which is zero for payments that were never refunded.
+func refundedAmount(payment *models.Payment) models.Money {
+	return models.Money{Units: payment.RefundedAmount.Units, Currency: payment.Amount.Currency}
+}
+
+func toPaymentResponse(payment *models.Payment) *models.PaymentResponse {
+	createdAt, updatedAt := recordedTimes(payment.ID, payment.CreatedAt, payment.UpdatedAt)
+	return &models.PaymentResponse{
+		ID:             payment.ID.Hex(),
+		Amount:         payment.Amount.Decimal(),
+		Currency:       payment.Amount.Currency,
+		Status:         paymentStatus(payment),
+		RefundedAmount: refundedAmount(payment).Decimal(),
+		OwnerID:        payment.OwnerID,
+		CreatedAt:      createdAt,
+		UpdatedAt:      updatedAt,
+		DeletedAt:      payment.DeletedAt,
+	}
+}
+
+func toPaymentEventResponse(event models.PaymentEvent) *models.PaymentEventResponse {
+	response := &models.PaymentEventResponse{
+		Type:        event.Type,
+		PaymentID:   event.PaymentID.Hex(),
+		ResumeToken: event.ResumeToken,
+	}
+	if event.Payment != nil {
+		response.Payment = toPaymentResponse(event.Payment)
+	}
+	return response
+}
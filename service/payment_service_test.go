@@ -2,9 +2,11 @@ package service
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/repository"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -26,12 +28,12 @@ func (m *MockPaymentRepository) Create(ctx context.Context, payment *models.Paym
 	return args.Error(0)
 }
 
-func (m *MockPaymentRepository) FindAll(ctx context.Context) ([]models.Payment, error) {
-	args := m.Called(ctx)
+func (m *MockPaymentRepository) Find(ctx context.Context, filter repository.PaymentFilter, page repository.PageOptions) ([]models.Payment, string, error) {
+	args := m.Called(ctx, filter, page)
 	if args.Get(0) == nil {
-		return nil, args.Error(1)
+		return nil, "", args.Error(2)
 	}
-	return args.Get(0).([]models.Payment), args.Error(1)
+	return args.Get(0).([]models.Payment), args.String(1), args.Error(2)
 }
 
 func (m *MockPaymentRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Payment, error) {
@@ -42,18 +44,80 @@ func (m *MockPaymentRepository) FindByID(ctx context.Context, id primitive.Objec
 	return args.Get(0).(*models.Payment), args.Error(1)
 }
 
+func (m *MockPaymentRepository) FindByIdempotencyKey(ctx context.Context, ownerID, key string) (*models.Payment, error) {
+	args := m.Called(ctx, ownerID, key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Payment), args.Error(1)
+}
+
+func (m *MockPaymentRepository) UpdateStatus(ctx context.Context, id primitive.ObjectID, from []models.PaymentStatus, to models.PaymentStatus) (bool, error) {
+	args := m.Called(ctx, id, from, to)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockPaymentRepository) AddRefund(ctx context.Context, refund *models.Refund) (bool, error) {
+	args := m.Called(ctx, refund)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *MockPaymentRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
 	args := m.Called(ctx, id)
 	return args.Error(0)
 }
 
+func (m *MockPaymentRepository) Restore(ctx context.Context, id primitive.ObjectID) (*models.Payment, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Payment), args.Error(1)
+}
+
+// MockRefundRepository is a mock implementation of RefundRepository
+type MockRefundRepository struct {
+	mock.Mock
+}
+
+func (m *MockRefundRepository) Create(ctx context.Context, refund *models.Refund) error {
+	args := m.Called(ctx, refund)
+	if args.Get(0) == nil {
+		refund.ID = primitive.NewObjectID()
+		return nil
+	}
+	return args.Error(0)
+}
+
+func (m *MockRefundRepository) FindByPaymentID(ctx context.Context, paymentID primitive.ObjectID) ([]models.Refund, error) {
+	args := m.Called(ctx, paymentID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Refund), args.Error(1)
+}
+
+func usd(units int64) models.Money {
+	return models.Money{Units: units, Currency: "USD"}
+}
+
+// adminContext and customerContext return contexts carrying an admin and a
+// customer caller respectively.
+func adminContext() context.Context {
+	return ContextWithCaller(context.Background(), models.Caller{UserID: "admin-1", Roles: []string{models.RoleAdmin}})
+}
+
+func customerContext() context.Context {
+	return ContextWithCaller(context.Background(), models.Caller{UserID: "user-1", Roles: []string{models.RoleCustomer}})
+}
+
 func TestCreatePayment_Success(t *testing.T) {
 	mockRepo := new(MockPaymentRepository)
-	service := NewPaymentService(mockRepo)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
 
-	ctx := context.Background()
+	ctx := adminContext()
 	req := &models.PaymentRequest{
-		Amount: 100.50,
+		Amount: "100.50",
 	}
 
 	mockRepo.On("Create", ctx, mock.AnythingOfType("*models.Payment")).Return(nil)
@@ -62,18 +126,84 @@ func TestCreatePayment_Success(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
-	assert.Equal(t, 100.50, result.Amount)
+	assert.Equal(t, models.Decimal("100.50"), result.Amount)
+	assert.Equal(t, "USD", result.Currency)
 	assert.NotEmpty(t, result.ID)
 	mockRepo.AssertExpectations(t)
 }
 
+func TestCreatePayment_IdempotentReplay(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := adminContext()
+	req := &models.PaymentRequest{Amount: "100.50", IdempotencyKey: "key-1"}
+	id := primitive.NewObjectID()
+	existing := &models.Payment{
+		ID:             id,
+		Amount:         usd(10050),
+		Status:         models.PaymentStatusPending,
+		IdempotencyKey: "key-1",
+		RequestHash:    paymentRequestHash(usd(10050)),
+	}
+
+	mockRepo.On("FindByIdempotencyKey", ctx, "admin-1", "key-1").Return(existing, nil)
+
+	result, err := service.CreatePayment(ctx, req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, id.Hex(), result.ID)
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestCreatePayment_IdempotencyKeyReusedWithDifferentBody(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := adminContext()
+	existing := &models.Payment{
+		ID:             primitive.NewObjectID(),
+		Amount:         usd(10050),
+		IdempotencyKey: "key-1",
+		RequestHash:    paymentRequestHash(usd(10050)),
+	}
+
+	mockRepo.On("FindByIdempotencyKey", ctx, "admin-1", "key-1").Return(existing, nil)
+
+	result, err := service.CreatePayment(ctx, &models.PaymentRequest{Amount: "99.00", IdempotencyKey: "key-1"})
+
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestCreatePayment_IdempotencyKeyRace(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := adminContext()
+	req := &models.PaymentRequest{Amount: "20", IdempotencyKey: "key-2"}
+	id := primitive.NewObjectID()
+	winner := &models.Payment{ID: id, Amount: usd(2000), IdempotencyKey: "key-2", RequestHash: paymentRequestHash(usd(2000))}
+
+	mockRepo.On("FindByIdempotencyKey", ctx, "admin-1", "key-2").Return(nil, fmt.Errorf("payment %w", ErrNotFound)).Once()
+	mockRepo.On("Create", ctx, mock.AnythingOfType("*models.Payment")).Return(fmt.Errorf("failed to create payment: %w", repository.ErrDuplicateKey))
+	mockRepo.On("FindByIdempotencyKey", ctx, "admin-1", "key-2").Return(winner, nil).Once()
+
+	result, err := service.CreatePayment(ctx, req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, id.Hex(), result.ID)
+	mockRepo.AssertExpectations(t)
+}
+
 func TestCreatePayment_InvalidAmount(t *testing.T) {
 	mockRepo := new(MockPaymentRepository)
-	service := NewPaymentService(mockRepo)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
 
-	ctx := context.Background()
+	ctx := adminContext()
 	req := &models.PaymentRequest{
-		Amount: -10.0,
+		Amount: "-10.00",
 	}
 
 	result, err := service.CreatePayment(ctx, req)
@@ -83,40 +213,128 @@ func TestCreatePayment_InvalidAmount(t *testing.T) {
 	assert.Contains(t, err.Error(), "amount must be greater than 0")
 }
 
+func TestCreatePayment_StoresMinorUnits(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := adminContext()
+	mockRepo.On("Create", ctx, mock.MatchedBy(func(payment *models.Payment) bool {
+		return payment.Amount == models.Money{Units: 1500, Currency: "JPY"}
+	})).Return(nil)
+
+	result, err := service.CreatePayment(ctx, &models.PaymentRequest{Amount: "1500", Currency: "jpy"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.Decimal("1500"), result.Amount)
+	assert.Equal(t, models.Decimal("0"), result.RefundedAmount)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreatePayment_RejectsExtraPrecision(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := adminContext()
+	for _, req := range []*models.PaymentRequest{
+		{Amount: "10.005", Currency: "USD"},
+		{Amount: "10.5", Currency: "JPY"},
+		{Amount: "10.00", Currency: "XYZ"},
+	} {
+		result, err := service.CreatePayment(ctx, req)
+
+		assert.Nil(t, result)
+		assert.ErrorIs(t, err, ErrInvalidArgument)
+	}
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
 func TestGetAllPayments_Success(t *testing.T) {
 	mockRepo := new(MockPaymentRepository)
-	service := NewPaymentService(mockRepo)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
 
-	ctx := context.Background()
+	ctx := adminContext()
 	id1 := primitive.NewObjectID()
 	id2 := primitive.NewObjectID()
 
 	expectedPayments := []models.Payment{
-		{ID: id1, Amount: 100.0},
-		{ID: id2, Amount: 200.0},
+		{ID: id1, Amount: usd(10000)},
+		{ID: id2, Amount: usd(20000)},
 	}
 
-	mockRepo.On("FindAll", ctx).Return(expectedPayments, nil)
+	page := repository.PageOptions{Size: models.DefaultPageSize}
+	mockRepo.On("Find", ctx, repository.PaymentFilter{}, page).Return(expectedPayments, "next", nil)
 
-	result, err := service.GetAllPayments(ctx)
+	result, err := service.GetAllPayments(ctx, &models.PaymentListRequest{})
 
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
-	assert.Equal(t, 2, len(result))
-	assert.Equal(t, id1.Hex(), result[0].ID)
-	assert.Equal(t, 100.0, result[0].Amount)
+	assert.Equal(t, 2, len(result.Payments))
+	assert.Equal(t, id1.Hex(), result.Payments[0].ID)
+	assert.Equal(t, models.Decimal("100.00"), result.Payments[0].Amount)
+	assert.Equal(t, "next", result.NextPageToken)
 	mockRepo.AssertExpectations(t)
 }
 
+func TestGetAllPayments_PushesFiltersDown(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := adminContext()
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	minAmount := models.Money{Units: 1050, Currency: "EUR"}
+	filter := repository.PaymentFilter{
+		Status:       models.PaymentStatusCaptured,
+		Currency:     "EUR",
+		MinAmount:    &minAmount,
+		CreatedAfter: after,
+	}
+	page := repository.PageOptions{Size: models.MaxPageSize, Token: "token", Sort: "-amount"}
+	mockRepo.On("Find", ctx, filter, page).Return([]models.Payment{}, "", nil)
+
+	result, err := service.GetAllPayments(ctx, &models.PaymentListRequest{
+		ListRequest:  models.ListRequest{PageSize: 500, PageToken: "token", Sort: "-amount"},
+		Status:       models.PaymentStatusCaptured,
+		MinAmount:    "10.50",
+		Currency:     "eur",
+		CreatedAfter: after,
+	})
+
+	assert.NoError(t, err)
+	assert.Empty(t, result.Payments)
+	assert.Empty(t, result.NextPageToken)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetAllPayments_InvalidQuery(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := adminContext()
+	mockRepo.On("Find", ctx, mock.Anything, mock.Anything).
+		Return(nil, "", fmt.Errorf("failed to find payments: %w", repository.ErrInvalidQuery))
+
+	for _, req := range []*models.PaymentListRequest{
+		{MinAmount: "20.00", MaxAmount: "10.00"},
+		{Status: "settled"},
+		{ListRequest: models.ListRequest{PageSize: -1}},
+		{ListRequest: models.ListRequest{Sort: "unknown"}},
+	} {
+		result, err := service.GetAllPayments(ctx, req)
+
+		assert.Nil(t, result)
+		assert.ErrorIs(t, err, ErrInvalidArgument)
+	}
+}
+
 func TestGetPaymentByID_Success(t *testing.T) {
 	mockRepo := new(MockPaymentRepository)
-	service := NewPaymentService(mockRepo)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
 
-	ctx := context.Background()
+	ctx := adminContext()
 	id := primitive.NewObjectID()
 	expectedPayment := &models.Payment{
 		ID:     id,
-		Amount: 150.0,
+		Amount: usd(15000),
 	}
 
 	mockRepo.On("FindByID", ctx, id).Return(expectedPayment, nil)
@@ -126,15 +344,15 @@ func TestGetPaymentByID_Success(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
 	assert.Equal(t, id.Hex(), result.ID)
-	assert.Equal(t, 150.0, result.Amount)
+	assert.Equal(t, models.Decimal("150.00"), result.Amount)
 	mockRepo.AssertExpectations(t)
 }
 
 func TestGetPaymentByID_InvalidID(t *testing.T) {
 	mockRepo := new(MockPaymentRepository)
-	service := NewPaymentService(mockRepo)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
 
-	ctx := context.Background()
+	ctx := adminContext()
 
 	result, err := service.GetPaymentByID(ctx, "invalid-id")
 
@@ -145,11 +363,12 @@ func TestGetPaymentByID_InvalidID(t *testing.T) {
 
 func TestDeletePayment_Success(t *testing.T) {
 	mockRepo := new(MockPaymentRepository)
-	service := NewPaymentService(mockRepo)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
 
-	ctx := context.Background()
+	ctx := adminContext()
 	id := primitive.NewObjectID()
 
+	mockRepo.On("FindByID", ctx, id).Return(&models.Payment{ID: id, OwnerID: "user-1"}, nil)
 	mockRepo.On("Delete", ctx, id).Return(nil)
 
 	err := service.DeletePayment(ctx, id.Hex())
@@ -158,18 +377,356 @@ func TestDeletePayment_Success(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+func TestDeletePayment_OnlyPending(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := adminContext()
+	id := primitive.NewObjectID()
+
+	mockRepo.On("FindByID", ctx, id).Return(&models.Payment{ID: id, Amount: usd(1000), Status: models.PaymentStatusCaptured}, nil)
+
+	err := service.DeletePayment(ctx, id.Hex())
+
+	assert.ErrorIs(t, err, ErrFailedPrecondition)
+	mockRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+}
+
 func TestDeletePayment_NotFound(t *testing.T) {
 	mockRepo := new(MockPaymentRepository)
-	service := NewPaymentService(mockRepo)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
 
-	ctx := context.Background()
+	ctx := adminContext()
 	id := primitive.NewObjectID()
 
-	mockRepo.On("Delete", ctx, id).Return(errors.New("payment not found"))
+	mockRepo.On("FindByID", ctx, id).Return(nil, fmt.Errorf("payment %w", ErrNotFound))
 
 	err := service.DeletePayment(ctx, id.Hex())
 
+	assert.ErrorIs(t, err, ErrNotFound)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCapturePayment_Success(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := adminContext()
+	id := primitive.NewObjectID()
+
+	mockRepo.On("UpdateStatus", ctx, id, []models.PaymentStatus{models.PaymentStatusAuthorized}, models.PaymentStatusCaptured).Return(true, nil)
+	mockRepo.On("FindByID", ctx, id).Return(&models.Payment{ID: id, Amount: usd(5000), Status: models.PaymentStatusCaptured}, nil)
+
+	result, err := service.CapturePayment(ctx, id.Hex())
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.PaymentStatusCaptured, result.Status)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCancelPayment_FromPendingOrAuthorized(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := adminContext()
+	id := primitive.NewObjectID()
+
+	mockRepo.On("UpdateStatus", ctx, id, []models.PaymentStatus{models.PaymentStatusPending, models.PaymentStatusAuthorized}, models.PaymentStatusCancelled).Return(true, nil)
+	mockRepo.On("FindByID", ctx, id).Return(&models.Payment{ID: id, Amount: usd(5000), Status: models.PaymentStatusCancelled}, nil)
+
+	result, err := service.CancelPayment(ctx, id.Hex())
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.PaymentStatusCancelled, result.Status)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRefundPayment_NotCaptured(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := adminContext()
+	id := primitive.NewObjectID()
+
+	mockRepo.On("FindByID", ctx, id).Return(&models.Payment{ID: id, Amount: usd(5000), Status: models.PaymentStatusPending}, nil)
+
+	result, err := service.RefundPayment(ctx, id.Hex(), &models.RefundRequest{Amount: "10.00"})
+
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, ErrFailedPrecondition)
+	assert.Contains(t, err.Error(), "cannot refund a payment that is pending")
+	mockRepo.AssertNotCalled(t, "AddRefund", mock.Anything, mock.Anything)
+}
+
+func TestRefundPayment_Partial(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockRefundRepo := new(MockRefundRepository)
+	ledger := repository.NewRefundLedger(mockRepo, mockRefundRepo, repository.NewTransactor(nil, false))
+	service := NewPaymentService(ledger, mockRefundRepo, nil)
+
+	ctx := adminContext()
+	id := primitive.NewObjectID()
+
+	isRefund := mock.MatchedBy(func(refund *models.Refund) bool {
+		return refund.PaymentID == id && refund.Amount == usd(3000) && refund.Reason == "damaged item"
+	})
+	mockRepo.On("FindByID", ctx, id).Return(&models.Payment{ID: id, Amount: usd(10000), Status: models.PaymentStatusCaptured, RefundedAmount: usd(2000)}, nil).Once()
+	mockRepo.On("AddRefund", ctx, isRefund).Return(true, nil)
+	mockRefundRepo.On("Create", ctx, isRefund).Return(nil)
+	mockRepo.On("FindByID", ctx, id).Return(&models.Payment{ID: id, Amount: usd(10000), Status: models.PaymentStatusCaptured, RefundedAmount: usd(5000)}, nil).Once()
+
+	result, err := service.RefundPayment(ctx, id.Hex(), &models.RefundRequest{Amount: "30.00", Reason: "damaged item"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.Decimal("50.00"), result.RefundedAmount)
+	assert.Equal(t, models.PaymentStatusCaptured, result.Status)
+	mockRepo.AssertExpectations(t)
+	mockRefundRepo.AssertExpectations(t)
+}
+
+func TestRefundPayment_ZeroAmountRefundsRemaining(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := adminContext()
+	id := primitive.NewObjectID()
+
+	mockRepo.On("FindByID", ctx, id).Return(&models.Payment{ID: id, Amount: usd(10000), Status: models.PaymentStatusCaptured, RefundedAmount: usd(4000)}, nil).Once()
+	mockRepo.On("AddRefund", ctx, mock.MatchedBy(func(refund *models.Refund) bool {
+		return refund.Amount == usd(6000)
+	})).Return(true, nil)
+	mockRepo.On("FindByID", ctx, id).Return(&models.Payment{ID: id, Amount: usd(10000), Status: models.PaymentStatusRefunded, RefundedAmount: usd(10000)}, nil).Once()
+
+	result, err := service.RefundPayment(ctx, id.Hex(), &models.RefundRequest{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.PaymentStatusRefunded, result.Status)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRefundPayment_LedgerFailureFailsRefund(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	mockRefundRepo := new(MockRefundRepository)
+	ledger := repository.NewRefundLedger(mockRepo, mockRefundRepo, repository.NewTransactor(nil, false))
+	service := NewPaymentService(ledger, mockRefundRepo, nil)
+
+	ctx := adminContext()
+	id := primitive.NewObjectID()
+
+	mockRepo.On("FindByID", ctx, id).Return(&models.Payment{ID: id, Amount: usd(10000), Status: models.PaymentStatusCaptured}, nil)
+	mockRepo.On("AddRefund", ctx, mock.AnythingOfType("*models.Refund")).Return(true, nil)
+	mockRefundRepo.On("Create", ctx, mock.AnythingOfType("*models.Refund")).Return(fmt.Errorf("failed to create refund: connection reset"))
+
+	result, err := service.RefundPayment(ctx, id.Hex(), &models.RefundRequest{Amount: "10.00"})
+
+	// In a transaction the refunded total is rolled back with the ledger
+	assert.Nil(t, result)
 	assert.Error(t, err)
+}
+
+func TestRefundPayment_ExceedsRemaining(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := adminContext()
+	id := primitive.NewObjectID()
+
+	mockRepo.On("FindByID", ctx, id).Return(&models.Payment{ID: id, Amount: usd(10000), Status: models.PaymentStatusCaptured, RefundedAmount: usd(9000)}, nil)
+
+	result, err := service.RefundPayment(ctx, id.Hex(), &models.RefundRequest{Amount: "20.00"})
+
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, ErrFailedPrecondition)
+	mockRepo.AssertNotCalled(t, "AddRefund", mock.Anything, mock.Anything)
+}
+
+func TestRefundPayment_CurrencyMismatch(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := adminContext()
+	id := primitive.NewObjectID()
+
+	mockRepo.On("FindByID", ctx, id).Return(&models.Payment{ID: id, Amount: usd(10000), Status: models.PaymentStatusCaptured}, nil)
+
+	result, err := service.RefundPayment(ctx, id.Hex(), &models.RefundRequest{Amount: "10.00", Currency: "EUR"})
+
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+	mockRepo.AssertNotCalled(t, "AddRefund", mock.Anything, mock.Anything)
+}
+
+func TestGetPaymentByID_LegacyPaymentIsPending(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := adminContext()
+	id := primitive.NewObjectID()
+
+	mockRepo.On("FindByID", ctx, id).Return(&models.Payment{ID: id, Amount: usd(1000)}, nil)
+
+	result, err := service.GetPaymentByID(ctx, id.Hex())
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.PaymentStatusPending, result.Status)
+}
+
+func TestCreatePayment_RecordsOwner(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := customerContext()
+	mockRepo.On("FindByIdempotencyKey", ctx, "user-1", "key-1").Return(nil, fmt.Errorf("payment %w", ErrNotFound))
+	mockRepo.On("Create", ctx, mock.MatchedBy(func(payment *models.Payment) bool {
+		return payment.OwnerID == "user-1"
+	})).Return(nil)
+
+	result, err := service.CreatePayment(ctx, &models.PaymentRequest{Amount: "10.00", IdempotencyKey: "key-1"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", result.OwnerID)
 	mockRepo.AssertExpectations(t)
 }
 
+func TestCreatePayment_RecordsTimestamps(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := customerContext()
+	mockRepo.On("Create", ctx, mock.MatchedBy(func(payment *models.Payment) bool {
+		return !payment.CreatedAt.IsZero() && payment.UpdatedAt.Equal(payment.CreatedAt)
+	})).Return(nil)
+
+	result, err := service.CreatePayment(ctx, &models.PaymentRequest{Amount: "10.00"})
+
+	assert.NoError(t, err)
+	assert.False(t, result.CreatedAt.IsZero())
+	assert.Equal(t, result.CreatedAt, result.UpdatedAt)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetPaymentByID_LegacyPaymentTimestampsFromID(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := adminContext()
+	id := primitive.NewObjectIDFromTimestamp(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	mockRepo.On("FindByID", ctx, id).Return(&models.Payment{ID: id, Amount: usd(100)}, nil)
+
+	result, err := service.GetPaymentByID(ctx, id.Hex())
+
+	assert.NoError(t, err)
+	assert.True(t, id.Timestamp().Equal(result.CreatedAt))
+	assert.True(t, id.Timestamp().Equal(result.UpdatedAt))
+}
+
+func TestCreatePayment_RequiresCaller(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	result, err := service.CreatePayment(context.Background(), &models.PaymentRequest{Amount: "10.00"})
+
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+	assert.Nil(t, result)
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestGetAllPayments_ScopedToCustomer(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := customerContext()
+	page := repository.PageOptions{Size: models.DefaultPageSize}
+	// A customer cannot widen the listing to another owner
+	mockRepo.On("Find", ctx, repository.PaymentFilter{OwnerID: "user-1"}, page).Return([]models.Payment{}, "", nil)
+
+	_, err := service.GetAllPayments(ctx, &models.PaymentListRequest{OwnerID: "user-2"})
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetAllPayments_AdminFiltersByOwner(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := adminContext()
+	page := repository.PageOptions{Size: models.DefaultPageSize}
+	mockRepo.On("Find", ctx, repository.PaymentFilter{OwnerID: "user-2"}, page).Return([]models.Payment{}, "", nil)
+
+	_, err := service.GetAllPayments(ctx, &models.PaymentListRequest{OwnerID: "user-2"})
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestGetPaymentByID_OtherOwnerIsNotFound(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := customerContext()
+	id := primitive.NewObjectID()
+	mockRepo.On("FindByID", ctx, id).Return(&models.Payment{ID: id, Amount: usd(1000), OwnerID: "user-2"}, nil)
+
+	result, err := service.GetPaymentByID(ctx, id.Hex())
+
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Nil(t, result)
+}
+
+func TestDeletePayment_OtherOwnerIsNotFound(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	ctx := customerContext()
+	id := primitive.NewObjectID()
+	mockRepo.On("FindByID", ctx, id).Return(&models.Payment{ID: id, Amount: usd(1000), OwnerID: "user-2"}, nil)
+
+	err := service.DeletePayment(ctx, id.Hex())
+
+	assert.ErrorIs(t, err, ErrNotFound)
+	mockRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+}
+
+func TestGetAllPayments_IncludeDeletedOnlyForAdmins(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	page := repository.PageOptions{Size: models.DefaultPageSize}
+	mockRepo.On("Find", mock.Anything, repository.PaymentFilter{IncludeDeleted: true}, page).Return([]models.Payment{}, "", nil).Once()
+	mockRepo.On("Find", mock.Anything, repository.PaymentFilter{OwnerID: "user-1"}, page).Return([]models.Payment{}, "", nil).Once()
+
+	_, err := service.GetAllPayments(adminContext(), &models.PaymentListRequest{IncludeDeleted: true})
+	assert.NoError(t, err)
+	_, err = service.GetAllPayments(customerContext(), &models.PaymentListRequest{IncludeDeleted: true})
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRestorePayment_Success(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	id := primitive.NewObjectID()
+	mockRepo.On("Restore", mock.Anything, id).Return(&models.Payment{ID: id, Amount: usd(1000), Status: models.PaymentStatusCaptured, OwnerID: "user-2"}, nil)
+
+	result, err := service.RestorePayment(adminContext(), id.Hex())
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.PaymentStatusCaptured, result.Status)
+	assert.Nil(t, result.DeletedAt)
+}
+
+func TestRestorePayment_NotDeleted(t *testing.T) {
+	mockRepo := new(MockPaymentRepository)
+	service := NewPaymentService(mockRepo, new(MockRefundRepository), nil)
+
+	id := primitive.NewObjectID()
+	mockRepo.On("Restore", mock.Anything, id).Return(nil, fmt.Errorf("deleted payment %w", ErrNotFound))
+	mockRepo.On("FindByID", mock.Anything, id).Return(&models.Payment{ID: id, Amount: usd(1000)}, nil)
+
+	result, err := service.RestorePayment(adminContext(), id.Hex())
+
+	assert.ErrorIs(t, err, ErrFailedPrecondition)
+	assert.Nil(t, result)
+}
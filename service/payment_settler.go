@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"log"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// paymentSettlerRetry is how long the PaymentSettler waits before watching
+// payments again after a watch ended.
+const paymentSettlerRetry = 5 * time.Second
+
+// PaymentSettler settles the orders awaiting their payment as the payments
+// change.
+type PaymentSettler interface {
+	// Start watches payments and settles the orders awaiting them until
+	// ctx is done, watching again whenever the watch ends.
+	Start(ctx context.Context)
+}
+
+type paymentSettler struct {
+	orders       OrderService
+	payments     PaymentService
+	authenticate func(ctx context.Context) (context.Context, error)
+	// resumeToken is the position after the last settled change
+	resumeToken string
+}
+
+// NewPaymentSettler creates a PaymentSettler. authenticate returns ctx with
+// credentials that can watch every payment, and is called every time the
+// watch starts. Changes made while nothing watched, such as before the
+// server started, are settled by OrderService.SettleOrders.
+func NewPaymentSettler(orders OrderService, payments PaymentService, authenticate func(ctx context.Context) (context.Context, error)) PaymentSettler {
+	return &paymentSettler{
+		orders:       orders,
+		payments:     payments,
+		authenticate: authenticate,
+	}
+}
+
+func (s *paymentSettler) Start(ctx context.Context) {
+	for {
+		if err := s.watch(ctx); err != nil {
+			log.Printf("Error watching payments to settle orders: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(paymentSettlerRetry):
+		}
+	}
+}
+
+// watch settles orders until the watch ends. It resumes after the last
+// settled change, so a change whose order could not be settled is seen
+// again by the next watch.
+func (s *paymentSettler) watch(ctx context.Context) error {
+	watchCtx, err := s.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.payments.WatchPayments(watchCtx, s.resumeToken, func(event *models.PaymentEventResponse) error {
+		if event.Payment != nil {
+			if err := s.orders.SettlePayment(ctx, event.Payment); err != nil {
+				return err
+			}
+		}
+		s.resumeToken = event.ResumeToken
+		return nil
+	})
+	if s.resumeToken != "" && status.Code(err) == codes.FailedPrecondition {
+		// The changes since the last one settled are gone, so the next
+		// watch starts from now and SettleOrders settles what was missed
+		s.resumeToken = ""
+	}
+	return err
+}
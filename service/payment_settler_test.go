@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPaymentSettler_FailedPaymentGivesStockBack(t *testing.T) {
+	orderRepo := new(MockOrderRepository)
+	productRepo := new(MockProductRepository)
+	paymentService := new(MockPaymentService)
+	settler := NewPaymentSettler(NewOrderService(orderRepo, productRepo, paymentService), paymentService, func(ctx context.Context) (context.Context, error) {
+		return ctx, nil
+	}).(*paymentSettler)
+
+	ctx := context.Background()
+	orderID := primitive.NewObjectID()
+	productID := primitive.NewObjectID()
+	order := &models.Order{
+		ID:        orderID,
+		Items:     []models.OrderItem{{ProductID: productID, Quantity: 2}},
+		Status:    models.OrderStatusAwaitingPayment,
+		PaymentID: "pay-1",
+	}
+
+	paymentService.On("WatchPayments", ctx, "", mock.Anything).Run(func(args mock.Arguments) {
+		send := args.Get(2).(func(*models.PaymentEventResponse) error)
+		send(&models.PaymentEventResponse{
+			Type:        models.PaymentEventUpdated,
+			PaymentID:   "pay-1",
+			Payment:     &models.PaymentResponse{ID: "pay-1", Status: models.PaymentStatusFailed},
+			ResumeToken: "token-1",
+		})
+	}).Return(nil)
+	orderRepo.On("FindByPaymentID", ctx, "pay-1").Return(order, nil)
+	productRepo.On("Release", ctx, productID, orderID).Return(nil)
+	orderRepo.On("UpdateStatus", ctx, orderID, models.OrderStatusAwaitingPayment, models.OrderStatusCancelled).Return(true, nil)
+
+	err := settler.watch(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.OrderStatusCancelled, order.Status)
+	assert.Equal(t, "token-1", settler.resumeToken)
+	productRepo.AssertExpectations(t)
+	orderRepo.AssertExpectations(t)
+}
+
+func TestPaymentSettler_WatchesFromNowWhenResumeTokenExpired(t *testing.T) {
+	paymentService := new(MockPaymentService)
+	settler := NewPaymentSettler(nil, paymentService, func(ctx context.Context) (context.Context, error) {
+		return ctx, nil
+	}).(*paymentSettler)
+	settler.resumeToken = "expired"
+
+	ctx := context.Background()
+	paymentService.On("WatchPayments", ctx, "expired", mock.Anything).Return(status.Error(codes.FailedPrecondition, "resume token expired"))
+
+	err := settler.watch(ctx)
+
+	assert.Error(t, err)
+	assert.Empty(t, settler.resumeToken)
+}
@@ -2,78 +2,132 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"p3-graded-challenge-2-ziancarlos/models"
 	"p3-graded-challenge-2-ziancarlos/repository"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type ProductService interface {
 	CreateProduct(ctx context.Context, req *models.ProductRequest) (*models.ProductResponse, error)
-	GetAllProducts(ctx context.Context) ([]models.ProductResponse, error)
+	GetAllProducts(ctx context.Context, req *models.ProductListRequest) (*models.ProductListResponse, error)
 	GetProductByID(ctx context.Context, id string) (*models.ProductResponse, error)
-	UpdateProduct(ctx context.Context, id string, req *models.ProductRequest) (*models.ProductResponse, error)
+	// UpdateProduct updates a product that is still at version. It fails
+	// with ErrVersionMismatch when the product was updated since.
+	UpdateProduct(ctx context.Context, id string, version int64, req *models.ProductRequest) (*models.ProductResponse, error)
+	// PatchProduct changes only the fields given in patch, with the same
+	// rules as CreateProduct. With a version, it fails with
+	// ErrVersionMismatch when the product is no longer at that version.
+	PatchProduct(ctx context.Context, id string, version *int64, patch *models.ProductPatch) (*models.ProductResponse, error)
+	// DeleteProduct hides a product until it is restored or purged.
 	DeleteProduct(ctx context.Context, id string) error
+	// RestoreProduct undeletes a product. It fails with
+	// ErrFailedPrecondition when the product is not deleted.
+	RestoreProduct(ctx context.Context, id string) (*models.ProductResponse, error)
+	// AdjustStock changes the stock of a product for a reason, on behalf of
+	// the caller, and records the adjustment.
+	AdjustStock(ctx context.Context, id string, req *models.StockAdjustmentRequest) (*models.ProductResponse, error)
+	GetStockAdjustments(ctx context.Context, id string, req *models.ListRequest) (*models.StockAdjustmentListResponse, error)
+	// WatchProducts calls send for every change to a product, starting
+	// after resumeToken or from now if it is empty, until ctx is done or
+	// send fails.
+	WatchProducts(ctx context.Context, resumeToken string, send func(*models.ProductEventResponse) error) error
 }
 
+// patchAttempts is how many times a patch without a version is applied to
+// the latest product before giving up on concurrent updates.
+const patchAttempts = 3
+
 type productService struct {
-	repo repository.ProductRepository
+	repo        repository.ProductRepository
+	adjustments repository.StockAdjustmentRepository
+	events      repository.ProductEventSource
 }
 
-func NewProductService(repo repository.ProductRepository) ProductService {
+func NewProductService(repo repository.ProductRepository, adjustments repository.StockAdjustmentRepository, events repository.ProductEventSource) ProductService {
 	return &productService{
-		repo: repo,
+		repo:        repo,
+		adjustments: adjustments,
+		events:      events,
 	}
 }
 
 func (s *productService) CreateProduct(ctx context.Context, req *models.ProductRequest) (*models.ProductResponse, error) {
 	if req.Name == "" {
-		return nil, fmt.Errorf("name is required")
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidArgument)
+	}
+	price, err := parsePositiveAmount("price", req.Price, req.Currency)
+	if err != nil {
+		return nil, err
 	}
-	if req.Price <= 0 {
-		return nil, fmt.Errorf("price must be greater than 0")
+	if req.Stock < 0 {
+		return nil, fmt.Errorf("%w: stock must not be negative", ErrInvalidArgument)
 	}
 
+	now := time.Now()
 	product := &models.Product{
-		Name:  req.Name,
-		Price: req.Price,
+		Name:      req.Name,
+		Price:     price,
+		Stock:     &req.Stock,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Version:   1,
 	}
 
-	err := s.repo.Create(ctx, product)
+	err = s.repo.Create(ctx, product)
 	if err != nil {
 		return nil, err
 	}
 
-	return &models.ProductResponse{
-		ID:    product.ID.Hex(),
-		Name:  product.Name,
-		Price: product.Price,
-	}, nil
+	return toProductResponse(product), nil
 }
 
-func (s *productService) GetAllProducts(ctx context.Context) ([]models.ProductResponse, error) {
-	products, err := s.repo.FindAll(ctx)
+func (s *productService) GetAllProducts(ctx context.Context, req *models.ProductListRequest) (*models.ProductListResponse, error) {
+	page, err := pageOptions(req.ListRequest)
 	if err != nil {
 		return nil, err
 	}
+	currency, minPrice, maxPrice, err := parseAmountRange("price", req.MinPrice, req.MaxPrice, req.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCreatedRange(req.CreatedAfter, req.CreatedBefore); err != nil {
+		return nil, err
+	}
 
-	var responses []models.ProductResponse
-	for _, product := range products {
-		responses = append(responses, models.ProductResponse{
-			ID:    product.ID.Hex(),
-			Name:  product.Name,
-			Price: product.Price,
-		})
+	// Only admins see deleted products, the others are not told they exist
+	caller, _ := callerFromContext(ctx)
+	products, next, err := s.repo.Find(ctx, repository.ProductFilter{
+		NamePrefix:     req.NamePrefix,
+		Currency:       currency,
+		MinPrice:       minPrice,
+		MaxPrice:       maxPrice,
+		CreatedAfter:   req.CreatedAfter,
+		CreatedBefore:  req.CreatedBefore,
+		IncludeDeleted: req.IncludeDeleted && caller.IsAdmin(),
+	}, page)
+	if err != nil {
+		return nil, listError(err)
 	}
 
-	return responses, nil
+	responses := make([]models.ProductResponse, 0, len(products))
+	for i := range products {
+		responses = append(responses, *toProductResponse(&products[i]))
+	}
+
+	return &models.ProductListResponse{
+		Products:      responses,
+		NextPageToken: next,
+	}, nil
 }
 
 func (s *productService) GetProductByID(ctx context.Context, id string) (*models.ProductResponse, error) {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, fmt.Errorf("invalid product ID: %w", err)
+		return nil, fmt.Errorf("%w: invalid product ID: %v", ErrInvalidArgument, err)
 	}
 
 	product, err := s.repo.FindByID(ctx, objectID)
@@ -81,49 +135,249 @@ func (s *productService) GetProductByID(ctx context.Context, id string) (*models
 		return nil, err
 	}
 
-	return &models.ProductResponse{
-		ID:    product.ID.Hex(),
-		Name:  product.Name,
-		Price: product.Price,
-	}, nil
+	return toProductResponse(product), nil
 }
 
-func (s *productService) UpdateProduct(ctx context.Context, id string, req *models.ProductRequest) (*models.ProductResponse, error) {
+func (s *productService) UpdateProduct(ctx context.Context, id string, version int64, req *models.ProductRequest) (*models.ProductResponse, error) {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, fmt.Errorf("invalid product ID: %w", err)
+		return nil, fmt.Errorf("%w: invalid product ID: %v", ErrInvalidArgument, err)
 	}
 
 	if req.Name == "" {
-		return nil, fmt.Errorf("name is required")
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidArgument)
 	}
-	if req.Price <= 0 {
-		return nil, fmt.Errorf("price must be greater than 0")
+	price, err := parsePositiveAmount("price", req.Price, req.Currency)
+	if err != nil {
+		return nil, err
 	}
 
 	product := &models.Product{
-		Name:  req.Name,
-		Price: req.Price,
+		Name:      req.Name,
+		Price:     price,
+		UpdatedAt: time.Now(),
 	}
 
-	err = s.repo.Update(ctx, objectID, product)
+	err = s.repo.Update(ctx, objectID, product, version)
 	if err != nil {
 		return nil, err
 	}
 
-	return &models.ProductResponse{
-		ID:    id,
-		Name:  product.Name,
-		Price: product.Price,
-	}, nil
+	return toProductResponse(product), nil
+}
+
+func (s *productService) PatchProduct(ctx context.Context, id string, version *int64, patch *models.ProductPatch) (*models.ProductResponse, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid product ID: %v", ErrInvalidArgument, err)
+	}
+	if patch.Name != nil && *patch.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidArgument)
+	}
+
+	for attempt := 1; ; attempt++ {
+		product, err := s.repo.FindByID(ctx, objectID)
+		if err != nil {
+			return nil, err
+		}
+		if version != nil && product.Version != *version {
+			return nil, fmt.Errorf("product is at version %d: %w", product.Version, ErrVersionMismatch)
+		}
+
+		changes, err := productChanges(product, patch)
+		if err != nil {
+			return nil, err
+		}
+		if changes.Name == nil && changes.Price == nil {
+			return toProductResponse(product), nil
+		}
+
+		// The price is parsed in the currency just read, so the patch only
+		// applies to the version it was read at
+		patched, err := s.repo.Patch(ctx, objectID, changes, product.Version)
+		if errors.Is(err, ErrVersionMismatch) && version == nil && attempt < patchAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return toProductResponse(patched), nil
+	}
+}
+
+// productChanges validates patch against product and returns the fields it
+// changes.
+func productChanges(product *models.Product, patch *models.ProductPatch) (repository.ProductChanges, error) {
+	changes := repository.ProductChanges{
+		Name:      patch.Name,
+		UpdatedAt: time.Now(),
+	}
+	if patch.Price != nil || patch.Currency != nil {
+		amount, currency := product.Price.Decimal(), product.Price.Currency
+		if patch.Price != nil {
+			amount = *patch.Price
+		}
+		if patch.Currency != nil {
+			currency = *patch.Currency
+		}
+		price, err := parsePositiveAmount("price", amount, currency)
+		if err != nil {
+			return repository.ProductChanges{}, err
+		}
+		changes.Price = &price
+	}
+	return changes, nil
 }
 
 func (s *productService) DeleteProduct(ctx context.Context, id string) error {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return fmt.Errorf("invalid product ID: %w", err)
+		return fmt.Errorf("%w: invalid product ID: %v", ErrInvalidArgument, err)
 	}
 
 	return s.repo.Delete(ctx, objectID)
 }
 
+func (s *productService) RestoreProduct(ctx context.Context, id string) (*models.ProductResponse, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid product ID: %v", ErrInvalidArgument, err)
+	}
+
+	product, err := s.repo.Restore(ctx, objectID)
+	if errors.Is(err, ErrNotFound) {
+		if _, findErr := s.repo.FindByID(ctx, objectID); findErr == nil {
+			return nil, fmt.Errorf("%w: product is not deleted", ErrFailedPrecondition)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return toProductResponse(product), nil
+}
+
+func (s *productService) AdjustStock(ctx context.Context, id string, req *models.StockAdjustmentRequest) (*models.ProductResponse, error) {
+	caller, err := callerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid product ID: %v", ErrInvalidArgument, err)
+	}
+	if req.Delta == 0 {
+		return nil, fmt.Errorf("%w: delta must not be 0", ErrInvalidArgument)
+	}
+	if !req.Reason.Valid() {
+		return nil, fmt.Errorf("%w: unknown reason %q", ErrInvalidArgument, req.Reason)
+	}
+
+	product, err := s.repo.AdjustStock(ctx, &models.StockAdjustment{
+		ProductID:  objectID,
+		Delta:      req.Delta,
+		Reason:     req.Reason,
+		Note:       req.Note,
+		AdjustedBy: caller.UserID,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrInsufficientStock) {
+			return nil, fmt.Errorf("%w: stock cannot drop below the reserved quantity", ErrFailedPrecondition)
+		}
+		return nil, err
+	}
+
+	return toProductResponse(product), nil
+}
+
+func (s *productService) GetStockAdjustments(ctx context.Context, id string, req *models.ListRequest) (*models.StockAdjustmentListResponse, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid product ID: %v", ErrInvalidArgument, err)
+	}
+	if _, err := s.repo.FindByID(ctx, objectID); err != nil {
+		return nil, err
+	}
+
+	page, err := pageOptions(*req)
+	if err != nil {
+		return nil, err
+	}
+	if page.Sort == "" {
+		page.Sort = "-created_at"
+	}
+
+	adjustments, next, err := s.adjustments.Find(ctx, objectID, page)
+	if err != nil {
+		return nil, listError(err)
+	}
+
+	responses := make([]models.StockAdjustmentResponse, 0, len(adjustments))
+	for i := range adjustments {
+		responses = append(responses, *toStockAdjustmentResponse(&adjustments[i]))
+	}
+
+	return &models.StockAdjustmentListResponse{
+		Adjustments:   responses,
+		NextPageToken: next,
+	}, nil
+}
+
+func toStockAdjustmentResponse(adjustment *models.StockAdjustment) *models.StockAdjustmentResponse {
+	return &models.StockAdjustmentResponse{
+		ID:         adjustment.ID.Hex(),
+		ProductID:  adjustment.ProductID.Hex(),
+		Delta:      adjustment.Delta,
+		Reason:     adjustment.Reason,
+		Note:       adjustment.Note,
+		StockAfter: adjustment.StockAfter,
+		AdjustedBy: adjustment.AdjustedBy,
+		CreatedAt:  adjustment.CreatedAt,
+	}
+}
+
+func toProductResponse(product *models.Product) *models.ProductResponse {
+	createdAt, updatedAt := recordedTimes(product.ID, product.CreatedAt, product.UpdatedAt)
+	return &models.ProductResponse{
+		ID:        product.ID.Hex(),
+		Name:      product.Name,
+		Price:     product.Price.Decimal(),
+		Currency:  product.Price.Currency,
+		CreatedAt: createdAt,
+		UpdatedAt: updatedAt,
+		Stock:     product.Stock,
+		Reserved:  product.Reserved,
+		Available: product.Available(),
+		Version:   product.Version,
+		DeletedAt: product.DeletedAt,
+	}
+}
+
+// recordedTimes returns when a document was created and last updated. Those
+// stored before the times were recorded were created at the time in their
+// ID and count as unchanged since.
+func recordedTimes(id primitive.ObjectID, createdAt, updatedAt time.Time) (time.Time, time.Time) {
+	if createdAt.IsZero() {
+		createdAt = id.Timestamp()
+	}
+	if updatedAt.IsZero() {
+		updatedAt = createdAt
+	}
+	return createdAt, updatedAt
+}
+
+func (s *productService) WatchProducts(ctx context.Context, resumeToken string, send func(*models.ProductEventResponse) error) error {
+	err := s.events.Watch(ctx, resumeToken, func(event models.ProductEvent) error {
+		response := &models.ProductEventResponse{
+			Type:        event.Type,
+			ProductID:   event.ProductID.Hex(),
+			ResumeToken: event.ResumeToken,
+		}
+		if event.Product != nil {
+			response.Product = toProductResponse(event.Product)
+		}
+		return send(response)
+	})
+	return watchError(ctx, err)
+}
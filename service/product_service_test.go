@@ -0,0 +1,335 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MockStockAdjustmentRepository is a mock implementation of
+// StockAdjustmentRepository
+type MockStockAdjustmentRepository struct {
+	mock.Mock
+}
+
+func (m *MockStockAdjustmentRepository) Create(ctx context.Context, adjustment *models.StockAdjustment) error {
+	args := m.Called(ctx, adjustment)
+	return args.Error(0)
+}
+
+func (m *MockStockAdjustmentRepository) Find(ctx context.Context, productID primitive.ObjectID, page repository.PageOptions) ([]models.StockAdjustment, string, error) {
+	args := m.Called(ctx, productID, page)
+	return args.Get(0).([]models.StockAdjustment), args.String(1), args.Error(2)
+}
+
+func TestWatchProducts_PublishesChanges(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	repo, events := repository.NewProductBroadcaster(mockRepo)
+	service := NewProductService(repo, new(MockStockAdjustmentRepository), events)
+
+	ctx := context.Background()
+	id := primitive.NewObjectID()
+	product := &models.Product{ID: id, Name: "Keyboard", Price: usd(5000)}
+	mockRepo.On("FindByID", mock.Anything, id).Return(product, nil)
+	mockRepo.On("Update", mock.Anything, id, mock.AnythingOfType("*models.Product"), mock.Anything).Return(nil)
+	mockRepo.On("Delete", mock.Anything, id).Return(nil)
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	received := make(chan *models.ProductEventResponse, 2)
+	go func() {
+		_ = service.WatchProducts(watchCtx, "", func(event *models.ProductEventResponse) error {
+			received <- event
+			return nil
+		})
+	}()
+
+	// Keep updating until the watcher has subscribed and seen an update
+	var updated *models.ProductEventResponse
+	for updated == nil {
+		_, err := service.UpdateProduct(ctx, id.Hex(), 1, &models.ProductRequest{Name: "Keyboard", Price: "50.00"})
+		assert.NoError(t, err)
+		select {
+		case updated = <-received:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	assert.Equal(t, models.ProductEventUpdated, updated.Type)
+
+	// Drain updates published while waiting, then delete
+	time.Sleep(10 * time.Millisecond)
+	for len(received) > 0 {
+		<-received
+	}
+	assert.NoError(t, service.DeleteProduct(ctx, id.Hex()))
+
+	deleted := <-received
+	assert.Equal(t, models.ProductEventDeleted, deleted.Type)
+	// Deletion events carry the product as it was
+	assert.Equal(t, "Keyboard", deleted.Product.Name)
+}
+
+func TestCreateProduct_InitialStock(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	service := NewProductService(mockRepo, new(MockStockAdjustmentRepository), nil)
+
+	mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Product")).Return(nil)
+
+	result, err := service.CreateProduct(adminContext(), &models.ProductRequest{Name: "Keyboard", Price: "50.00", Stock: 10})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), *result.Stock)
+	assert.Equal(t, int64(10), *result.Available)
+
+	result, err = service.CreateProduct(adminContext(), &models.ProductRequest{Name: "Keyboard", Price: "50.00", Stock: -1})
+
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+	assert.Nil(t, result)
+	mockRepo.AssertNumberOfCalls(t, "Create", 1)
+}
+
+func TestCreateProduct_Validation(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	service := NewProductService(mockRepo, new(MockStockAdjustmentRepository), nil)
+
+	tests := map[string]*models.ProductRequest{
+		"missing name": {Price: "50.00", Stock: 10},
+		"zero price":   {Name: "Keyboard", Price: "0", Stock: 10},
+	}
+	for name, req := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := service.CreateProduct(adminContext(), req)
+
+			assert.ErrorIs(t, err, ErrInvalidArgument)
+			assert.Nil(t, result)
+		})
+	}
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestAdjustStock_RecordsCallerAndReason(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	service := NewProductService(mockRepo, new(MockStockAdjustmentRepository), nil)
+
+	id := primitive.NewObjectID()
+	stock := int64(30)
+	mockRepo.On("AdjustStock", mock.Anything, mock.MatchedBy(func(adjustment *models.StockAdjustment) bool {
+		return adjustment.ProductID == id && adjustment.Delta == 25 && adjustment.Reason == models.StockReasonRestock && adjustment.AdjustedBy == "admin-1"
+	})).Return(&models.Product{ID: id, Name: "Keyboard", Price: usd(5000), Stock: &stock, Reserved: 4}, nil)
+
+	result, err := service.AdjustStock(adminContext(), id.Hex(), &models.StockAdjustmentRequest{Delta: 25, Reason: models.StockReasonRestock})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(30), *result.Stock)
+	assert.Equal(t, int64(4), result.Reserved)
+	assert.Equal(t, int64(26), *result.Available)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestAdjustStock_Validation(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	service := NewProductService(mockRepo, new(MockStockAdjustmentRepository), nil)
+
+	id := primitive.NewObjectID().Hex()
+	tests := map[string]*models.StockAdjustmentRequest{
+		"zero delta":     {Delta: 0, Reason: models.StockReasonRestock},
+		"missing reason": {Delta: 5},
+		"unknown reason": {Delta: 5, Reason: "gift"},
+	}
+	for name, req := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := service.AdjustStock(adminContext(), id, req)
+
+			assert.ErrorIs(t, err, ErrInvalidArgument)
+			assert.Nil(t, result)
+		})
+	}
+	mockRepo.AssertNotCalled(t, "AdjustStock", mock.Anything, mock.Anything)
+}
+
+func TestAdjustStock_BelowReserved(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	service := NewProductService(mockRepo, new(MockStockAdjustmentRepository), nil)
+
+	id := primitive.NewObjectID()
+	mockRepo.On("AdjustStock", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("product %w", repository.ErrInsufficientStock))
+
+	result, err := service.AdjustStock(adminContext(), id.Hex(), &models.StockAdjustmentRequest{Delta: -10, Reason: models.StockReasonDamaged})
+
+	assert.ErrorIs(t, err, ErrFailedPrecondition)
+	assert.Nil(t, result)
+}
+
+func TestUpdateProduct_NextVersion(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	service := NewProductService(mockRepo, new(MockStockAdjustmentRepository), nil)
+
+	id := primitive.NewObjectID()
+	mockRepo.On("Update", mock.Anything, id, mock.AnythingOfType("*models.Product"), int64(3)).Return(nil)
+
+	result, err := service.UpdateProduct(adminContext(), id.Hex(), 3, &models.ProductRequest{Name: "Keyboard", Price: "55.00"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), result.Version)
+	assert.Equal(t, models.Decimal("55.00"), result.Price)
+}
+
+func TestUpdateProduct_VersionMismatch(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	service := NewProductService(mockRepo, new(MockStockAdjustmentRepository), nil)
+
+	id := primitive.NewObjectID()
+	mockRepo.On("Update", mock.Anything, id, mock.AnythingOfType("*models.Product"), int64(3)).Return(fmt.Errorf("product is at version 4: %w", repository.ErrVersionMismatch))
+
+	result, err := service.UpdateProduct(adminContext(), id.Hex(), 3, &models.ProductRequest{Name: "Keyboard", Price: "55.00"})
+
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+	assert.Nil(t, result)
+}
+
+func TestPatchProduct_PriceKeepsCurrency(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	service := NewProductService(mockRepo, new(MockStockAdjustmentRepository), nil)
+
+	id := primitive.NewObjectID()
+	eur := models.Money{Units: 1000, Currency: "EUR"}
+	mockRepo.On("FindByID", mock.Anything, id).Return(&models.Product{ID: id, Name: "Keyboard", Price: eur, Version: 2}, nil)
+	mockRepo.On("Patch", mock.Anything, id, mock.MatchedBy(func(changes repository.ProductChanges) bool {
+		return changes.Name == nil && *changes.Price == models.Money{Units: 1250, Currency: "EUR"}
+	}), int64(2)).Return(&models.Product{ID: id, Name: "Keyboard", Price: models.Money{Units: 1250, Currency: "EUR"}, Version: 3}, nil)
+
+	price := models.Decimal("12.50")
+	result, err := service.PatchProduct(adminContext(), id.Hex(), nil, &models.ProductPatch{Price: &price})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Keyboard", result.Name)
+	assert.Equal(t, models.Decimal("12.50"), result.Price)
+	assert.Equal(t, "EUR", result.Currency)
+	assert.Equal(t, int64(3), result.Version)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestPatchProduct_Validation(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	service := NewProductService(mockRepo, new(MockStockAdjustmentRepository), nil)
+
+	id := primitive.NewObjectID()
+	mockRepo.On("FindByID", mock.Anything, id).Return(&models.Product{ID: id, Name: "Keyboard", Price: usd(1000)}, nil)
+
+	empty, zero, yen := "", models.Decimal("0"), "JPY"
+	tests := map[string]*models.ProductPatch{
+		"empty name":                     {Name: &empty},
+		"zero price":                     {Price: &zero},
+		"cents in zero-decimal currency": {Currency: &yen},
+	}
+	for name, patch := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := service.PatchProduct(adminContext(), id.Hex(), nil, patch)
+
+			assert.ErrorIs(t, err, ErrInvalidArgument)
+			assert.Nil(t, result)
+		})
+	}
+	mockRepo.AssertNotCalled(t, "Patch", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestPatchProduct_RetriesConcurrentUpdateWithoutVersion(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	service := NewProductService(mockRepo, new(MockStockAdjustmentRepository), nil)
+
+	id := primitive.NewObjectID()
+	mockRepo.On("FindByID", mock.Anything, id).Return(&models.Product{ID: id, Name: "Keyboard", Price: usd(1000), Version: 4}, nil).Once()
+	mockRepo.On("Patch", mock.Anything, id, mock.Anything, int64(4)).Return(nil, fmt.Errorf("product is at version 5: %w", repository.ErrVersionMismatch)).Once()
+	mockRepo.On("FindByID", mock.Anything, id).Return(&models.Product{ID: id, Name: "Keyboard", Price: usd(1000), Version: 5}, nil).Once()
+	mockRepo.On("Patch", mock.Anything, id, mock.Anything, int64(5)).Return(&models.Product{ID: id, Name: "Keyboard", Price: usd(1100), Version: 6}, nil).Once()
+
+	price := models.Decimal("11.00")
+	result, err := service.PatchProduct(adminContext(), id.Hex(), nil, &models.ProductPatch{Price: &price})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), result.Version)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestPatchProduct_StaleVersion(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	service := NewProductService(mockRepo, new(MockStockAdjustmentRepository), nil)
+
+	id := primitive.NewObjectID()
+	mockRepo.On("FindByID", mock.Anything, id).Return(&models.Product{ID: id, Name: "Keyboard", Price: usd(1000), Version: 5}, nil)
+
+	name := "Mechanical keyboard"
+	version := int64(4)
+	result, err := service.PatchProduct(adminContext(), id.Hex(), &version, &models.ProductPatch{Name: &name})
+
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+	assert.Nil(t, result)
+	mockRepo.AssertNotCalled(t, "Patch", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGetAllProducts_IncludeDeletedOnlyForAdmins(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	service := NewProductService(mockRepo, new(MockStockAdjustmentRepository), nil)
+
+	page := repository.PageOptions{Size: models.DefaultPageSize}
+	mockRepo.On("Find", mock.Anything, repository.ProductFilter{IncludeDeleted: true}, page).Return([]models.Product{}, "", nil).Once()
+	mockRepo.On("Find", mock.Anything, repository.ProductFilter{}, page).Return([]models.Product{}, "", nil).Twice()
+
+	req := &models.ProductListRequest{IncludeDeleted: true}
+	for _, ctx := range []context.Context{adminContext(), customerContext(), context.Background()} {
+		_, err := service.GetAllProducts(ctx, req)
+		assert.NoError(t, err)
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRestoreProduct_Success(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	service := NewProductService(mockRepo, new(MockStockAdjustmentRepository), nil)
+
+	id := primitive.NewObjectID()
+	mockRepo.On("Restore", mock.Anything, id).Return(&models.Product{ID: id, Name: "Keyboard", Price: usd(5000), Version: 3}, nil)
+
+	result, err := service.RestoreProduct(adminContext(), id.Hex())
+
+	assert.NoError(t, err)
+	assert.Equal(t, id.Hex(), result.ID)
+	assert.Nil(t, result.DeletedAt)
+}
+
+func TestRestoreProduct_NotDeleted(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	service := NewProductService(mockRepo, new(MockStockAdjustmentRepository), nil)
+
+	id, missing := primitive.NewObjectID(), primitive.NewObjectID()
+	mockRepo.On("Restore", mock.Anything, id).Return(nil, fmt.Errorf("deleted product %w", ErrNotFound))
+	mockRepo.On("FindByID", mock.Anything, id).Return(&models.Product{ID: id, Name: "Keyboard", Price: usd(5000)}, nil)
+	mockRepo.On("Restore", mock.Anything, missing).Return(nil, fmt.Errorf("deleted product %w", ErrNotFound))
+	mockRepo.On("FindByID", mock.Anything, missing).Return(nil, fmt.Errorf("product %w", ErrNotFound))
+
+	result, err := service.RestoreProduct(adminContext(), id.Hex())
+	assert.ErrorIs(t, err, ErrFailedPrecondition)
+	assert.Nil(t, result)
+
+	result, err = service.RestoreProduct(adminContext(), missing.Hex())
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Nil(t, result)
+}
+
+func TestRestoreProduct_InvalidID(t *testing.T) {
+	mockRepo := new(MockProductRepository)
+	service := NewProductService(mockRepo, new(MockStockAdjustmentRepository), nil)
+
+	result, err := service.RestoreProduct(adminContext(), "invalid")
+
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+	assert.Nil(t, result)
+	mockRepo.AssertNotCalled(t, "Restore", mock.Anything, mock.Anything)
+}
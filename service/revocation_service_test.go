@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MockRevocationRepository is a mock implementation of RevocationRepository
+type MockRevocationRepository struct {
+	mock.Mock
+}
+
+func (m *MockRevocationRepository) Create(ctx context.Context, revocation *models.TokenRevocation) error {
+	args := m.Called(ctx, revocation)
+	if args.Get(0) == nil {
+		revocation.ID = primitive.NewObjectID()
+		return nil
+	}
+	return args.Error(0)
+}
+
+func (m *MockRevocationRepository) FindActive(ctx context.Context) ([]models.TokenRevocation, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.TokenRevocation), args.Error(1)
+}
+
+func TestRevoke_TokenTakesEffectImmediately(t *testing.T) {
+	repo := new(MockRevocationRepository)
+	list := NewRevocationList(repo)
+	service := NewRevocationService(repo, new(MockRefreshTokenRepository), list)
+
+	ctx := adminContext()
+	repo.On("Create", ctx, mock.MatchedBy(func(revocation *models.TokenRevocation) bool {
+		return revocation.JTI == "jti-1" && revocation.RevokedBy == "admin-1"
+	})).Return(nil)
+
+	result, err := service.Revoke(ctx, &models.RevocationRequest{JTI: "jti-1", Reason: "leaked"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "jti-1", result.JTI)
+	assert.True(t, list.IsRevoked("jti-1", "user-1", time.Now()))
+	assert.False(t, list.IsRevoked("jti-2", "user-1", time.Now()))
+	repo.AssertExpectations(t)
+}
+
+func TestRevoke_UserEndsEverySession(t *testing.T) {
+	repo := new(MockRevocationRepository)
+	refreshTokens := new(MockRefreshTokenRepository)
+	list := NewRevocationList(repo)
+	service := NewRevocationService(repo, refreshTokens, list)
+
+	ctx := adminContext()
+	userID := primitive.NewObjectID()
+	refreshTokens.On("RevokeUser", ctx, userID).Return(nil)
+	repo.On("Create", ctx, mock.AnythingOfType("*models.TokenRevocation")).Return(nil)
+
+	issuedBefore := time.Now().Add(-time.Minute)
+	_, err := service.Revoke(ctx, &models.RevocationRequest{UserID: userID.Hex()})
+
+	assert.NoError(t, err)
+	assert.True(t, list.IsRevoked("any", userID.Hex(), issuedBefore))
+	// Tokens from a later login stay valid
+	assert.False(t, list.IsRevoked("any", userID.Hex(), time.Now().Add(time.Minute)))
+	refreshTokens.AssertExpectations(t)
+}
+
+func TestRevoke_RequiresExactlyOneTarget(t *testing.T) {
+	repo := new(MockRevocationRepository)
+	service := NewRevocationService(repo, new(MockRefreshTokenRepository), NewRevocationList(repo))
+
+	for _, req := range []*models.RevocationRequest{
+		{},
+		{JTI: "jti-1", UserID: primitive.NewObjectID().Hex()},
+	} {
+		result, err := service.Revoke(adminContext(), req)
+		assert.ErrorIs(t, err, ErrInvalidArgument)
+		assert.Nil(t, result)
+	}
+	repo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestRevocationList_SyncLoadsAndExpires(t *testing.T) {
+	repo := new(MockRevocationRepository)
+	list := NewRevocationList(repo)
+
+	ctx := context.Background()
+	list.Add(models.TokenRevocation{JTI: "expired", ExpiresAt: time.Now().Add(-time.Second)})
+	repo.On("FindActive", ctx).Return([]models.TokenRevocation{
+		{JTI: "jti-1", ExpiresAt: time.Now().Add(time.Minute)},
+	}, nil)
+
+	err := list.Sync(ctx)
+
+	assert.NoError(t, err)
+	assert.True(t, list.IsRevoked("jti-1", "", time.Now()))
+	assert.False(t, list.IsRevoked("expired", "", time.Now()))
+}
@@ -0,0 +1,277 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/repository"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Mock repositories
+type MockWebhookRepository struct {
+	mock.Mock
+}
+
+func (m *MockWebhookRepository) Create(ctx context.Context, webhook *models.Webhook) error {
+	args := m.Called(ctx, webhook)
+	if args.Error(0) == nil {
+		webhook.ID = primitive.NewObjectID()
+	}
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) FindAll(ctx context.Context) ([]models.Webhook, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]models.Webhook), args.Error(1)
+}
+
+func (m *MockWebhookRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Webhook, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Webhook), args.Error(1)
+}
+
+func (m *MockWebhookRepository) FindSubscribed(ctx context.Context, eventType models.WebhookEventType) ([]models.Webhook, error) {
+	args := m.Called(ctx, eventType)
+	return args.Get(0).([]models.Webhook), args.Error(1)
+}
+
+func (m *MockWebhookRepository) Update(ctx context.Context, id primitive.ObjectID, webhook *models.Webhook) error {
+	args := m.Called(ctx, id, webhook)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+type MockWebhookDeliveryRepository struct {
+	mock.Mock
+}
+
+func (m *MockWebhookDeliveryRepository) CreateMany(ctx context.Context, deliveries []models.WebhookDelivery) error {
+	args := m.Called(ctx, deliveries)
+	return args.Error(0)
+}
+
+func (m *MockWebhookDeliveryRepository) ClaimDue(ctx context.Context, lease time.Duration) (*models.WebhookDelivery, error) {
+	args := m.Called(ctx, lease)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockWebhookDeliveryRepository) RecordAttempt(ctx context.Context, delivery *models.WebhookDelivery) error {
+	args := m.Called(ctx, delivery)
+	return args.Error(0)
+}
+
+func (m *MockWebhookDeliveryRepository) Find(ctx context.Context, webhookID primitive.ObjectID, status models.WebhookDeliveryStatus, page repository.PageOptions) ([]models.WebhookDelivery, string, error) {
+	args := m.Called(ctx, webhookID, status, page)
+	return args.Get(0).([]models.WebhookDelivery), args.String(1), args.Error(2)
+}
+
+func (m *MockWebhookDeliveryRepository) FindByID(ctx context.Context, webhookID, id primitive.ObjectID) (*models.WebhookDelivery, error) {
+	args := m.Called(ctx, webhookID, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockWebhookDeliveryRepository) Retry(ctx context.Context, webhookID, id primitive.ObjectID) (bool, error) {
+	args := m.Called(ctx, webhookID, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockWebhookDeliveryRepository) DeleteByWebhook(ctx context.Context, webhookID primitive.ObjectID) error {
+	args := m.Called(ctx, webhookID)
+	return args.Error(0)
+}
+
+var errNothingToDo = fmt.Errorf("nothing to do: %w", ErrNotFound)
+
+// dispatchOnce runs a dispatcher whose deliveries repository hands out
+// delivery once. It returns the delivery as recorded after its attempt.
+func dispatchOnce(t *testing.T, webhook *models.Webhook, delivery *models.WebhookDelivery) *models.WebhookDelivery {
+	mockWebhooks := new(MockWebhookRepository)
+	mockDeliveries := new(MockWebhookDeliveryRepository)
+	dispatcher := NewWebhookDispatcher(mockWebhooks, mockDeliveries, &http.Client{})
+
+	mockWebhooks.On("FindByID", mock.Anything, webhook.ID).Return(webhook, nil)
+	mockDeliveries.On("ClaimDue", mock.Anything, mock.Anything).Return(delivery, nil).Once()
+	mockDeliveries.On("ClaimDue", mock.Anything, mock.Anything).Return(nil, errNothingToDo)
+
+	var recorded *models.WebhookDelivery
+	mockDeliveries.On("RecordAttempt", mock.Anything, mock.AnythingOfType("*models.WebhookDelivery")).
+		Run(func(args mock.Arguments) { recorded = args.Get(1).(*models.WebhookDelivery) }).
+		Return(nil)
+
+	assert.NoError(t, dispatcher.Dispatch(context.Background()))
+	mockDeliveries.AssertNumberOfCalls(t, "RecordAttempt", 1)
+	return recorded
+}
+
+func TestWebhookPublisher_QueuesDeliveryPerSubscribedWebhook(t *testing.T) {
+	mockWebhooks := new(MockWebhookRepository)
+	mockDeliveries := new(MockWebhookDeliveryRepository)
+	publisher := NewWebhookPublisher(mockWebhooks, mockDeliveries)
+
+	payment := &models.Payment{ID: primitive.NewObjectID(), Amount: usd(1050), Status: models.PaymentStatusPending, OwnerID: "user-1"}
+	entry := &models.OutboxEntry{ID: primitive.NewObjectID(), Type: models.PaymentEventCreated, PaymentID: payment.ID, Payment: payment}
+	webhooks := []models.Webhook{{ID: primitive.NewObjectID(), Active: true}, {ID: primitive.NewObjectID(), Active: true}}
+
+	mockWebhooks.On("FindSubscribed", mock.Anything, models.WebhookEventPaymentCreated).Return(webhooks, nil)
+	mockDeliveries.On("CreateMany", mock.Anything, mock.Anything).Return(nil)
+
+	err := publisher.Publish(context.Background(), entry)
+
+	assert.NoError(t, err)
+	deliveries := mockDeliveries.Calls[0].Arguments.Get(1).([]models.WebhookDelivery)
+	assert.Len(t, deliveries, 2)
+	for i, delivery := range deliveries {
+		assert.Equal(t, webhooks[i].ID, delivery.WebhookID)
+		assert.Equal(t, entry.ID, delivery.EventID)
+		assert.Equal(t, models.WebhookDeliveryPending, delivery.Status)
+
+		var payload models.PaymentEventMessage
+		assert.NoError(t, json.Unmarshal([]byte(delivery.Payload), &payload))
+		assert.Equal(t, entry.ID.Hex(), payload.ID)
+		assert.Equal(t, models.WebhookEventPaymentCreated, payload.Type)
+		assert.Equal(t, models.Decimal("10.50"), payload.Payment.Amount)
+	}
+}
+
+func TestDispatch_DeliversSignedPayload(t *testing.T) {
+	webhook := &models.Webhook{ID: primitive.NewObjectID(), Secret: "s3cret", Active: true}
+	delivery := &models.WebhookDelivery{
+		ID:        primitive.NewObjectID(),
+		WebhookID: webhook.ID,
+		EventID:   primitive.NewObjectID(),
+		EventType: models.WebhookEventPaymentDeleted,
+		Payload:   `{"id":"1","type":"payment.deleted"}`,
+		Status:    models.WebhookDeliveryPending,
+	}
+
+	received := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(WebhookTimestampHeader), 10, 64)
+		assert.Equal(t, SignWebhookPayload("s3cret", timestamp, body), r.Header.Get(WebhookSignatureHeader))
+		assert.Equal(t, delivery.Payload, string(body))
+		received <- r
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	webhook.URL = server.URL
+
+	recorded := dispatchOnce(t, webhook, delivery)
+
+	r := <-received
+	assert.Equal(t, delivery.EventID.Hex(), r.Header.Get(WebhookIDHeader))
+	assert.Equal(t, "payment.deleted", r.Header.Get(WebhookEventHeader))
+	assert.Equal(t, models.WebhookDeliveryDelivered, recorded.Status)
+	assert.Equal(t, 1, recorded.Attempts)
+	assert.Equal(t, http.StatusNoContent, recorded.LastStatusCode)
+	assert.NotNil(t, recorded.DeliveredAt)
+}
+
+func TestDispatch_RetriesWithBackoff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	webhook := &models.Webhook{ID: primitive.NewObjectID(), URL: server.URL, Active: true}
+
+	for attempts, backoff := range []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute} {
+		delivery := &models.WebhookDelivery{ID: primitive.NewObjectID(), WebhookID: webhook.ID, Status: models.WebhookDeliveryPending, Attempts: attempts}
+
+		before := time.Now()
+		recorded := dispatchOnce(t, webhook, delivery)
+
+		assert.Equal(t, models.WebhookDeliveryPending, recorded.Status)
+		assert.Equal(t, attempts+1, recorded.Attempts)
+		assert.Equal(t, http.StatusInternalServerError, recorded.LastStatusCode)
+		assert.WithinDuration(t, before.Add(backoff), recorded.NextAttemptAt, time.Second)
+	}
+}
+
+func TestDispatch_DeadLettersAfterMaxAttempts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	webhook := &models.Webhook{ID: primitive.NewObjectID(), URL: server.URL, Active: true}
+	delivery := &models.WebhookDelivery{ID: primitive.NewObjectID(), WebhookID: webhook.ID, Status: models.WebhookDeliveryPending, Attempts: WebhookMaxAttempts - 1}
+
+	recorded := dispatchOnce(t, webhook, delivery)
+
+	assert.Equal(t, models.WebhookDeliveryFailed, recorded.Status)
+	assert.Equal(t, WebhookMaxAttempts, recorded.Attempts)
+	assert.Contains(t, recorded.LastError, "502")
+}
+
+func TestDispatch_DisabledWebhookIsNotCalled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("disabled webhook was called")
+	}))
+	defer server.Close()
+	webhook := &models.Webhook{ID: primitive.NewObjectID(), URL: server.URL, Active: false}
+	delivery := &models.WebhookDelivery{ID: primitive.NewObjectID(), WebhookID: webhook.ID, Status: models.WebhookDeliveryPending}
+
+	recorded := dispatchOnce(t, webhook, delivery)
+
+	assert.Equal(t, models.WebhookDeliveryFailed, recorded.Status)
+	assert.Equal(t, 0, recorded.Attempts)
+}
+
+func TestCreateWebhook_ReturnsSecretOnce(t *testing.T) {
+	mockRepo := new(MockWebhookRepository)
+	service := NewWebhookService(mockRepo, new(MockWebhookDeliveryRepository))
+
+	mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*models.Webhook")).Return(nil)
+
+	created, err := service.CreateWebhook(adminContext(), &models.WebhookRequest{
+		URL:    "https://erp.example.com/hooks",
+		Events: []models.WebhookEventType{models.WebhookEventPaymentCreated},
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, created.Secret, 64)
+	assert.True(t, created.Active)
+	assert.Equal(t, "admin-1", created.CreatedBy)
+
+	stored := mockRepo.Calls[0].Arguments.Get(1).(*models.Webhook)
+	mockRepo.On("FindByID", mock.Anything, stored.ID).Return(stored, nil)
+	fetched, err := service.GetWebhookByID(adminContext(), stored.ID.Hex())
+	assert.NoError(t, err)
+	assert.Empty(t, fetched.Secret)
+}
+
+func TestCreateWebhook_Validation(t *testing.T) {
+	service := NewWebhookService(new(MockWebhookRepository), new(MockWebhookDeliveryRepository))
+
+	for _, req := range []models.WebhookRequest{
+		{URL: "erp.example.com/hooks"},
+		{URL: "ftp://erp.example.com/hooks"},
+		{URL: "https://erp.example.com/hooks", Events: []models.WebhookEventType{"payment.exploded"}},
+	} {
+		_, err := service.CreateWebhook(adminContext(), &req)
+		assert.ErrorIs(t, err, ErrInvalidArgument, req)
+	}
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"p3-graded-challenge-2-ziancarlos/models"
+	"p3-graded-challenge-2-ziancarlos/repository"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WebhookService manages the webhooks that payment changes are delivered to.
+type WebhookService interface {
+	// CreateWebhook creates a webhook with a new signing secret, which is
+	// only ever returned here.
+	CreateWebhook(ctx context.Context, req *models.WebhookRequest) (*models.WebhookResponse, error)
+	GetAllWebhooks(ctx context.Context) ([]models.WebhookResponse, error)
+	GetWebhookByID(ctx context.Context, id string) (*models.WebhookResponse, error)
+	UpdateWebhook(ctx context.Context, id string, req *models.WebhookRequest) (*models.WebhookResponse, error)
+	// DeleteWebhook deletes a webhook along with its deliveries.
+	DeleteWebhook(ctx context.Context, id string) error
+	GetDeliveries(ctx context.Context, id string, req *models.WebhookDeliveryListRequest) (*models.WebhookDeliveryListResponse, error)
+	// RetryDelivery gives a failed delivery a fresh set of attempts.
+	RetryDelivery(ctx context.Context, id, deliveryID string) (*models.WebhookDeliveryResponse, error)
+}
+
+type webhookService struct {
+	repo       repository.WebhookRepository
+	deliveries repository.WebhookDeliveryRepository
+}
+
+func NewWebhookService(repo repository.WebhookRepository, deliveries repository.WebhookDeliveryRepository) WebhookService {
+	return &webhookService{
+		repo:       repo,
+		deliveries: deliveries,
+	}
+}
+
+func (s *webhookService) CreateWebhook(ctx context.Context, req *models.WebhookRequest) (*models.WebhookResponse, error) {
+	caller, err := callerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateWebhookRequest(req); err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+
+	webhook := &models.Webhook{
+		URL:       req.URL,
+		Secret:    hex.EncodeToString(secret),
+		Events:    req.Events,
+		Active:    req.Active == nil || *req.Active,
+		CreatedBy: caller.UserID,
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.Create(ctx, webhook); err != nil {
+		return nil, err
+	}
+
+	response := toWebhookResponse(webhook)
+	response.Secret = webhook.Secret
+	return response, nil
+}
+
+func (s *webhookService) GetAllWebhooks(ctx context.Context) ([]models.WebhookResponse, error) {
+	webhooks, err := s.repo.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]models.WebhookResponse, 0, len(webhooks))
+	for i := range webhooks {
+		responses = append(responses, *toWebhookResponse(&webhooks[i]))
+	}
+	return responses, nil
+}
+
+func (s *webhookService) GetWebhookByID(ctx context.Context, id string) (*models.WebhookResponse, error) {
+	webhook, err := s.findWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return toWebhookResponse(webhook), nil
+}
+
+func (s *webhookService) UpdateWebhook(ctx context.Context, id string, req *models.WebhookRequest) (*models.WebhookResponse, error) {
+	webhook, err := s.findWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateWebhookRequest(req); err != nil {
+		return nil, err
+	}
+
+	webhook.URL = req.URL
+	webhook.Events = req.Events
+	if req.Active != nil {
+		webhook.Active = *req.Active
+	}
+	if err := s.repo.Update(ctx, webhook.ID, webhook); err != nil {
+		return nil, err
+	}
+
+	return toWebhookResponse(webhook), nil
+}
+
+func (s *webhookService) DeleteWebhook(ctx context.Context, id string) error {
+	webhook, err := s.findWebhook(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.Delete(ctx, webhook.ID); err != nil {
+		return err
+	}
+	return s.deliveries.DeleteByWebhook(ctx, webhook.ID)
+}
+
+func (s *webhookService) GetDeliveries(ctx context.Context, id string, req *models.WebhookDeliveryListRequest) (*models.WebhookDeliveryListResponse, error) {
+	webhook, err := s.findWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := pageOptions(req.ListRequest)
+	if err != nil {
+		return nil, err
+	}
+	if page.Sort == "" {
+		page.Sort = "-created_at"
+	}
+	if req.Status != "" && !req.Status.Valid() {
+		return nil, fmt.Errorf("%w: unknown delivery status %q", ErrInvalidArgument, req.Status)
+	}
+
+	deliveries, next, err := s.deliveries.Find(ctx, webhook.ID, req.Status, page)
+	if err != nil {
+		return nil, listError(err)
+	}
+
+	responses := make([]models.WebhookDeliveryResponse, 0, len(deliveries))
+	for i := range deliveries {
+		responses = append(responses, *toWebhookDeliveryResponse(&deliveries[i]))
+	}
+
+	return &models.WebhookDeliveryListResponse{
+		Deliveries:    responses,
+		NextPageToken: next,
+	}, nil
+}
+
+func (s *webhookService) RetryDelivery(ctx context.Context, id, deliveryID string) (*models.WebhookDeliveryResponse, error) {
+	webhook, err := s.findWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	objectID, err := primitive.ObjectIDFromHex(deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid delivery ID: %v", ErrInvalidArgument, err)
+	}
+
+	retried, err := s.deliveries.Retry(ctx, webhook.ID, objectID)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery, err := s.deliveries.FindByID(ctx, webhook.ID, objectID)
+	if err != nil {
+		return nil, err
+	}
+	if !retried {
+		return nil, fmt.Errorf("%w: only failed deliveries can be retried, this one is %s", ErrFailedPrecondition, delivery.Status)
+	}
+
+	return toWebhookDeliveryResponse(delivery), nil
+}
+
+func (s *webhookService) findWebhook(ctx context.Context, id string) (*models.Webhook, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid webhook ID: %v", ErrInvalidArgument, err)
+	}
+
+	return s.repo.FindByID(ctx, objectID)
+}
+
+// validateWebhookRequest checks that the URL is an absolute http or https
+// URL and that every event type is known.
+func validateWebhookRequest(req *models.WebhookRequest) error {
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidArgument)
+	}
+	for _, event := range req.Events {
+		if !event.Valid() {
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalidArgument, event)
+		}
+	}
+	return nil
+}
+
+func toWebhookResponse(webhook *models.Webhook) *models.WebhookResponse {
+	events := webhook.Events
+	if events == nil {
+		events = []models.WebhookEventType{}
+	}
+	return &models.WebhookResponse{
+		ID:        webhook.ID.Hex(),
+		URL:       webhook.URL,
+		Events:    events,
+		Active:    webhook.Active,
+		CreatedBy: webhook.CreatedBy,
+		CreatedAt: webhook.CreatedAt,
+	}
+}
+
+func toWebhookDeliveryResponse(delivery *models.WebhookDelivery) *models.WebhookDeliveryResponse {
+	response := &models.WebhookDeliveryResponse{
+		ID:             delivery.ID.Hex(),
+		WebhookID:      delivery.WebhookID.Hex(),
+		EventID:        delivery.EventID.Hex(),
+		EventType:      delivery.EventType,
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		LastError:      delivery.LastError,
+		LastStatusCode: delivery.LastStatusCode,
+		CreatedAt:      delivery.CreatedAt,
+		DeliveredAt:    delivery.DeliveredAt,
+	}
+	if delivery.Status == models.WebhookDeliveryPending {
+		nextAttemptAt := delivery.NextAttemptAt
+		response.NextAttemptAt = &nextAttemptAt
+	}
+	return response
+}